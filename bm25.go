@@ -0,0 +1,244 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// BM25Index is an inverted index scoring entries' text against a query with Okapi BM25.
+// https://en.wikipedia.org/wiki/Okapi_BM25
+// It lives alongside a VectorDB (using the same IDs) so decisive keywords ("Key Vault", "Kusto", ...) that
+// embeddings underweight can be fused with vector similarity by a hybridSearcher.
+type BM25Index struct {
+	mu          sync.RWMutex
+	k1, b       float64
+	lengths     map[ID]int            // Document ID -> number of terms
+	postings    map[string]map[ID]int // Term -> document ID -> term frequency
+	totalLength int
+}
+
+// NewBM25Index creates an index; k1 (term frequency saturation) is typically 1.2 and b (length normalization) 0.75.
+func NewBM25Index(k1, b float64) *BM25Index {
+	return &BM25Index{k1: k1, b: b, lengths: map[ID]int{}, postings: map[string]map[ID]int{}}
+}
+
+// Upsert indexes (or re-indexes) a document's text.
+func (ix *BM25Index) Upsert(id ID, text string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+	terms := tokenize(text)
+	ix.lengths[id] = len(terms)
+	ix.totalLength += len(terms)
+	for _, term := range terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = map[ID]int{}
+		}
+		ix.postings[term][id]++
+	}
+}
+
+// Delete removes a document from the index.
+func (ix *BM25Index) Delete(id ID) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+}
+
+func (ix *BM25Index) delete(id ID) {
+	length, ok := ix.lengths[id]
+	if !ok {
+		return
+	}
+	for term, docs := range ix.postings {
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.lengths, id)
+	ix.totalLength -= length
+}
+
+// Scores returns the BM25 score of every document containing at least one of the query's terms.
+func (ix *BM25Index) Scores(query string) map[ID]float64 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	scores := map[ID]float64{}
+	if len(ix.lengths) == 0 {
+		return scores
+	}
+	n, averageLength := float64(len(ix.lengths)), float64(ix.totalLength)/float64(len(ix.lengths))
+	seen := map[string]bool{}
+	for _, term := range tokenize(query) {
+		if seen[term] { // Each distinct query term counts once
+			continue
+		}
+		seen[term] = true
+		docs := ix.postings[term]
+		idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+		for id, tf := range docs {
+			f := float64(tf)
+			scores[id] += idf * f * (ix.k1 + 1) / (f + ix.k1*(1-ix.b+ix.b*float64(ix.lengths[id])/averageLength))
+		}
+	}
+	return scores
+}
+
+// stopwords are common English words that carry no signal for tool selection.
+var stopwords = map[string]bool{
+	"a": true, "all": true, "an": true, "and": true, "are": true, "as": true, "be": true, "by": true, "can": true,
+	"do": true, "for": true, "from": true, "have": true, "i": true, "in": true, "is": true, "it": true, "me": true,
+	"my": true, "of": true, "on": true, "or": true, "please": true, "that": true, "the": true, "this": true,
+	"to": true, "what": true, "which": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize lower-cases text & splits it into terms at non-alphanumeric characters, dropping stopwords.
+// "\r\n" escapes in descriptions & "<placeholder>" brackets are treated as separators too.
+func tokenize(text string) []string {
+	text = strings.NewReplacer(`\r\n`, " ", `\n`, " ").Replace(strings.ToLower(text))
+	terms := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	return slices.DeleteFunc(terms, func(t string) bool { return stopwords[t] })
+}
+
+// bm25FromTools indexes each tool's name words & embedded text.
+func bm25FromTools(tools []mcp.Tool, o *indexOptions, k1, b float64) *BM25Index {
+	ix := NewBM25Index(k1, b)
+	for i := range tools {
+		document, _, _ := o.documents(&tools[i]) // A tool whose document can't be built is indexed by its name words alone
+		ix.Upsert(entryID(&tools[i]), newToolDocument(&tools[i]).NameWords+" "+document)
+	}
+	return ix
+}
+
+// fusionMethod selects how a hybridSearcher combines the lexical & vector rankings.
+type fusionMethod int
+
+const (
+	fuseReciprocalRank fusionMethod = iota // score = (1-w)/(k+vectorRank) + w/(k+lexicalRank)
+	fuseWeightedScores                     // score = (1-w)*normalized(vectorScore) + w*normalized(lexicalScore); min-max normalized, closest 1
+)
+
+// fusionOptions tunes a hybridSearcher.
+type fusionOptions struct {
+	Method        fusionMethod
+	RRFK          float64 // k for reciprocal rank fusion; 60 is customary
+	LexicalWeight float64 // w: 0 is vector only, 1 is lexical only
+	K1, B         float64 // BM25 parameters
+}
+
+var defaultFusionOptions = fusionOptions{Method: fuseReciprocalRank, RRFK: 60, LexicalWeight: 0.5, K1: 1.2, B: 0.75}
+
+// parseFusionOptions parses "rrf" or "weighted" optionally followed by ":name=value,..." where the names
+// are k (RRF's k), lexical (the lexical weight), k1 & b (BM25's parameters); e.g. "rrf:k=30,lexical=0.4".
+func parseFusionOptions(spec string) (fusionOptions, error) {
+	f := defaultFusionOptions
+	method, params, _ := strings.Cut(spec, ":")
+	switch method {
+	case "rrf":
+		f.Method = fuseReciprocalRank
+	case "weighted":
+		f.Method = fuseWeightedScores
+	default:
+		return f, fmt.Errorf("unknown fusion method %q; expected rrf or weighted", method)
+	}
+	for _, p := range strings.Split(params, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		v, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			return f, fmt.Errorf("invalid fusion parameter %q; expected name=number", p)
+		}
+		switch name {
+		case "k":
+			f.RRFK = v
+		case "lexical":
+			f.LexicalWeight = v
+		case "k1":
+			f.K1 = v
+		case "b":
+			f.B = v
+		default:
+			return f, fmt.Errorf("unknown fusion parameter %q; expected k, lexical, k1 or b", name)
+		}
+	}
+	return f, nil
+}
+
+func (f fusionOptions) String() string {
+	if f.Method == fuseWeightedScores {
+		return fmt.Sprintf("weighted:lexical=%g", f.LexicalWeight)
+	}
+	return fmt.Sprintf("rrf:k=%g,lexical=%g", f.RRFK, f.LexicalWeight)
+}
+
+// hybridSearcher fuses a lexical (BM25) ranking with a vector ranking. The fused score replaces
+// QueryResult.Score; o.MinimumScore applies to vector similarity before fusion.
+type hybridSearcher struct {
+	db      *VectorDB
+	lexical *BM25Index
+	fusion  fusionOptions
+}
+
+func (s *hybridSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	topK := o.TopK
+	o.TopK = getAllTools(s.db) // Rank every candidate by vector similarity
+	vectorResults := s.db.Query(vector, o)
+	lexicalScores := s.lexical.Scores(prompt)
+
+	// Rank the vector candidates lexically
+	lexicalOrder := slices.Clone(vectorResults)
+	slices.SortStableFunc(lexicalOrder, func(a, b QueryResult) int {
+		return cmp.Compare(lexicalScores[b.Entry.ID], lexicalScores[a.Entry.ID])
+	})
+	lexicalRank := map[ID]int{}
+	for i, qr := range lexicalOrder {
+		if lexicalScores[qr.Entry.ID] > 0 { // Documents without any query term are unranked
+			lexicalRank[qr.Entry.ID] = i + 1
+		}
+	}
+
+	minV, maxV, maxL := math.Inf(1), math.Inf(-1), 0.0
+	for _, qr := range vectorResults {
+		minV, maxV = math.Min(minV, float64(qr.Score)), math.Max(maxV, float64(qr.Score))
+		maxL = math.Max(maxL, lexicalScores[qr.Entry.ID])
+	}
+	w := s.fusion.LexicalWeight
+	fused := make([]QueryResult, len(vectorResults))
+	for i, qr := range vectorResults {
+		score := 0.0
+		switch s.fusion.Method {
+		case fuseReciprocalRank:
+			score = (1 - w) / (s.fusion.RRFK + float64(i+1))
+			if rank, ok := lexicalRank[qr.Entry.ID]; ok {
+				score += w / (s.fusion.RRFK + float64(rank))
+			}
+		case fuseWeightedScores:
+			v := 0.0
+			if maxV > minV {
+				v = (float64(qr.Score) - minV) / (maxV - minV)
+				if !s.db.distanceMetric.BiggerIsCloser() { // The closest has the smallest distance
+					v = 1 - v
+				}
+			}
+			l := 0.0
+			if maxL > 0 {
+				l = lexicalScores[qr.Entry.ID] / maxL
+			}
+			score = (1-w)*v + w*l
+		}
+		fused[i] = QueryResult{Score: float32(score), Entry: qr.Entry}
+	}
+	slices.SortStableFunc(fused, func(a, b QueryResult) int { return cmp.Compare(b.Score, a.Score) })
+	return fused[:min(topK, len(fused))]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBM25Scores(t *testing.T) {
+	ix := NewBM25Index(1.2, 0.75)
+	ix.Upsert("vault", "Key Vault secrets list")
+	ix.Upsert("account", "Storage account list")
+	ix.Upsert("container", "Storage container list")
+	ix.Upsert("blob", "Storage blob list for a container in an account in a subscription of a tenant")
+
+	scores := ix.Scores("The STORAGE vault") // Case & stopwords are ignored
+	if len(scores) != 4 {
+		t.Fatalf("got scores %v, want 1 per document with a query term", scores)
+	}
+	// A term in fewer documents weighs more
+	if scores["vault"] <= scores["account"] {
+		t.Errorf("the rare term \"vault\" scored %.3f, no more than the common term \"storage\" %.3f", scores["vault"], scores["account"])
+	}
+	// Documents of the same length with the same term frequencies score the same; a longer one scores less
+	if scores["account"] != scores["container"] || scores["blob"] >= scores["account"] {
+		t.Errorf("got scores %v, want account = container > blob", scores)
+	}
+	// A term in every document still scores above 0
+	if s := ix.Scores("list"); s["account"] <= 0 {
+		t.Errorf("a term in every document scored %.3f", s["account"])
+	}
+
+	ix.Upsert("vault", "Key Vault keys") // Re-indexing replaces the document's terms
+	if s := ix.Scores("secrets"); len(s) != 0 {
+		t.Errorf("got scores %v for a term no longer indexed", s)
+	}
+	ix.Delete("vault")
+	if s := ix.Scores("vault"); len(s) != 0 {
+		t.Errorf("got scores %v for a deleted document", s)
+	}
+}
+
+func TestBM25ScoreFormula(t *testing.T) {
+	const k1, b = 1.2, 0.75
+	ix := NewBM25Index(k1, b)
+	ix.Upsert("short", "vault")
+	ix.Upsert("long", "vault vault keys")
+	// n=2 documents, both containing "vault": idf = ln(1 + (2-2+0.5)/(2+0.5)); the average length is 2
+	idf := math.Log(1 + 0.5/2.5)
+	want := map[ID]float64{
+		"short": idf * 1 * (k1 + 1) / (1 + k1*(1-b+b*1.0/2)),
+		"long":  idf * 2 * (k1 + 1) / (2 + k1*(1-b+b*3.0/2)),
+	}
+	scores := ix.Scores("vault")
+	if len(scores) != len(want) {
+		t.Fatalf("got scores %v, want %v", scores, want)
+	}
+	for id, score := range scores {
+		if math.Abs(score-want[id]) > 1e-12 {
+			t.Errorf("%s: got score %g, want %g", id, score, want[id])
+		}
+	}
+}
+
+func TestHybridSearcherFusion(t *testing.T) {
+	// Vector similarity ranks account, secret, key; only secret & key mention a vault (with equal BM25 scores)
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	db.Upsert(&Entry{ID: "account", Vector: []float32{1, 0}})
+	db.Upsert(&Entry{ID: "secret", Vector: []float32{0.8, 0.6}})
+	db.Upsert(&Entry{ID: "key", Vector: []float32{0.6, 0.8}})
+	lexical := NewBM25Index(1.2, 0.75)
+	lexical.Upsert("account", "storage accounts list")
+	lexical.Upsert("secret", "key vault secrets")
+	lexical.Upsert("key", "key vault keys")
+
+	tests := []struct {
+		name   string
+		fusion fusionOptions
+		want   []ID
+		scores []float64
+	}{
+		// account: 0.5/(60+1); secret: 0.5/(60+2) + 0.5/(60+1); key: 0.5/(60+3) + 0.5/(60+2)
+		{"rrf", fusionOptions{Method: fuseReciprocalRank, RRFK: 60, LexicalWeight: 0.5},
+			[]ID{"secret", "key", "account"}, []float64{0.5/62 + 0.5/61, 0.5/63 + 0.5/62, 0.5 / 61}},
+		{"rrf vector only", fusionOptions{Method: fuseReciprocalRank, RRFK: 60, LexicalWeight: 0},
+			[]ID{"account", "secret", "key"}, []float64{1.0 / 61, 1.0 / 62, 1.0 / 63}},
+		// Min-max normalized vector similarities are 1, 0.5 & 0; lexical scores 0, 1 & 1. The tie keeps vector order.
+		{"weighted", fusionOptions{Method: fuseWeightedScores, LexicalWeight: 0.5},
+			[]ID{"secret", "account", "key"}, []float64{0.75, 0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &hybridSearcher{db: db, lexical: lexical, fusion: tt.fusion}
+			results := s.Search("vault", []float32{1, 0}, QueryOptions{TopK: 3})
+			for i, qr := range results {
+				if qr.Entry.ID != tt.want[i] || math.Abs(float64(qr.Score)-tt.scores[i]) > 1e-6 {
+					t.Errorf("got %s scoring %.6f at rank %d, want %s scoring %.6f", qr.Entry.ID, qr.Score, i+1, tt.want[i], tt.scores[i])
+				}
+			}
+			if len(results) != len(tt.want) {
+				t.Errorf("got %d results, want %d", len(results), len(tt.want))
+			}
+			if top := s.Search("vault", []float32{1, 0}, QueryOptions{TopK: 1}); len(top) != 1 || top[0].Entry.ID != tt.want[0] {
+				t.Errorf("got %v for TopK 1, want [%s]", resultIDs(top), tt.want[0])
+			}
+		})
+	}
+}
+
+// Weighted fusion normalizes a distance so that the closest tool's vector score is 1, as for a similarity.
+func TestHybridSearcherWeightedFusionByDistance(t *testing.T) {
+	db := NewVectorDB(euclideanDistance{}, nil)
+	db.Upsert(&Entry{ID: "account", Vector: []float32{1, 0}})    // Distance 0
+	db.Upsert(&Entry{ID: "secret", Vector: []float32{0.8, 0.6}}) // Distance √0.4
+	db.Upsert(&Entry{ID: "key", Vector: []float32{0.6, 0.8}})    // Distance √0.8
+	lexical := NewBM25Index(1.2, 0.75)
+	lexical.Upsert("account", "storage accounts list")
+	lexical.Upsert("secret", "key vault secrets")
+	lexical.Upsert("key", "key vault keys")
+	s := &hybridSearcher{db: db, lexical: lexical, fusion: fusionOptions{Method: fuseWeightedScores, LexicalWeight: 0.5}}
+	results := s.Search("vault", []float32{1, 0}, QueryOptions{TopK: 3})
+	secret := 0.5*(1-math.Sqrt(0.4)/math.Sqrt(0.8)) + 0.5
+	want, scores := []ID{"secret", "account", "key"}, []float64{secret, 0.5, 0.5}
+	for i, qr := range results {
+		if qr.Entry.ID != want[i] || math.Abs(float64(qr.Score)-scores[i]) > 1e-6 {
+			t.Errorf("got %s scoring %.6f at rank %d, want %s scoring %.6f", qr.Entry.ID, qr.Score, i+1, want[i], scores[i])
+		}
+	}
+	if len(results) != len(want) {
+		t.Errorf("got %d results, want %d", len(results), len(want))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// An agent can only afford so many tokens of tool definitions in its context window. Instead of the top K
+// tools, a budgeted selection returns the best-scoring tools whose definitions (the JSON of their name,
+// description & inputSchema) fit in a token budget, counted by an approximation of a model's tokenizer.
+
+// A tokenCounter approximates the number of tokens a model's tokenizer splits text into.
+type tokenCounter func(text string) int
+
+var tokenCounters = map[string]tokenCounter{
+	"chars": charTokens, // 4 characters per token
+	"words": wordTokens, // Closer for JSON, whose punctuation is mostly a token per character
+}
+
+func tokenCounterNames() []string { return slices.Sorted(maps.Keys(tokenCounters)) }
+
+func lookupTokenCounter(name string) (tokenCounter, error) {
+	count, ok := tokenCounters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q; expected one of %v", name, tokenCounterNames())
+	}
+	return count, nil
+}
+
+func charTokens(text string) int { return (utf8.RuneCountInString(text) + 3) / 4 }
+
+// wordTokens counts a token per 5 letters (rounded up) of each word, per 3 digits of each number & per
+// punctuation character; whitespace joins the token that follows it.
+func wordTokens(text string) int {
+	tokens, letters, digits := 0, 0, 0
+	flush := func() {
+		tokens += (letters+4)/5 + (digits+2)/3
+		letters, digits = 0, 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// toolTokens returns the number of tokens of the tool's definition as an agent sees it.
+func toolTokens(t *mcp.Tool, count tokenCounter) int {
+	definition := struct {
+		Name        string          `json:"name"`
+		Description *string         `json:"description,omitempty"`
+		InputSchema json.RawMessage `json:"inputSchema"`
+	}{t.Name, t.Description, t.InputSchema}
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return 0
+	}
+	return count(string(data))
+}
+
+// selectWithinBudget returns the indices (ascending) of the results (best first) whose tools' definitions fit
+// in budget tokens. Greedy selection takes each result in rank order if it still fits; knapsack selection
+// maximizes the sum of the (positive) scores, which may trade a long definition for several shorter ones.
+func selectWithinBudget(results []QueryResult, budget int, count tokenCounter, knapsack bool) []int {
+	tokens := make([]int, len(results))
+	for i, qr := range results {
+		if t, ok := qr.Entry.Metadata.(*mcp.Tool); ok {
+			tokens[i] = toolTokens(t, count)
+		}
+	}
+	selected := []int{}
+	if !knapsack {
+		used := 0
+		for i := range results {
+			if used+tokens[i] <= budget {
+				selected, used = append(selected, i), used+tokens[i]
+			}
+		}
+		return selected
+	}
+
+	// best[w] is the greatest score sum of the results considered so far using at most w tokens; took[i][w]
+	// records whether result i is in that sum.
+	best, took := make([]float64, budget+1), make([][]bool, len(results))
+	for i, qr := range results {
+		took[i] = make([]bool, budget+1)
+		if qr.Score <= 0 {
+			continue
+		}
+		for w := budget; w >= tokens[i]; w-- {
+			if v := best[w-tokens[i]] + float64(qr.Score); v > best[w] {
+				best[w], took[i][w] = v, true
+			}
+		}
+	}
+	for i, w := len(results)-1, budget; i >= 0; i-- {
+		if took[i][w] {
+			selected, w = append(selected, i), w-tokens[i]
+		}
+	}
+	slices.Reverse(selected)
+	return selected
+}
+
+// budgetSlack bounds the candidates ranked for a selection within a budget: budgetSlack times as many as would fit
+// if every definition were as short as the catalog's shortest, so costly stages like reranking don't rank the whole
+// catalog & the knapsack's table stays small. The slack leaves room for the candidates passed over as too long.
+const budgetSlack = 2
+
+// budgetCandidates returns the number of results to rank for a selection within budget tokens (see budgetSlack).
+func budgetCandidates(db *VectorDB, budget int, count tokenCounter) int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	shortest := 0
+	for _, e := range db.entries {
+		if t, ok := e.Metadata.(*mcp.Tool); ok {
+			if n := toolTokens(t, count); shortest == 0 || n < shortest {
+				shortest = n
+			}
+		}
+	}
+	return min(budgetSlack*budget/max(shortest, 1), len(db.entries))
+}
+
+// budgetSearch is calibration.Search returning, instead of the top o.TopK results, the results greedily
+// selected within budget tokens (at most o.TopK of them if it's > 0) from the budgetCandidates best. Confidences
+// are of the candidates' ranking.
+func (c *calibration) budgetSearch(s searcher, db *VectorDB, prompt string, vector []float32, o QueryOptions, budget int,
+	count tokenCounter) ([]QueryResult, []float64) {
+	topK := o.TopK
+	o.TopK = budgetCandidates(db, budget, count)
+	results, confidences := c.Search(s, db, prompt, vector, o)
+	selected, selectedConfidences := []QueryResult{}, []float64(nil)
+	for _, i := range selectWithinBudget(results, budget, count, false) {
+		if topK > 0 && len(selected) == topK {
+			break
+		}
+		selected = append(selected, results[i])
+		if confidences != nil {
+			selectedConfidences = append(selectedConfidences, confidences[i])
+		}
+	}
+	return selected, selectedConfidences
+}
+
+// parseBudgets parses the comma-separated token budgets of eval's -budget flag.
+func parseBudgets(spec string) ([]int, error) {
+	budgets := []int{}
+	for _, b := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(b))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid token budget %q; expected a positive number of tokens", b)
+		}
+		budgets = append(budgets, n)
+	}
+	return budgets, nil
+}
+
+// reportBudgets reports, for each budget & both selections, the recall (positive cases with an acceptable
+// tool among those selected) & the average number of tools & tokens selected.
+func reportBudgets(s searcher, db *VectorDB, testCases []testCase, o QueryOptions, budgets []int, tokenizer string) {
+	count := tokenCounters[tokenizer]
+	start := time.Now()
+	type row struct {
+		Budget              int
+		Method              string
+		Hits, Tools, Tokens int
+	}
+	rows := []*row{}
+	for _, b := range budgets {
+		rows = append(rows, &row{Budget: b, Method: "greedy"}, &row{Budget: b, Method: "knapsack"})
+	}
+	catalogTokens, positives := 0, 0
+	db.mu.RLock()
+	for _, e := range db.entries {
+		if t, ok := e.Metadata.(*mcp.Tool); ok {
+			catalogTokens += toolTokens(t, count)
+		}
+	}
+	db.mu.RUnlock()
+
+	o.TopK = budgetCandidates(db, slices.Max(budgets), count)
+	for _, c := range embedPromptCases(testCases) {
+		if c.IsNegative() {
+			continue
+		}
+		positives++
+		results := s.Search(c.Query(), c.Vector, o)
+		for _, r := range rows {
+			selected := selectWithinBudget(results, r.Budget, count, r.Method == "knapsack")
+			if slices.ContainsFunc(selected, func(i int) bool { return c.Accepts(results[i].Entry) }) {
+				r.Hits++
+			}
+			r.Tools += len(selected)
+			for _, i := range selected {
+				r.Tokens += toolTokens(results[i].Entry.Metadata.(*mcp.Tool), count)
+			}
+		}
+	}
+	average := func(n int) float64 { return float64(n) / float64(max(positives, 1)) }
+
+	if isMarkdownOutput() {
+		fmt.Println("## Token Budgets")
+		fmt.Println()
+		fmt.Printf("**Tokenizer:** %s, **All %d tools:** %d tokens  \n", tokenizer, getAllTools(db), catalogTokens)
+		fmt.Println()
+		fmt.Println("| Budget | Selection | Recall | Tools | Tokens |")
+		fmt.Println("|--------|-----------|--------|-------|--------|")
+		for _, r := range rows {
+			fmt.Printf("| %d | %s | %.1f%% | %.1f | %.0f |\n", r.Budget, r.Method, percent(r.Hits, positives), average(r.Tools), average(r.Tokens))
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nToken budgets: tokenizer=%s, all %d tools=%d tokens\n", tokenizer, getAllTools(db), catalogTokens)
+		fmt.Printf("   %8s %-9s %8s %7s %8s\n", "Budget", "Selection", "Recall", "Tools", "Tokens")
+		for _, r := range rows {
+			fmt.Printf("   %8d %-9s %7.1f%% %7.1f %8.0f\n", r.Budget, r.Method, percent(r.Hits, positives), average(r.Tools), average(r.Tokens))
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// xTokens counts a token per "x", so a test tool's tokens are the x's of its description.
+func xTokens(text string) int { return strings.Count(text, "x") }
+
+// budgetResults returns a result per score for a tool whose definition has the corresponding number of xTokens.
+func budgetResults(scores []float32, tokens []int) []QueryResult {
+	results := []QueryResult{}
+	for i := range scores {
+		t := newTestTool(string(rune('a'+i)), strings.Repeat("x", tokens[i]))
+		results = append(results, QueryResult{Score: scores[i], Entry: &Entry{ID: entryID(&t), Metadata: &t}})
+	}
+	return results
+}
+
+func TestSelectWithinBudget(t *testing.T) {
+	tests := []struct {
+		name             string
+		scores           []float32
+		tokens           []int
+		budget           int
+		greedy, knapsack []int
+	}{
+		// Greedy takes the best tool; the knapsack trades it for 2 shorter ones scoring more together
+		{"trade", []float32{0.9, 0.6, 0.5}, []int{6, 3, 3}, 6, []int{0}, []int{1, 2}},
+		{"skip what doesn't fit", []float32{0.9, 0.8, 0.7, 0.6}, []int{7, 2, 5, 3}, 6, []int{1, 3}, []int{1, 3}},
+		{"everything fits", []float32{0.9, 0.8}, []int{2, 2}, 10, []int{0, 1}, []int{0, 1}},
+		{"nothing fits", []float32{0.9, 0.8}, []int{5, 6}, 4, []int{}, []int{}},
+		// The knapsack maximizes the sum of positive scores only
+		{"non-positive scores", []float32{0.5, 0, -0.2}, []int{1, 1, 1}, 3, []int{0, 1, 2}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := budgetResults(tt.scores, tt.tokens)
+			if got := selectWithinBudget(results, tt.budget, xTokens, false); !slices.Equal(got, tt.greedy) {
+				t.Errorf("greedy: got %v, want %v", got, tt.greedy)
+			}
+			if got := selectWithinBudget(results, tt.budget, xTokens, true); !slices.Equal(got, tt.knapsack) {
+				t.Errorf("knapsack: got %v, want %v", got, tt.knapsack)
+			}
+		})
+	}
+}
+
+func TestTokenCounters(t *testing.T) {
+	tests := []struct {
+		count       tokenCounter
+		text        string
+		want        int
+		description string
+	}{
+		{charTokens, "abcde", 2, "4 characters per token, rounded up"},
+		{charTokens, "", 0, "none for nothing"},
+		{wordTokens, `{"name": "azmcp-storage"}`, 12, "a token per 5 letters of a word & per punctuation character"},
+		{wordTokens, "v2 123456 ab12", 6, "a token per 3 digits of a number; letters & digits split"},
+	}
+	for _, tt := range tests {
+		if got := tt.count(tt.text); got != tt.want {
+			t.Errorf("%q: got %d tokens, want %d (%s)", tt.text, got, tt.want, tt.description)
+		}
+	}
+}
+
+func TestBudgetCandidates(t *testing.T) {
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	for _, qr := range budgetResults([]float32{0, 0, 0, 0, 0}, []int{2, 5, 10, 10, 10}) {
+		db.Upsert(qr.Entry)
+	}
+	// budgetSlack times as many as would fit if all were as short as the shortest, 2 tokens
+	for budget, want := range map[int]int{1: 1, 2: 2, 3: 3, 10: 5} {
+		if got := budgetCandidates(db, budget, xTokens); got != want {
+			t.Errorf("budget %d: got %d candidates, want %d", budget, got, want)
+		}
+	}
+	if got := budgetCandidates(NewVectorDB(CosineSimilarity{}, nil), 10, xTokens); got != 0 {
+		t.Errorf("got %d candidates from an empty catalog", got)
+	}
+}
+
+func TestBudgetSearch(t *testing.T) {
+	tools := []mcp.Tool{
+		newTestTool("storage-account-list", "List the storage accounts in a subscription"),
+		newTestTool("storage-container-list", "List the containers in a storage account"),
+		newTestTool("storage-account-get", "Get a storage account's details"),
+		newTestTool("redis-cache-list", "Redis caches list"),
+	}
+	db := newTestDB(tools...)
+	const prompt = "List the storage accounts"
+	ranked := resultIDs(vectorSearcher{db: db}.Search(prompt, hashEmbeddings(prompt), QueryOptions{TopK: 4}))
+	budget := toolTokens(&tools[0], charTokens) + toolTokens(&tools[1], charTokens) + 1
+	results, confidences := (*calibration)(nil).budgetSearch(vectorSearcher{db: db}, db, prompt, hashEmbeddings(prompt),
+		QueryOptions{}, budget, charTokens)
+	if got := resultIDs(results); !slices.Equal(got, ranked[:2]) || confidences != nil {
+		t.Errorf("got %v with confidences %v, want %v", got, confidences, ranked[:2])
+	}
+	results, _ = (*calibration)(nil).budgetSearch(vectorSearcher{db: db}, db, prompt, hashEmbeddings(prompt),
+		QueryOptions{TopK: 1}, budget, charTokens)
+	if got := resultIDs(results); !slices.Equal(got, ranked[:1]) {
+		t.Errorf("got %v with TopK 1, want %v", got, ranked[:1])
+	}
+}
+
+func TestParseBudgets(t *testing.T) {
+	if got, err := parseBudgets("2000, 4000,8000"); err != nil || !slices.Equal(got, []int{2000, 4000, 8000}) {
+		t.Errorf("got %v, %v; want [2000 4000 8000]", got, err)
+	}
+	for _, spec := range []string{"", "0", "-1", "2000,", "2k"} {
+		if got, err := parseBudgets(spec); err == nil {
+			t.Errorf("%q: got %v, want an error", spec, got)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Raw scores aren't comparable across prompts or embedding models: 0.59 may be a sure match for one prompt & a
+// guess for another. A calibration, fit on the evaluation's results, converts a result's score & its margin over
+// the competing result into a confidence: the probability that the result is a correct tool. It's saved with
+// the index (see saveIndex) so that queries against the index report confidences too.
+
+// calibrationSample is one result of an evaluated case.
+type calibrationSample struct {
+	Score, Margin float32
+	Correct       bool // The case accepts the result's tool
+}
+
+// resultMargins returns each result's margin: for the top result, its score minus the runner-up's; for the
+// others, their score minus the top result's (so it's negative). A lone result's margin is 0.
+func resultMargins(results []QueryResult) []float32 {
+	margins := make([]float32, len(results))
+	for i, qr := range results {
+		switch {
+		case i > 0:
+			margins[i] = qr.Score - results[0].Score
+		case len(results) > 1:
+			margins[i] = qr.Score - results[1].Score
+		}
+	}
+	return margins
+}
+
+const calibrationTopK = 3 // The results per case that a calibration is fit on
+
+// collectCalibrationSamples runs every case without a minimum score & returns, per case, a sample for each
+// of its top calibrationTopK results. Every result of a negative case is incorrect.
+func collectCalibrationSamples(s searcher, db *VectorDB, cases []promptCase, o QueryOptions) [][]calibrationSample {
+	o.TopK, o.MinimumScore = calibrationTopK, float32(math.Inf(-1))
+	perCase := [][]calibrationSample{}
+	for _, c := range cases {
+		if !c.IsNegative() && len(acceptedEntries(db, &c.testCase)) == 0 {
+			log.Printf("Skipping case %s expecting unknown tools %s", c.ID, c.ExpectedString())
+			continue
+		}
+		results := s.Search(c.Query(), c.Vector, o)
+		if len(results) == 0 {
+			continue
+		}
+		samples := []calibrationSample{}
+		for i, margin := range resultMargins(results) {
+			samples = append(samples, calibrationSample{Score: results[i].Score, Margin: margin, Correct: c.Accepts(results[i].Entry)})
+		}
+		perCase = append(perCase, samples)
+	}
+	return perCase
+}
+
+// calibration converts a result's score & margin (see resultMargins) into a confidence.
+type calibration struct {
+	Method   string `json:"method"`             // platt or isotonic
+	Searcher string `json:"searcher,omitempty"` // The searcherStages whose scores it was fit on; "" is vector
+
+	// Platt scaling (logistic regression on the score & margin):
+	// confidence = 1 / (1 + e^-(ScoreWeight*score + MarginWeight*margin + Bias))
+	ScoreWeight  float64 `json:"scoreWeight,omitempty"`
+	MarginWeight float64 `json:"marginWeight,omitempty"`
+	Bias         float64 `json:"bias,omitempty"`
+
+	// Isotonic regression (a non-decreasing function of the margin): Confidences[i] is the accuracy of the
+	// samples whose mean margin is Margins[i]; confidences between them are interpolated linearly.
+	Margins     []float32 `json:"margins,omitempty"`
+	Confidences []float64 `json:"confidences,omitempty"`
+}
+
+// fitCalibration fits a calibration to samples with method: "platt" or "isotonic".
+func fitCalibration(method string, samples []calibrationSample) (*calibration, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to fit a calibration to")
+	}
+	switch method {
+	case "platt":
+		return fitPlatt(samples), nil
+	case "isotonic":
+		return fitIsotonic(samples), nil
+	}
+	return nil, fmt.Errorf("unknown calibration %q; expected platt or isotonic", method)
+}
+
+// fitPlatt fits the logistic regression by Newton's method. As in Platt's paper, the targets are smoothed
+// toward 1/2 (by the number of correct & incorrect samples) & the weights slightly regularized so that
+// perfectly separable samples don't drive them to infinity.
+func fitPlatt(samples []calibrationSample) *calibration {
+	correct := 0
+	for _, s := range samples {
+		if s.Correct {
+			correct++
+		}
+	}
+	positive, negative := float64(correct+1)/float64(correct+2), 1/float64(len(samples)-correct+2)
+	const lambda = 1e-3
+	w := []float64{0, 0, 0} // ScoreWeight, MarginWeight, Bias
+	for range 100 {
+		gradient := []float64{lambda * w[0], lambda * w[1], 0}
+		hessian := [][]float64{{lambda, 0, 0}, {0, lambda, 0}, {0, 0, 1e-9}}
+		for _, s := range samples {
+			x := []float64{float64(s.Score), float64(s.Margin), 1}
+			p := sigmoid(w[0]*x[0] + w[1]*x[1] + w[2])
+			target := negative
+			if s.Correct {
+				target = positive
+			}
+			for i := range x {
+				gradient[i] += (p - target) * x[i]
+				for j := range x {
+					hessian[i][j] += p * (1 - p) * x[i] * x[j]
+				}
+			}
+		}
+		step, ok := solveLinear(hessian, gradient)
+		if !ok {
+			break
+		}
+		change := 0.0
+		for i := range w {
+			w[i] -= step[i]
+			change = max(change, math.Abs(step[i]))
+		}
+		if change < 1e-9 {
+			break
+		}
+	}
+	return &calibration{Method: "platt", ScoreWeight: w[0], MarginWeight: w[1], Bias: w[2]}
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// solveLinear solves a·x = b by Gaussian elimination with partial pivoting; it returns false if a is singular.
+func solveLinear(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	m := make([][]float64, n) // The augmented matrix [a|b]
+	for i := range a {
+		m[i] = append(slices.Clone(a[i]), b[i])
+	}
+	for col := range n {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := col + 1; row < n; row++ {
+			f := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
+
+// fitIsotonic fits the function with the pool-adjacent-violators algorithm: samples sorted by margin form
+// blocks, & adjacent blocks whose accuracies don't increase (or with the same margin) are merged until none are.
+// The margin (unlike the score) tells a top result from the runner-ups, which share its range of scores.
+func fitIsotonic(samples []calibrationSample) *calibration {
+	sorted := slices.SortedFunc(slices.Values(samples), func(a, b calibrationSample) int { return cmp.Compare(a.Margin, b.Margin) })
+	type block struct {
+		correct, count int
+		maxMargin      float32
+		sumMargins     float64
+	}
+	accuracy := func(b block) float64 { return float64(b.correct) / float64(b.count) }
+	blocks := []block{}
+	for _, s := range sorted {
+		b := block{count: 1, maxMargin: s.Margin, sumMargins: float64(s.Margin)}
+		if s.Correct {
+			b.correct = 1
+		}
+		blocks = append(blocks, b)
+		for n := len(blocks); n > 1 && (accuracy(blocks[n-2]) >= accuracy(blocks[n-1]) || blocks[n-2].maxMargin == s.Margin); n = len(blocks) {
+			last := blocks[n-1]
+			blocks = blocks[:n-1]
+			blocks[n-2].correct += last.correct
+			blocks[n-2].count += last.count
+			blocks[n-2].maxMargin = last.maxMargin
+			blocks[n-2].sumMargins += last.sumMargins
+		}
+	}
+	c := &calibration{Method: "isotonic"}
+	for _, b := range blocks {
+		c.Margins = append(c.Margins, float32(b.sumMargins/float64(b.count)))
+		c.Confidences = append(c.Confidences, accuracy(b))
+	}
+	return c
+}
+
+// Confidence returns the probability that a result with score & margin is a correct tool.
+func (c *calibration) Confidence(score, margin float32) float64 {
+	if c.Method == "isotonic" {
+		if len(c.Confidences) == 0 {
+			return 0
+		}
+		i := sort.Search(len(c.Margins), func(i int) bool { return margin <= c.Margins[i] })
+		switch {
+		case i == 0:
+			return c.Confidences[0]
+		case i == len(c.Margins):
+			return c.Confidences[i-1]
+		}
+		f := float64((margin - c.Margins[i-1]) / (c.Margins[i] - c.Margins[i-1]))
+		return c.Confidences[i-1] + f*(c.Confidences[i]-c.Confidences[i-1])
+	}
+	return sigmoid(c.ScoreWeight*float64(score) + c.MarginWeight*float64(margin) + c.Bias)
+}
+
+// ResultConfidences returns the confidence of each result (the top K, best first); nil if c is nil.
+func (c *calibration) ResultConfidences(results []QueryResult) []float64 {
+	if c == nil {
+		return nil
+	}
+	confidences := []float64{}
+	for i, margin := range resultMargins(results) {
+		confidences = append(confidences, c.Confidence(results[i].Score, margin))
+	}
+	return confidences
+}
+
+// Check returns an error if c (which may be nil) wasn't fit on the scores of a searcher configured like s,
+// since other stages score on other scales.
+func (c *calibration) Check(s searcher) error {
+	if c == nil {
+		return nil
+	}
+	if fit, used := cmp.Or(c.Searcher, "vector"), searcherStages(s); fit != used {
+		return fmt.Errorf("the calibration was fit on the scores of %q, not %q; refit it with eval -calibration", fit, used)
+	}
+	return nil
+}
+
+// Search has s search db for a prompt & returns the results with their confidences (nil if c is nil). A
+// confidence depends on the runner-up's score, so s is asked for at least 2 results regardless of
+// o.MinimumScore, which is applied afterward. Like the uncalibrated search (whose db.Query applies it), it
+// applies to each result's vector similarity in db rather than to its score from s, which later stages may
+// have fused or boosted, & since they may also have reordered the results, every result is checked.
+func (c *calibration) Search(s searcher, db *VectorDB, prompt string, vector []float32, o QueryOptions) ([]QueryResult, []float64) {
+	if c == nil {
+		return s.Search(prompt, vector, o), nil
+	}
+	k, minimum := o.TopK, o
+	o.TopK, o.MinimumScore = max(k, 2), float32(math.Inf(-1))
+	results := s.Search(prompt, vector, o)
+	confidences := c.ResultConfidences(results)
+	kept, keptConfidences := []QueryResult{}, []float64{}
+	for i, qr := range results {
+		if len(kept) < k && db.meetsMinimum(db.score(vector, qr.Entry, &minimum), &minimum) {
+			kept, keptConfidences = append(kept, qr), append(keptConfidences, confidences[i])
+		}
+	}
+	return kept, keptConfidences
+}
+
+func (c *calibration) String() string {
+	if c.Method == "isotonic" {
+		return fmt.Sprintf("isotonic regression on the margin with %d blocks", len(c.Margins))
+	}
+	return fmt.Sprintf("Platt scaling: score weight=%.4f, margin weight=%.4f, bias=%.4f", c.ScoreWeight, c.MarginWeight, c.Bias)
+}
+
+// calibratedPrediction is a confidence & whether the result it's for was correct.
+type calibratedPrediction struct {
+	Confidence float64
+	Correct    bool
+}
+
+// reliabilityBin is the predictions whose confidence falls in [Low, High).
+type reliabilityBin struct {
+	Low, High  float64
+	Count      int
+	Confidence float64 // Mean confidence
+	Accuracy   float64 // Fraction correct
+}
+
+const reliabilityBins = 10
+
+// expectedCalibrationError returns the expected calibration error of predictions (the mean, weighted by
+// the number of predictions, of each confidence bin's |accuracy - mean confidence|) & the bins.
+func expectedCalibrationError(predictions []calibratedPrediction) (float64, []reliabilityBin) {
+	bins := make([]reliabilityBin, reliabilityBins)
+	for i := range bins {
+		bins[i].Low, bins[i].High = float64(i)/reliabilityBins, float64(i+1)/reliabilityBins
+	}
+	for _, p := range predictions {
+		b := &bins[min(max(int(p.Confidence*reliabilityBins), 0), reliabilityBins-1)]
+		b.Count++
+		b.Confidence += p.Confidence
+		if p.Correct {
+			b.Accuracy++
+		}
+	}
+	ece := 0.0
+	for i := range bins {
+		b := &bins[i]
+		if b.Count == 0 {
+			continue
+		}
+		b.Confidence /= float64(b.Count)
+		b.Accuracy /= float64(b.Count)
+		ece += float64(b.Count) / float64(len(predictions)) * math.Abs(b.Accuracy-b.Confidence)
+	}
+	return ece, bins
+}
+
+// topPredictions returns the prediction for each case's top result with confidence computed by confidence.
+func topPredictions(perCase [][]calibrationSample, confidence func(s calibrationSample) float64) []calibratedPrediction {
+	predictions := []calibratedPrediction{}
+	for _, samples := range perCase {
+		predictions = append(predictions, calibratedPrediction{Confidence: confidence(samples[0]), Correct: samples[0].Correct})
+	}
+	return predictions
+}
+
+// reportCalibration reports the expected calibration error of the top results' confidences: taking the raw
+// score as the confidence, with c (fit on all the cases or loaded from the index) & if method is set, with
+// a calibration fit by method in 2-fold cross-validation (each half of the cases is predicted by a
+// calibration fit on the other half), which estimates the error on prompts the calibration wasn't fit on.
+// The reliability table is of the cross-validated confidences if there are any.
+func reportCalibration(s searcher, db *VectorDB, method string, c *calibration, testCases []testCase, o QueryOptions) {
+	start := time.Now()
+	perCase := collectCalibrationSamples(s, db, embedPromptCases(testCases), o)
+	raw, _ := expectedCalibrationError(topPredictions(perCase, func(s calibrationSample) float64 { return min(max(float64(s.Score), 0), 1) }))
+	fitted, bins := expectedCalibrationError(topPredictions(perCase, func(s calibrationSample) float64 { return c.Confidence(s.Score, s.Margin) }))
+	crossValidated := math.NaN()
+	if method != "" {
+		predictions := []calibratedPrediction{}
+		for fold := range 2 {
+			train, test := []calibrationSample{}, [][]calibrationSample{}
+			for i, samples := range perCase {
+				if i%2 == fold {
+					test = append(test, samples)
+				} else {
+					train = append(train, samples...)
+				}
+			}
+			foldCalibration, err := fitCalibration(method, train)
+			if err != nil {
+				log.Printf("Skipping cross-validation: %v", err)
+				predictions = nil
+				break
+			}
+			predictions = append(predictions, topPredictions(test, func(s calibrationSample) float64 { return foldCalibration.Confidence(s.Score, s.Margin) })...)
+		}
+		if len(predictions) > 0 {
+			crossValidated, bins = expectedCalibrationError(predictions)
+		}
+	}
+	correct := 0
+	for _, samples := range perCase {
+		if samples[0].Correct {
+			correct++
+		}
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Score Calibration")
+		fmt.Println()
+		fmt.Printf("**Calibration:** %s  \n", c)
+		fmt.Printf("**Cases:** %d (top result correct for %.1f%%)  \n", len(perCase), percent(correct, len(perCase)))
+		fmt.Println()
+		fmt.Println("| Confidence | Expected Calibration Error |")
+		fmt.Println("|------------|----------------------------|")
+		fmt.Printf("| Raw score | %.4f |\n", raw)
+		fmt.Printf("| Calibrated | %.4f |\n", fitted)
+		if !math.IsNaN(crossValidated) {
+			fmt.Printf("| Calibrated (cross-validated) | %.4f |\n", crossValidated)
+		}
+		fmt.Println()
+		fmt.Println("### Reliability")
+		fmt.Println()
+		fmt.Println("| Confidence | Results | Mean Confidence | Accuracy |")
+		fmt.Println("|------------|---------|-----------------|----------|")
+		for _, b := range bins {
+			if b.Count > 0 {
+				fmt.Printf("| %.1f-%.1f | %d | %.1f%% | %.1f%% |\n", b.Low, b.High, b.Count, b.Confidence*100, b.Accuracy*100)
+			}
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nScore calibration: %s\n", c)
+		fmt.Printf("   Cases=%d, top result correct=%.1f%%\n", len(perCase), percent(correct, len(perCase)))
+		fmt.Printf("   Expected calibration error: raw score=%.4f, calibrated=%.4f", raw, fitted)
+		if !math.IsNaN(crossValidated) {
+			fmt.Printf(", calibrated (cross-validated)=%.4f", crossValidated)
+		}
+		fmt.Printf("\n\n   %-10s %8s %10s %9s\n", "Confidence", "Results", "Mean", "Accuracy")
+		for _, b := range bins {
+			if b.Count > 0 {
+				fmt.Printf("   %.1f-%.1f    %8d %9.1f%% %8.1f%%\n", b.Low, b.High, b.Count, b.Confidence*100, b.Accuracy*100)
+			}
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
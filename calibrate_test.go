@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A calibrated search applies MinimumScore to the results' vector similarity, like an uncalibrated one, whatever
+// the scale of the searcher's scores & however it ordered the results.
+func TestCalibrationSearchMinimumScore(t *testing.T) {
+	tools := []mcp.Tool{
+		newTestTool("storage-account-list", "List the storage accounts in a subscription"),
+		newTestTool("storage-container-list", "List the containers in a storage account"),
+		newTestTool("storage-account-get", "Get a storage account's details"),
+		newTestTool("redis-cache-delete", "Delete a Redis cache"),
+	}
+	db := newTestDB(tools...)
+	const prompt = "List the storage accounts"
+	vector := hashEmbeddings(prompt)
+	ranked := vectorSearcher{db: db}.Search(prompt, vector, QueryOptions{TopK: 4})
+	minimum := ranked[1].Score // Only the best 2 tools are similar enough
+	similarEnough := resultIDs(ranked[:2])
+	slices.Sort(similarEnough)
+
+	fusion := defaultFusionOptions
+	fusion.Method = fuseReciprocalRank
+	tests := []struct {
+		name string
+		s    searcher
+	}{
+		{"vector", vectorSearcher{db: db}},
+		{"hybrid", &hybridSearcher{db: db, lexical: bm25FromTools(tools, &indexOptions{Builder: must(lookupDocumentBuilder(""))},
+			fusion.K1, fusion.B), fusion: fusion}}, // Scores around 1/60
+		{"rerank moving a less similar tool first", &rerankSearcher{next: vectorSearcher{db: db},
+			model: &replyModel{Reply: string(ranked[2].Entry.ID)}}},
+	}
+	c := &calibration{Method: "platt"}
+	o := QueryOptions{TopK: 3, MinimumScore: minimum}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, confidences := c.Search(tt.s, db, prompt, vector, o)
+			got := resultIDs(results)
+			slices.Sort(got)
+			if !slices.Equal(got, similarEnough) || len(confidences) != len(results) {
+				t.Errorf("got %v with %d confidences, want %v", resultIDs(results), len(confidences), similarEnough)
+			}
+			results, _ = (*calibration)(nil).Search(tt.s, db, prompt, vector, o)
+			uncalibrated := resultIDs(results)
+			slices.Sort(uncalibrated)
+			if !slices.Equal(uncalibrated, similarEnough) {
+				t.Errorf("the uncalibrated search returned %v, want %v", uncalibrated, similarEnough)
+			}
+		})
+	}
+}
+
+func TestFitPlatt(t *testing.T) {
+	t.Run("separable", func(t *testing.T) {
+		samples := []calibrationSample{}
+		for i := range 20 {
+			d := float32(i) / 100
+			samples = append(samples, calibrationSample{Score: 0.8 + d, Margin: 0.1 + d, Correct: true},
+				calibrationSample{Score: 0.5 + d, Margin: -0.1 - d, Correct: false})
+		}
+		c := fitPlatt(samples)
+		for _, w := range []float64{c.ScoreWeight, c.MarginWeight, c.Bias} {
+			if math.IsNaN(w) || math.IsInf(w, 0) {
+				t.Fatalf("the weights diverged: %v", c)
+			}
+		}
+		// The regularization keeps the weights finite, so confidences approach but don't reach 0 & 1
+		for _, s := range samples {
+			if p := c.Confidence(s.Score, s.Margin); s.Correct && p < 0.8 || !s.Correct && p > 0.2 {
+				t.Errorf("%+v: got confidence %.3f", s, p)
+			}
+		}
+	})
+	t.Run("inseparable", func(t *testing.T) {
+		// Samples that look alike & are 70% correct get a confidence of about 70%
+		samples := []calibrationSample{}
+		for i := range 100 {
+			samples = append(samples, calibrationSample{Score: 0.6, Margin: 0.05, Correct: i < 70})
+		}
+		if p := fitPlatt(samples).Confidence(0.6, 0.05); math.Abs(p-0.7) > 0.02 {
+			t.Errorf("got confidence %.3f, want about 0.7", p)
+		}
+	})
+}
+
+func TestFitIsotonic(t *testing.T) {
+	tests := []struct {
+		name        string
+		samples     []calibrationSample
+		margins     []float32
+		confidences []float64
+	}{
+		{"increasing", []calibrationSample{{Margin: -0.2}, {Margin: 0.1, Correct: true}},
+			[]float32{-0.2, 0.1}, []float64{0, 1}},
+		{"violators pooled", []calibrationSample{{Margin: 0.3, Correct: true}, {Margin: -0.2, Correct: true}, {Margin: -0.1}, {Margin: 0.1}},
+			[]float32{(-0.2 - 0.1 + 0.1) / 3, 0.3}, []float64{1.0 / 3, 1}},
+		{"ties pooled", []calibrationSample{{Margin: 0.1}, {Margin: 0.1, Correct: true}, {Margin: 0.2, Correct: true}},
+			[]float32{0.1, 0.2}, []float64{0.5, 1}},
+		{"all correct", []calibrationSample{{Margin: 0, Correct: true}, {Margin: 0.1, Correct: true}},
+			[]float32{0.05}, []float64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fitIsotonic(tt.samples)
+			if len(c.Margins) != len(tt.margins) || !slices.Equal(c.Confidences, tt.confidences) {
+				t.Fatalf("got margins %v & confidences %v, want %v & %v", c.Margins, c.Confidences, tt.margins, tt.confidences)
+			}
+			for i := range c.Margins {
+				if math.Abs(float64(c.Margins[i]-tt.margins[i])) > 1e-6 {
+					t.Errorf("got margins %v, want %v", c.Margins, tt.margins)
+				}
+			}
+			// The fit is monotonic: confidence never decreases as the margin grows
+			for m, previous := float32(-1), 0.0; m <= 1; m += 0.01 {
+				p := c.Confidence(0, m)
+				if p < previous {
+					t.Errorf("confidence fell from %.3f to %.3f at margin %.2f", previous, p, m)
+				}
+				previous = p
+			}
+		})
+	}
+}
+
+func TestExpectedCalibrationError(t *testing.T) {
+	predictions := []calibratedPrediction{
+		{0.95, true}, {0.95, true}, {0.95, false}, {0.95, true}, {1, true}, // The last bin: confidence 0.96, accuracy 0.8
+		{0.25, false}, {0.25, false}, // The third bin: confidence 0.25, accuracy 0
+	}
+	ece, bins := expectedCalibrationError(predictions)
+	if want := 5.0/7*0.16 + 2.0/7*0.25; math.Abs(ece-want) > 1e-9 {
+		t.Errorf("got ECE %.6f, want %.6f", ece, want)
+	}
+	for i, b := range bins {
+		want := map[int]int{2: 2, 9: 5}[i]
+		if b.Count != want {
+			t.Errorf("bin [%.1f, %.1f) has %d predictions, want %d", b.Low, b.High, b.Count, want)
+		}
+	}
+	if math.Abs(bins[9].Confidence-0.96) > 1e-9 || math.Abs(bins[9].Accuracy-0.8) > 1e-9 {
+		t.Errorf("got the last bin %+v, want confidence 0.96 & accuracy 0.8", bins[9])
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A Catalog federates the tools of several MCP servers into one VectorDB. Each tool's origin server is
+// recorded in its _meta (under serverMetaKey) and its Entry.ID is qualified by the server name, so two
+// servers exposing a tool with the same name don't overwrite each other. Disabling a server hides its tools
+// from queries (via Predicate) without removing them from the DB.
+//
+// Queries call Predicate while holding the DB's lock, and re-indexing takes the DB's lock while embedding (over
+// the network) & updating it, so neither may wait for the other: Predicate reads a copy-on-write set of the
+// enabled servers without locking c.mu, and c.mu is never held while the DB is locked.
+
+const serverMetaKey = "toolselection/server"
+
+type Catalog struct {
+	db      *VectorDB
+	options *indexOptions // How each tool is embedded
+	mu      sync.RWMutex
+	servers map[string]*catalogServer
+	enabled atomic.Pointer[map[string]bool] // The enabled servers; replaced (never modified) under mu
+}
+
+type catalogServer struct {
+	enabled bool
+	ids     map[ID]bool // IDs of this server's tools in the DB
+	reindex sync.Mutex  // Serializes re-indexing this server's tools
+}
+
+// collision describes a tool name exposed by more than one server.
+type collision struct {
+	Name    string
+	Servers []string
+}
+
+func NewCatalog(db *VectorDB, options *indexOptions) *Catalog {
+	c := &Catalog{db: db, options: options, servers: map[string]*catalogServer{}}
+	c.enabled.Store(&map[string]bool{})
+	return c
+}
+
+// publishEnabled replaces the set of enabled servers Predicate reads; c.mu must be held.
+func (c *Catalog) publishEnabled() {
+	enabled := map[string]bool{}
+	for name, s := range c.servers {
+		if s.enabled {
+			enabled[name] = true
+		}
+	}
+	c.enabled.Store(&enabled)
+}
+
+// toolID returns the Entry.ID of a server's tool: "server/name" or just "name" if server is "".
+func toolID(server, name string) ID {
+	if server == "" {
+		return ID(name)
+	}
+	return ID(server + "/" + name)
+}
+
+// toolServer returns the name of the server a tool came from ("" if unknown).
+func toolServer(t *mcp.Tool) string {
+	if t.Meta == nil {
+		return ""
+	}
+	server, _ := (*t.Meta)[serverMetaKey].(string)
+	return server
+}
+
+// entryID returns the Entry.ID for a tool, qualified by its server (if any).
+func entryID(t *mcp.Tool) ID { return toolID(toolServer(t), t.Name) }
+
+// withServer returns copies of tools whose _meta records server as their origin.
+func withServer(server string, tools []mcp.Tool) []mcp.Tool {
+	tools = slices.Clone(tools)
+	if server == "" {
+		return tools
+	}
+	for i := range tools {
+		meta := mcp.Meta{}
+		if tools[i].Meta != nil {
+			maps.Copy(meta, *tools[i].Meta)
+		}
+		meta[serverMetaKey] = server
+		tools[i].Meta = &meta
+	}
+	return tools
+}
+
+// matchesExpected returns true if e is the tool named by expected, which is either a server-qualified
+// ID ("server/name") or a bare tool name (matching that name from any server).
+func matchesExpected(e *Entry, expected string) bool {
+	if string(e.ID) == expected {
+		return true
+	}
+	if t, ok := e.Metadata.(*mcp.Tool); ok && !strings.Contains(expected, "/") {
+		return t.Name == expected
+	}
+	return false
+}
+
+// SetServerTools makes server's tools in the catalog match tools, re-indexing incrementally.
+// A server seen for the first time is enabled. If re-indexing fails, the server keeps its previous tools.
+// c.mu isn't held while re-indexing, so queries & other servers' updates proceed while the tools are embedded.
+func (c *Catalog) SetServerTools(server string, tools []mcp.Tool) (reindexStats, error) {
+	c.mu.Lock()
+	s, ok := c.servers[server]
+	if !ok {
+		s = &catalogServer{enabled: true, ids: map[ID]bool{}}
+		c.servers[server] = s
+		c.publishEnabled()
+	}
+	c.mu.Unlock()
+
+	s.reindex.Lock() // Another update of this server's tools must not re-index from the same previous IDs
+	defer s.reindex.Unlock()
+	c.mu.RLock()
+	previous := maps.Clone(s.ids)
+	c.mu.RUnlock()
+	tools = withServer(server, tools)
+	stats, err := reindexTools(c.db, c.options, previous, tools)
+	if err != nil {
+		return stats, err
+	}
+	ids := map[ID]bool{}
+	for i := range tools {
+		ids[entryID(&tools[i])] = true
+	}
+	c.mu.Lock()
+	s.ids = ids
+	c.mu.Unlock()
+	return stats, nil
+}
+
+// SetEnabled enables or disables a server's tools; it returns false if the server is unknown.
+func (c *Catalog) SetEnabled(server string, enabled bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.servers[server]
+	if ok {
+		s.enabled = enabled
+		c.publishEnabled()
+	}
+	return ok
+}
+
+// Enabled returns true if the server is known & enabled. It doesn't lock c.mu, so it's safe to call from a
+// query's predicate.
+func (c *Catalog) Enabled(server string) bool { return (*c.enabled.Load())[server] }
+
+// Servers returns the names of all servers in the catalog, sorted.
+func (c *Catalog) Servers() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.servers))
+}
+
+// Predicate returns a QueryOptions.Predicate accepting only the tools of enabled servers that are also
+// accepted by next (which may be nil).
+func (c *Catalog) Predicate(next func(e *Entry) bool) func(e *Entry) bool {
+	return func(e *Entry) bool {
+		t, ok := e.Metadata.(*mcp.Tool)
+		if !ok || !c.Enabled(toolServer(t)) {
+			return false
+		}
+		return next == nil || next(e)
+	}
+}
+
+// Prune deletes the DB's entries that belong to no server in the catalog (e.g. loaded from a saved index)
+// & returns how many it deleted. Call it when no server's tools are being set: a tool being added isn't
+// recorded as its server's until re-indexing finishes.
+func (c *Catalog) Prune() int {
+	c.mu.RLock()
+	indexed := map[ID]bool{}
+	for _, s := range c.servers {
+		maps.Copy(indexed, s.ids)
+	}
+	c.mu.RUnlock()
+	c.db.mu.RLock()
+	stale := []ID{}
+	for _, e := range c.db.entries {
+		if !indexed[e.ID] {
+			stale = append(stale, e.ID)
+		}
+	}
+	c.db.mu.RUnlock()
+	for _, id := range stale {
+		c.db.Delete(id)
+	}
+	return len(stale)
+}
+
+// Collisions returns the tool names exposed by more than one server, sorted by name.
+func (c *Catalog) Collisions() []collision {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	servers := map[string][]string{} // Tool name -> servers exposing it
+	for server, s := range c.servers {
+		for id := range s.ids {
+			name := strings.TrimPrefix(string(id), server+"/")
+			servers[name] = append(servers[name], server)
+		}
+	}
+	collisions := []collision{}
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		if len(servers[name]) > 1 {
+			collisions = append(collisions, collision{Name: name, Servers: slices.Sorted(slices.Values(servers[name]))})
+		}
+	}
+	return collisions
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A query's predicate (holding the DB's read lock) checks whether servers are enabled while another server's
+// tools are being re-indexed (which needs the DB's write lock); neither may wait for the other.
+func TestCatalogQueryDuringSetServerTools(t *testing.T) {
+	useCountingEmbedder(t)
+	c := NewCatalog(NewVectorDB(CosineSimilarity{}, nil), &indexOptions{Builder: must(lookupDocumentBuilder(""))})
+	if _, err := c.SetServerTools("storage", []mcp.Tool{newTestTool("account-list", "List the storage accounts")}); err != nil {
+		t.Fatal(err)
+	}
+
+	queried, setting, done := make(chan struct{}), make(chan struct{}), make(chan bool)
+	predicate := c.Predicate(nil)
+	go func() {
+		first := true
+		results := c.db.Query(hashEmbeddings("storage accounts"), QueryOptions{TopK: 5, Predicate: func(e *Entry) bool {
+			if first { // Holding the DB's read lock, wait for SetServerTools to be waiting for its write lock
+				first = false
+				close(queried)
+				<-setting
+				time.Sleep(50 * time.Millisecond)
+			}
+			return predicate(e)
+		}})
+		done <- len(results) == 1
+	}()
+	<-queried
+	go func() {
+		close(setting)
+		_, _ = c.SetServerTools("redis", []mcp.Tool{newTestTool("cache-list", "List the Redis caches")})
+		done <- true
+	}()
+	for range 2 {
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Error("the query didn't find the enabled server's tool")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock: the query & SetServerTools are waiting for each other")
+		}
+	}
+	if !c.Enabled("redis") || c.Enabled("unknown") {
+		t.Errorf("got Enabled(redis)=%v, Enabled(unknown)=%v; want true, false", c.Enabled("redis"), c.Enabled("unknown"))
+	}
+	c.SetEnabled("redis", false)
+	if c.Enabled("redis") {
+		t.Error("redis is still enabled after SetEnabled(false)")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The command line is "<command> [flags]"; with no command (or just flags), eval runs. The commands that index
+// tools & select among them share the flags of selectionFlags, which also select the searcher's stages.
+
+type command struct {
+	name, summary string
+	run           func(args []string)
+}
+
+func commands() []command {
+	return []command{
+		{"index", "embed the tools & save them to an index file", runIndex},
+		{"eval", "run the test prompts & report how well tools are selected (the default)", runEval},
+		{"query", "rank the tools for a prompt", runQuery},
+		{"repl", "rank the tools for each prompt typed, interactively", runREPL},
+		{"lint", "check the tools & test prompts for problems", runLint},
+		{"diff", "compare how two versions of the tools fare on the test prompts", runDiff},
+		{"optimize", "suggest description edits fixing failing prompts & write the edited tools", runOptimize},
+		{"serve", "run a server: find-tools or proxy (MCP over stdio) or http (JSON)", runServe},
+		{"compare-documents", "compare the built-in document builders", runCompareDocuments},
+		{"compare-fusion", "compare hybrid fusion configurations", runCompareFusion},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for a command's flags.\n", os.Args[0])
+}
+
+// selectionFlags are the flags of the commands that index tools & select among them.
+type selectionFlags struct {
+	Tools, Index                string
+	Document, Vectors, Examples string
+	Metric, Embedder, Format    string
+	Aggregation, Filter         string
+	Tokenizer, Context, Rewrite string
+	K                           int
+	MinScore                    float64
+	*searchFlags
+
+	search *searchConfig // The parsed searchFlags
+}
+
+func addSelectionFlags(fs *flag.FlagSet, k int) *selectionFlags {
+	f := &selectionFlags{searchFlags: addSearchFlags(fs)}
+	fs.StringVar(&f.Tools, "tools", "list-tools.json", "file containing the (quoted) JSON of a tools/list result")
+	fs.StringVar(&f.Index, "index", "", "index file of the embedded tools: loaded if it exists (re-embedding only "+
+		"the tools that changed), otherwise saved")
+	fs.StringVar(&f.Document, "document", defaultDocumentBuilder, fmt.Sprintf("how each tool's "+
+		"embedded text is composed: one of %v or a text/template", documentBuilderNames()))
+	fs.StringVar(&f.Vectors, "vectors", "", "comma-separated additional vectors per tool: name, parameters")
+	fs.StringVar(&f.Examples, "examples", "", "JSON file of example prompts per tool, each adding an example vector")
+	fs.StringVar(&f.Metric, "metric", "cosine", fmt.Sprintf("distance metric: one of %v", distanceMetricNames()))
+	fs.StringVar(&f.Embedder, "embedder", "aoai", fmt.Sprintf("embedder: one of %v", embedderNames()))
+	fs.StringVar(&f.Format, "format", "text", "output format: text or md")
+	fs.StringVar(&f.Aggregation, "aggregation", "", "how the scores of a tool's vectors combine: "+
+		"max, mean or weighted-sum:group=weight,...")
+	fs.StringVar(&f.Filter, "filter", "", `expression selecting the tools that may be returned, e.g. `+
+		`'annotations.readOnlyHint && name startsWith "azmcp-storage"' (see filter.go)`)
+	fs.StringVar(&f.Tokenizer, "tokenizer", "chars", fmt.Sprintf("approximation of a model's "+
+		"tokenizer counting the tokens of tool definitions for token budgets: one of %v", tokenCounterNames()))
+	fs.StringVar(&f.Context, "context", "", "how a conversation's earlier turns weigh into its query vector: "+
+		"none or turns=2,decay=0.5,assistant=0.5 (see conversation.go)")
+	fs.StringVar(&f.Rewrite, "rewrite", "", "how queries are rewritten before they're embedded: "+
+		"synonyms[:file], stopwords & model:aoai|scripted[:file] joined by + (see rewrite.go)")
+	fs.IntVar(&f.K, "k", k, "number of tools returned per prompt")
+	fs.Float64Var(&f.MinScore, "min-score", 0, "minimum score of a returned tool")
+	return f
+}
+
+// flagSet returns true if the named flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// setup selects the embedder & output format, parses the searcher's stages into f.search and returns the index
+// & query options the flags specify.
+func (f *selectionFlags) setup() (*indexOptions, QueryOptions, error) {
+	if err := setEmbedder(f.Embedder); err != nil {
+		return nil, QueryOptions{}, err
+	}
+	if _, ok := distanceMetrics[f.Metric]; !ok {
+		return nil, QueryOptions{}, fmt.Errorf("unknown metric %q; expected one of %v", f.Metric, distanceMetricNames())
+	}
+	if f.Format != "text" && f.Format != "md" {
+		return nil, QueryOptions{}, fmt.Errorf("unknown format %q; expected text or md", f.Format)
+	}
+	if _, err := lookupTokenCounter(f.Tokenizer); err != nil {
+		return nil, QueryOptions{}, err
+	}
+	turnWeights, err := parseContextWeights(f.Context)
+	if err != nil {
+		return nil, QueryOptions{}, err
+	}
+	conversationContext = turnWeights
+	if queryRewriters, err = parseRewriters(f.Rewrite); err != nil {
+		return nil, QueryOptions{}, err
+	}
+	outputFormat = f.Format
+	io, err := parseIndexOptions(f.Document, f.Vectors, f.Examples)
+	if err != nil {
+		return nil, QueryOptions{}, err
+	}
+	aggregation, weights, err := parseAggregation(f.Aggregation)
+	if err != nil {
+		return nil, QueryOptions{}, err
+	}
+	predicate, err := compileFilter(f.Filter)
+	if err != nil {
+		return nil, QueryOptions{}, err
+	}
+	if f.search, err = f.searchFlags.parse(); err != nil {
+		return nil, QueryOptions{}, err
+	}
+	return io, QueryOptions{TopK: f.K, MinimumScore: float32(f.MinScore), Predicate: predicate, Aggregation: aggregation,
+		Weights: weights}, nil
+}
+
+// loadOrBuildIndex returns the tools & a DB of them along with the index's calibration (nil if there's none).
+// If f.Index exists, the DB is loaded from it & brought up to date with the tools, re-embedding only added
+// or changed tools (& saving the index if any were); otherwise the tools are embedded & saved to f.Index if set.
+func (f *selectionFlags) loadOrBuildIndex(io *indexOptions) ([]mcp.Tool, *VectorDB, *calibration) {
+	tools := loadToolsFromJSON(f.Tools)
+	if _, err := os.Stat(f.Index); f.Index == "" || err != nil {
+		db := NewVectorDB(distanceMetrics[f.Metric], nil)
+		if err := tools2DB(db, tools, io); err != nil {
+			log.Fatalf("Failed to embed the tools: %v", err)
+		}
+		if f.Index != "" {
+			must(0, saveIndex(f.Index, db, io, nil))
+		}
+		return tools, db, nil
+	}
+
+	saved, err := loadIndex(f.Index)
+	if err == nil {
+		err = saved.Check(io, f.Metric)
+	}
+	if err != nil {
+		log.Fatalf("%v; delete it to rebuild it", err)
+	}
+	db, previous := saved.DB(), map[ID]bool{}
+	for _, e := range saved.Entries {
+		previous[e.ID] = true
+	}
+	stats, err := reindexTools(db, io, previous, tools)
+	if err != nil {
+		log.Fatalf("Failed to update index %s: %v", f.Index, err)
+	}
+	if stats.Added+stats.Changed+stats.Removed > 0 {
+		log.Printf("Updated index %s: %d tools added, %d changed, %d removed", f.Index, stats.Added, stats.Changed, stats.Removed)
+		must(0, saveIndex(f.Index, db, io, saved.Calibration))
+	}
+	return tools, db, saved.Calibration
+}
+
+// runIndex embeds the tools & saves them to an index file, replacing it (& any calibration in it).
+func runIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	f := addSelectionFlags(fs, 0)
+	must(0, fs.Parse(args))
+	f.Index = cmp.Or(f.Index, "index.json")
+	io, _, err := f.setup()
+	if err != nil {
+		log.Fatalf("index: %v", err)
+	}
+	start := time.Now()
+	db := NewVectorDB(distanceMetrics[f.Metric], nil)
+	if err := tools2DB(db, loadToolsFromJSON(f.Tools), io); err != nil {
+		log.Fatalf("index: %v", err)
+	}
+	if err := saveIndex(f.Index, db, io, nil); err != nil {
+		log.Fatalf("index: %v", err)
+	}
+	fmt.Printf("Indexed %d tools into %s, Execution time=%v\n", getAllTools(db), f.Index, time.Since(start))
+}
+
+// runQuery ranks the tools for the prompt given by the arguments after the flags.
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	f := addSelectionFlags(fs, 5)
+	budget := fs.Int("budget", 0, "if > 0, return the best tools whose definitions fit in this many tokens (at most -k "+
+		"of them if it's set) instead of the top k")
+	conversation := fs.String("conversation", "", "JSON file of the conversation's turns before the prompt, "+
+		`[{"role": "user", "content": "..."}, ...]`)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: query [flags] prompt...\n")
+		fs.PrintDefaults()
+	}
+	must(0, fs.Parse(args))
+	prompt := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(prompt) == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("query: %v", err)
+	}
+	turns := []conversationTurn(nil)
+	if *conversation != "" {
+		if turns, err = loadConversation(*conversation); err != nil {
+			log.Fatalf("query: %v", err)
+		}
+	}
+	tools, db, cal := f.loadOrBuildIndex(io)
+	s, text := f.search.build(db, tools, io), conversationContext.Text(turns, prompt)
+	if err := cal.Check(s); err != nil {
+		log.Fatalf("query: %v", err)
+	}
+	vector, err := embedInContext(turns, prompt)
+	if err != nil {
+		log.Fatalf("query: %v", err)
+	}
+	var results []QueryResult
+	var confidences []float64
+	if *budget > 0 {
+		if !flagSet(fs, "k") {
+			o.TopK = 0
+		}
+		results, confidences = cal.budgetSearch(s, db, text, vector, o, *budget, tokenCounters[f.Tokenizer])
+	} else {
+		results, confidences = cal.Search(s, db, text, vector, o)
+	}
+
+	if isMarkdownOutput() {
+		fmt.Printf("**Prompt:** %s  \n\n", prompt)
+		fmt.Println("| Rank | Score | Confidence | Tool | Description |")
+		fmt.Println("|------|-------|------------|------|-------------|")
+	} else {
+		fmt.Printf("Prompt: %s\n", prompt)
+	}
+	for i, qr := range results {
+		confidence := "-"
+		if confidences != nil {
+			confidence = fmt.Sprintf("%.1f%%", confidences[i]*100)
+		}
+		description := "" // Just the first sentence
+		if t, ok := qr.Entry.Metadata.(*mcp.Tool); ok && t.Description != nil {
+			description, _, _ = strings.Cut(*t.Description, ". ")
+		}
+		if isMarkdownOutput() {
+			fmt.Printf("| %d | %.6f | %s | `%s` | %s |\n", i+1, qr.Score, confidence, qr.Entry.ID, strings.TrimSpace(description))
+		} else {
+			fmt.Printf("   %2d. %f %6s   %-50s %s\n", i+1, qr.Score, confidence, qr.Entry.ID, strings.TrimSpace(description))
+		}
+	}
+	if len(results) == 0 {
+		fmt.Println("No tools found; no tool fits the prompt.")
+	}
+}
+
+// runServe runs one of the servers: "serve find-tools [flags]" or "serve proxy [flags]" (MCP servers over stdio)
+// or "serve http [flags]" (a JSON service).
+func runServe(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "find-tools":
+			runFindToolsServer(args[1:])
+			return
+		case "proxy":
+			runProxy(args[1:])
+			return
+		case "http":
+			runHTTPServer(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: serve find-tools|proxy|http [flags]\n")
+	os.Exit(2)
+}
+
+func runCompareDocuments(args []string) {
+	fs := flag.NewFlagSet("compare-documents", flag.ExitOnError)
+	f := addSelectionFlags(fs, 10)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts")
+	must(0, fs.Parse(args))
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("compare-documents: %v", err)
+	}
+	compareDocumentBuilders(loadToolsFromJSON(f.Tools), loadPromptsFromJSON(*prompts), distanceMetrics[f.Metric], io, o)
+}
+
+func runCompareFusion(args []string) {
+	fs := flag.NewFlagSet("compare-fusion", flag.ExitOnError)
+	f := addSelectionFlags(fs, 10)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts")
+	must(0, fs.Parse(args))
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("compare-fusion: %v", err)
+	}
+	compareFusion(loadToolsFromJSON(f.Tools), loadPromptsFromJSON(*prompts), distanceMetrics[f.Metric], io, o)
+}
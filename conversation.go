@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// An agent's latest message often depends on earlier turns ("now delete it"), so embedding it alone loses what
+// "it" is. A conversation query's vector is instead the weighted sum of the normalized embeddings of the latest
+// message & its recent turns, the weights decaying with each turn back.
+
+// conversationTurn is an earlier message of a conversation, like an mcp.SamplingMessage with text content.
+type conversationTurn struct {
+	Role    mcp.Role `json:"role"`    // user or assistant
+	Content string   `json:"content"` // The text; an mcp.TextContent is accepted too
+}
+
+// UnmarshalJSON accepts the content as a string or, as in an mcp.SamplingMessage, a text content block.
+func (t *conversationTurn) UnmarshalJSON(data []byte) error {
+	turn := struct {
+		Role    mcp.Role        `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}{}
+	if err := json.Unmarshal(data, &turn); err != nil {
+		return err
+	}
+	if turn.Role != mcp.RoleUser && turn.Role != mcp.RoleAssistant {
+		return fmt.Errorf("unknown conversation role %q; expected user or assistant", turn.Role)
+	}
+	t.Role = turn.Role
+	if err := json.Unmarshal(turn.Content, &t.Content); err == nil {
+		return nil
+	}
+	text := mcp.TextContent{}
+	if err := json.Unmarshal(turn.Content, &text); err != nil || text.Type != "text" {
+		return fmt.Errorf("a conversation turn's content must be a string or text content")
+	}
+	t.Content = text.Text
+	return nil
+}
+
+// contextWeights weighs a conversation's earlier turns into its query vector; see parseContextWeights.
+type contextWeights struct {
+	Turns     int     // The number of earlier turns considered; 0 embeds the latest message alone
+	Decay     float32 // The weight of the turn before the latest message; each turn back is weighed Decay times less
+	Assistant float32 // Multiplies the weight of the assistant's turns
+}
+
+// conversationContext weighs the earlier turns of every conversation query & test case; see
+// selectionFlags.setup.
+var conversationContext = contextWeights{Turns: 2, Decay: 0.5, Assistant: 0.5}
+
+// parseContextWeights parses "none" (the latest message alone) or "name=value,..." where the names are turns
+// (default 2), decay (default 0.5) & assistant (default 0.5); "" is the defaults.
+func parseContextWeights(spec string) (contextWeights, error) {
+	w := contextWeights{Turns: 2, Decay: 0.5, Assistant: 0.5}
+	if spec == "none" {
+		return contextWeights{}, nil
+	}
+	for _, p := range strings.Split(spec, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil || f < 0 {
+			return contextWeights{}, fmt.Errorf("invalid context %s %q", name, value)
+		}
+		switch name {
+		case "turns":
+			w.Turns = int(f)
+		case "decay":
+			w.Decay = float32(f)
+		case "assistant":
+			w.Assistant = float32(f)
+		default:
+			return contextWeights{}, fmt.Errorf("unknown context parameter %q; expected turns, decay or assistant", name)
+		}
+	}
+	return w, nil
+}
+
+// Vector returns the query vector of the latest message (whose embedding is vector) following turns (oldest
+// first): vector alone if there are no turns to weigh in, otherwise the normalized weighted sum of the
+// normalized embeddings of the message (weight 1) & its last w.Turns turns (Decay, Decay², ...). It fails if
+// a turn can't be embedded.
+func (w contextWeights) Vector(turns []conversationTurn, vector []float32) ([]float32, error) {
+	if w.Turns == 0 || w.Decay == 0 || len(turns) == 0 {
+		return vector, nil
+	}
+	sum := make([]float32, len(vector))
+	add := func(v []float32, weight float32) {
+		norm := magnitude(v)
+		if norm == 0 || weight == 0 {
+			return
+		}
+		for i := range sum {
+			sum[i] += v[i] * weight / norm
+		}
+	}
+	add(vector, 1)
+	weight := float32(1)
+	for i := len(turns) - 1; i >= max(len(turns)-w.Turns, 0); i-- {
+		weight *= w.Decay
+		v, err := createEmbeddings(turns[i].Content)
+		if err != nil {
+			return nil, err
+		}
+		if turns[i].Role == mcp.RoleAssistant {
+			add(v, weight*w.Assistant)
+		} else {
+			add(v, weight)
+		}
+	}
+	norm := magnitude(sum)
+	if norm == 0 {
+		return vector, nil
+	}
+	for i := range sum {
+		sum[i] /= norm
+	}
+	return sum, nil
+}
+
+// Text returns the text of the latest message, prompt, following turns for the stages searching by text
+// (lexical search & reranking): the contents of the turns Vector weighs in & then the prompt, one per line.
+// The stages classifying the operation asked for (intent scoring & the safety policies) only consider the
+// latest message (see latestMessage), since an earlier turn's verb ("show me the setting") isn't the one asked for
+// now ("now delete it").
+func (w contextWeights) Text(turns []conversationTurn, prompt string) string {
+	lines := []string{}
+	if w.Turns > 0 && w.Decay > 0 {
+		for _, t := range turns[max(len(turns)-w.Turns, 0):] {
+			lines = append(lines, strings.Join(strings.Fields(t.Content), " "))
+		}
+	}
+	return strings.Join(append(lines, strings.Join(strings.Fields(prompt), " ")), "\n")
+}
+
+// latestMessage returns the last line of a text returned by contextWeights.Text: the latest message.
+func latestMessage(text string) string { return text[strings.LastIndex(text, "\n")+1:] }
+
+func magnitude(v []float32) float32 { return float32(math.Sqrt(float64(DotProduct{}.Distance(v, v)))) }
+
+// Embed returns the query vector of the case's prompt in the context of its conversation, if any.
+func (c *testCase) Embed() ([]float32, error) { return embedInContext(c.Conversation, c.Prompt) }
+
+// embedInContext returns the query vector of prompt following turns (see contextWeights.Vector).
+func embedInContext(turns []conversationTurn, prompt string) ([]float32, error) {
+	vector, err := embedQuery(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return conversationContext.Vector(turns, vector)
+}
+
+// Query returns the text searched for the case's prompt in the context of its conversation, if any.
+func (c *testCase) Query() string { return conversationContext.Text(c.Conversation, c.Prompt) }
+
+// loadConversation loads a JSON array of conversation turns (oldest first).
+func loadConversation(filename string) ([]conversationTurn, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	turns := []conversationTurn{}
+	if err := json.Unmarshal(data, &turns); err != nil {
+		return nil, fmt.Errorf("invalid conversation in %s: %w", filename, err)
+	}
+	return turns, nil
+}
+
+// reportConversations reports the accuracy of the cases with a conversation (the context-dependent prompts)
+// embedded alone & in context, along with the accuracy of the other cases.
+func reportConversations(s searcher, testCases []testCase, o QueryOptions) {
+	start := time.Now()
+	alone, inContext, others := []promptCase{}, []promptCase{}, []promptCase{}
+	for _, c := range testCases {
+		v := mustEmbed(embedQuery(c.Prompt))
+		if len(c.Conversation) == 0 {
+			others = append(others, promptCase{testCase: c, Vector: v})
+			continue
+		}
+		prompt := c
+		prompt.Conversation = nil // So the text stages search the prompt alone too
+		alone = append(alone, promptCase{testCase: prompt, Vector: v})
+		inContext = append(inContext, promptCase{testCase: c, Vector: mustEmbed(conversationContext.Vector(c.Conversation, v))})
+	}
+	rows := []struct {
+		name string
+		m    evalMetrics
+	}{
+		{"Context-dependent, prompt alone", evaluateCases(s, alone, o)},
+		{"Context-dependent, in context", evaluateCases(s, inContext, o)},
+		{"Other prompts", evaluateCases(s, others, o)},
+	}
+	weights := fmt.Sprintf("turns=%d, decay=%g, assistant=%g", conversationContext.Turns, conversationContext.Decay,
+		conversationContext.Assistant)
+	if conversationContext.Turns == 0 || conversationContext.Decay == 0 {
+		weights = "none"
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Conversation Context")
+		fmt.Println()
+		fmt.Printf("**Context:** %s  \n", weights)
+		fmt.Println()
+		fmt.Println("| Prompts | Count | Accuracy (top 1) | Recall@3 | MRR | Pass Rate |")
+		fmt.Println("|---------|-------|------------------|----------|-----|-----------|")
+		for _, r := range rows {
+			fmt.Printf("| %s | %d | %.1f%% | %.1f%% | %.3f | %.1f%% |\n", r.name, r.m.Prompts, r.m.Accuracy(), r.m.Recall3(),
+				r.m.MRR(), r.m.PassRate())
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nConversation context: %s\n", weights)
+		fmt.Printf("   %-32s %6s %8s %8s %6s %8s\n", "Prompts", "Count", "Top1", "Top3", "MRR", "Passed")
+		for _, r := range rows {
+			fmt.Printf("   %-32s %6d %7.1f%% %7.1f%% %6.3f %7.1f%%\n", r.name, r.m.Prompts, r.m.Accuracy(), r.m.Recall3(),
+				r.m.MRR(), r.m.PassRate())
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
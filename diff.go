@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// diff compares two versions of the tools (e.g. before & after editing descriptions): which tools were
+// added, removed or changed, and how selection for the test prompts changed. The new version's DB starts
+// as a copy of the old one's so only the added & changed tools are embedded again.
+
+// toolChange is how a tool differs between the old & new versions.
+type toolChange struct {
+	ID     ID
+	Change string // added, removed, embedded text changed or metadata changed
+}
+
+// diffTools returns the changes from the old tools to the new ones, sorted by ID.
+func diffTools(o *indexOptions, oldTools, newTools []mcp.Tool) []toolChange {
+	old := map[ID]*mcp.Tool{}
+	for i := range oldTools {
+		old[entryID(&oldTools[i])] = &oldTools[i]
+	}
+	changes := []toolChange{}
+	for i := range newTools {
+		t := &newTools[i]
+		id := entryID(t)
+		before, ok := old[id]
+		delete(old, id)
+		switch {
+		case !ok:
+			changes = append(changes, toolChange{ID: id, Change: "added"})
+		case !sameDocuments(o, before, t):
+			changes = append(changes, toolChange{ID: id, Change: "embedded text changed"})
+		case !sameTool(before, t):
+			changes = append(changes, toolChange{ID: id, Change: "metadata changed"})
+		}
+	}
+	for id := range old {
+		changes = append(changes, toolChange{ID: id, Change: "removed"})
+	}
+	slices.SortFunc(changes, func(a, b toolChange) int { return cmp.Compare(a.ID, b.ID) })
+	return changes
+}
+
+// cloneDB returns a new DB with the same metric & entries as db; upserting into or deleting from one doesn't
+// affect the other.
+func cloneDB(db *VectorDB) *VectorDB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return NewVectorDB(db.distanceMetric, slices.Clone(db.entries))
+}
+
+// runDiff reports the tool changes from "diff [flags] old-tools.json new-tools.json" & the test prompts whose
+// outcome or expected tool's rank changed, with the metrics of both versions.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	f := addSelectionFlags(fs, 10)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts (v1 or v2 format)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: diff [flags] old-tools.json new-tools.json\n")
+		fs.PrintDefaults()
+	}
+	must(0, fs.Parse(args))
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f.Tools = fs.Arg(0) // -index, if given, caches the old version's vectors
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("diff: %v", err)
+	}
+
+	start := time.Now()
+	oldTools, oldDB, _ := f.loadOrBuildIndex(io)
+	newTools, newDB := loadToolsFromJSON(fs.Arg(1)), cloneDB(oldDB)
+	previous := map[ID]bool{}
+	for i := range oldTools {
+		previous[entryID(&oldTools[i])] = true
+	}
+	if _, err := reindexTools(newDB, io, previous, newTools); err != nil {
+		log.Fatalf("diff: %v", err)
+	}
+	cases := embedPromptCases(loadPromptsFromJSON(*prompts))
+	oldSearcher, newSearcher := f.search.build(oldDB, oldTools, io), f.search.build(newDB, newTools, io)
+	if err := checkIntentExamples(oldSearcher, *prompts); err != nil {
+		log.Fatalf("diff: %v", err)
+	}
+	reportToolDiff("# Tool Diff", fs.Arg(0), fs.Arg(1), diffTools(io, oldTools, newTools), len(oldTools), len(newTools),
+		oldSearcher, newSearcher, cases, o, start)
+}
+
+// reportToolDiff reports the tool changes & the cases whose outcome or expected tool's rank changed from the old
+// searcher to the new one, with the metrics of both versions; heading titles the markdown output.
+func reportToolDiff(heading, oldName, newName string, changes []toolChange, oldCount, newCount int, oldSearcher,
+	newSearcher searcher, cases []promptCase, o QueryOptions, start time.Time) {
+	type caseChange struct {
+		ID, Prompt, Expected string
+		OldRank, NewRank     int // 0 if no acceptable tool was in the top K
+		OldPassed, NewPassed bool
+	}
+	caseChanges := []caseChange{}
+	for _, c := range cases {
+		oldResults, newResults := oldSearcher.Search(c.Query(), c.Vector, o), newSearcher.Search(c.Query(), c.Vector, o)
+		cc := caseChange{ID: c.ID, Prompt: c.Prompt, Expected: c.ExpectedString(),
+			OldRank: expectedRank(oldResults, &c.testCase), NewRank: expectedRank(newResults, &c.testCase),
+			OldPassed: c.Passed(oldResults), NewPassed: c.Passed(newResults)}
+		if cc.OldRank != cc.NewRank || cc.OldPassed != cc.NewPassed {
+			caseChanges = append(caseChanges, cc)
+		}
+	}
+	before, after := evaluateCases(oldSearcher, cases, o), evaluateCases(newSearcher, cases, o)
+	rank := func(r int) string {
+		if r == 0 {
+			return "-"
+		}
+		return fmt.Sprint(r)
+	}
+	passed := func(p bool) string {
+		if p {
+			return "passed"
+		}
+		return "failed"
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println(heading)
+		fmt.Println()
+		fmt.Printf("**Old tools:** %s (%d)  \n", oldName, oldCount)
+		fmt.Printf("**New tools:** %s (%d)  \n", newName, newCount)
+		fmt.Println()
+		if len(changes) > 0 {
+			fmt.Println("| Tool | Change |")
+			fmt.Println("|------|--------|")
+			for _, c := range changes {
+				fmt.Printf("| `%s` | %s |\n", c.ID, c.Change)
+			}
+			fmt.Println()
+		}
+		fmt.Println("| Version | Accuracy (top 1) | Recall (top 3) | MRR | Pass Rate |")
+		fmt.Println("|---------|------------------|----------------|-----|-----------|")
+		fmt.Printf("| Old | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("| New | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		fmt.Println()
+		if len(caseChanges) > 0 {
+			fmt.Println("| Case | Expected Tool | Prompt | Old Rank | New Rank | Old | New |")
+			fmt.Println("|------|---------------|--------|----------|----------|-----|-----|")
+			for _, cc := range caseChanges {
+				fmt.Printf("| %s | `%s` | %s | %s | %s | %s | %s |\n", cc.ID, cc.Expected, cc.Prompt,
+					rank(cc.OldRank), rank(cc.NewRank), passed(cc.OldPassed), passed(cc.NewPassed))
+			}
+			fmt.Println()
+		}
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("Old tools=%s (%d), New tools=%s (%d)\n", oldName, oldCount, newName, newCount)
+		for _, c := range changes {
+			fmt.Printf("   %-50s %s\n", c.ID, c.Change)
+		}
+		fmt.Printf("\n   %-8s %9s %9s %8s %9s\n", "Version", "Top1", "Top3", "MRR", "Passed")
+		fmt.Printf("   %-8s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "Old", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("   %-8s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "New", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		for _, cc := range caseChanges {
+			fmt.Printf("\n   Case %s: expected %s, rank %s -> %s, %s -> %s\n      Prompt: %s\n", cc.ID, cc.Expected,
+				rank(cc.OldRank), rank(cc.NewRank), passed(cc.OldPassed), passed(cc.NewPassed), cc.Prompt)
+		}
+		fmt.Printf("\nChanged cases=%d, Execution time=%v\n", len(caseChanges), time.Since(start))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A documentBuilder composes the text of a tool that gets embedded into its vector. Each builder is a
+// text/template executed against a toolDocument; builtinDocumentBuilders holds the built-in strategies.
+
+type documentBuilder struct {
+	Name     string // A built-in builder's name or, for a custom template, "custom:" & the digest of its text
+	template *template.Template
+}
+
+// toolDocument is the data a documentBuilder's template is executed against.
+type toolDocument struct {
+	Name        string // e.g. "azmcp-appconfig-kv-list"
+	NameWords   string // e.g. "appconfig kv list" (the "azmcp-" prefix removed, "-" replaced by spaces)
+	Title       string // The tool's title or, if it has none, its annotations' title
+	Description string
+	Parameters  []toolParameter // From inputSchema's properties, sorted by name
+	Hints       []string        // The annotation hints that are true: "read-only", "destructive", "idempotent", "open-world"
+}
+
+type toolParameter struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// RequiredParameters returns just the required parameters; common optional ones (tenant, retry-*, ...) are mostly noise.
+func (d *toolDocument) RequiredParameters() []toolParameter {
+	return slices.DeleteFunc(slices.Clone(d.Parameters), func(p toolParameter) bool { return !p.Required })
+}
+
+const defaultDocumentBuilder = "description"
+
+var builtinDocumentBuilders = map[string]*documentBuilder{
+	"description": mustDocumentBuilder("description", `{{.Description}}`),
+	"name":        mustDocumentBuilder("name", `{{.NameWords}}: {{.Description}}`),
+	"title":       mustDocumentBuilder("title", `{{with .Title}}{{.}}: {{end}}{{.Description}}`),
+	"parameters": mustDocumentBuilder("parameters", `{{.NameWords}}: {{.Description}}`+
+		`{{with .RequiredParameters}} Parameters:{{range .}} {{.Name}} ({{.Description}}){{end}}{{end}}`),
+	"full": mustDocumentBuilder("full", `{{.NameWords}}{{with .Title}} ({{.}}){{end}}: {{.Description}}`+
+		`{{with .RequiredParameters}} Parameters:{{range .}} {{.Name}} ({{.Description}}){{end}}{{end}}`+
+		`{{with .Hints}} Hints: {{join . ", "}}.{{end}}`),
+}
+
+func newDocumentBuilder(name, text string) (*documentBuilder, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &documentBuilder{Name: name, template: t}, nil
+}
+
+func mustDocumentBuilder(name, text string) *documentBuilder {
+	return must(newDocumentBuilder(name, text))
+}
+
+// lookupDocumentBuilder returns the built-in builder with the specified name or, if spec contains "{{",
+// a builder using spec as its template, named after its text so an index records which template composed its
+// vectors. An empty spec returns the default builder.
+func lookupDocumentBuilder(spec string) (*documentBuilder, error) {
+	if spec == "" {
+		spec = defaultDocumentBuilder
+	}
+	if b, ok := builtinDocumentBuilders[spec]; ok {
+		return b, nil
+	}
+	if strings.Contains(spec, "{{") {
+		h := fnv.New64a()
+		h.Write([]byte(spec))
+		b, err := newDocumentBuilder(fmt.Sprintf("custom:%016x", h.Sum64()), spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := b.Build(sampleTool()); err != nil { // Rejects templates referring to unknown fields & the like
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown document builder %q; built-in builders are %v", spec, documentBuilderNames())
+}
+
+// documentBuilderNames returns the names of the built-in builders, sorted.
+func documentBuilderNames() []string { return slices.Sorted(maps.Keys(builtinDocumentBuilders)) }
+
+// Build returns the text to embed for t.
+func (b *documentBuilder) Build(t *mcp.Tool) (string, error) {
+	sb := &strings.Builder{}
+	if err := b.template.Execute(sb, newToolDocument(t)); err != nil {
+		return "", fmt.Errorf("document builder %q: %w", b.Name, err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// sampleTool returns a tool with every field a toolDocument is built from, for trying out a template.
+func sampleTool() *mcp.Tool {
+	title, description, yes := "Sample Tool", "Does something with a sample resource.", true
+	return &mcp.Tool{
+		BaseMetadata: mcp.BaseMetadata{Name: "azmcp-sample-tool", Title: &title},
+		Description:  &description,
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {"resource": {"type": "string", ` +
+			`"description": "The resource's name"}}, "required": ["resource"]}`),
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: &yes},
+	}
+}
+
+func newToolDocument(t *mcp.Tool) *toolDocument {
+	d := &toolDocument{Name: t.Name, NameWords: strings.ReplaceAll(strings.TrimPrefix(t.Name, "azmcp-"), "-", " ")}
+	if t.Description != nil {
+		d.Description = *t.Description
+	}
+	switch {
+	case t.Title != nil:
+		d.Title = *t.Title
+	case t.Annotations != nil && t.Annotations.Title != nil:
+		d.Title = *t.Annotations.Title
+	}
+
+	schema := struct {
+		Properties map[string]struct {
+			Description string `json:"description"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}{}
+	_ = json.Unmarshal(t.InputSchema, &schema) // A malformed schema just contributes no parameters
+	for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+		d.Parameters = append(d.Parameters, toolParameter{Name: name, Description: schema.Properties[name].Description,
+			Required: slices.Contains(schema.Required, name)})
+	}
+
+	if t.Annotations != nil {
+		for _, h := range []struct {
+			name string
+			hint *bool
+		}{{"read-only", t.Annotations.ReadOnlyHint}, {"destructive", t.Annotations.DestructiveHint},
+			{"idempotent", t.Annotations.IdempotentHint}, {"open-world", t.Annotations.OpenWorldHint}} {
+			if h.hint != nil && *h.hint {
+				d.Hints = append(d.Hints, h.name)
+			}
+		}
+	}
+	return d
+}
+
+// indexOptions controls how tools become VectorDB entries: the text embedded into each Entry.Vector and
+// which additional (named) vectors are added to each Entry.Vectors.
+type indexOptions struct {
+	Builder          *documentBuilder
+	NameVector       bool                // Adds a "name" vector embedding the tool's name words
+	ParameterVectors bool                // Adds a "parameter" vector per required parameter ("name: description")
+	Examples         map[string][]string // Tool name or server-qualified ID -> example prompts; each adds an "example" vector
+}
+
+// namedText is text to be embedded into a NamedVector.
+type namedText struct {
+	Name string
+	Text string
+}
+
+// documents returns the text to embed into t's Entry.Vector & the texts to embed into its Entry.Vectors.
+func (o *indexOptions) documents(t *mcp.Tool) (string, []namedText, error) {
+	extras := []namedText{}
+	d := newToolDocument(t)
+	if o.NameVector {
+		extras = append(extras, namedText{Name: "name", Text: d.NameWords})
+	}
+	if o.ParameterVectors {
+		for _, p := range d.RequiredParameters() {
+			extras = append(extras, namedText{Name: "parameter", Text: p.Name + ": " + p.Description})
+		}
+	}
+	examples, ok := o.Examples[string(entryID(t))]
+	if !ok {
+		examples = o.Examples[t.Name]
+	}
+	for _, e := range examples {
+		extras = append(extras, namedText{Name: "example", Text: e})
+	}
+	document, err := o.Builder.Build(t)
+	return document, extras, err
+}
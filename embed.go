@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+)
+
+// An embedder converts text into a vector. All vectors compared with each other must come from the same
+// embedder, so an index records the embedder that built it. An embedder fails (rather than exiting) when the
+// embeddings service does, so the long-running services can report the failure & keep serving.
+type embedder func(input string) ([]float32, error)
+
+var embedders = map[string]embedder{
+	"aoai": aoaiEmbeddings, // Azure OpenAI (AOAI_ENDPOINT & TEXT_EMBEDDING_API_KEY)
+	"hash": hashEmbedder,   // Local & deterministic; for trying things out without an embeddings deployment
+}
+
+// errEmbeddingFailed is wrapped by every error of createEmbeddings, so a caller can tell an embedding failure
+// from its own errors.
+var errEmbeddingFailed = errors.New("embedding failed")
+
+// errEmbedderUnavailable is wrapped by the errors of an embedder that isn't configured or whose service is
+// overloaded or down (as opposed to failing the request), so a caller can tell retrying later may succeed.
+var errEmbedderUnavailable = errors.New("the embeddings service is unavailable")
+
+// embedderName names the embedder createEmbeddings uses; see setEmbedder.
+var embedderName = "aoai"
+
+func embedderNames() []string { return slices.Sorted(maps.Keys(embedders)) }
+
+// setEmbedder selects the embedder createEmbeddings uses.
+func setEmbedder(name string) error {
+	if _, ok := embedders[name]; !ok {
+		return fmt.Errorf("unknown embedder %q; expected one of %v", name, embedderNames())
+	}
+	embedderName = name
+	return nil
+}
+
+func createEmbeddings(input string) ([]float32, error) {
+	vector, err := embedders[embedderName](input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbeddingFailed, err)
+	}
+	return vector, nil
+}
+
+const hashDimensions = 512
+
+// hashEmbedder is the embedder of hashEmbeddings, which never fails.
+func hashEmbedder(input string) ([]float32, error) { return hashEmbeddings(input), nil }
+
+// hashEmbeddings embeds input by feature hashing: each term (see tokenize) & each pair of adjacent terms
+// adds ±1 to a dimension chosen by its hash. The vector is normalized so that texts sharing more
+// words are more similar; it captures no meaning beyond the words themselves.
+func hashEmbeddings(input string) []float32 {
+	vector := make([]float32, hashDimensions)
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vector[sum%hashDimensions] += sign
+	}
+	tokens := tokenize(input)
+	for i, t := range tokens {
+		add(t)
+		if i > 0 {
+			add(tokens[i-1] + " " + t)
+		}
+	}
+	norm := 0.0
+	for _, v := range vector {
+		norm += float64(v * v)
+	}
+	if norm > 0 {
+		for i := range vector {
+			vector[i] /= float32(math.Sqrt(norm))
+		}
+	}
+	return vector
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// promptCase is a test case & its prompt's embedding.
+type promptCase struct {
+	testCase
+	Vector []float32
+}
+
+// embedPromptCases embeds every prompt (in the context of its conversation) once so that several configurations can be evaluated against the
+// same prompts without re-embedding them.
+func embedPromptCases(cases []testCase) []promptCase {
+	embedded := make([]promptCase, len(cases))
+	for i, c := range cases {
+		embedded[i] = promptCase{testCase: c, Vector: mustEmbed(c.Embed())}
+	}
+	return embedded
+}
+
+// mustEmbed returns the embedding v unless err is set, in which case it exits with the error: an evaluation
+// can't go on without its prompts' embeddings, & an embedding failure isn't a bug to panic on.
+func mustEmbed(v []float32, err error) []float32 {
+	if err != nil {
+		log.Fatalf("Failed to embed a prompt: %v", err)
+	}
+	return v
+}
+
+// evalMetrics summarizes how well a configuration selected the expected tools. The rank metrics consider
+// only positive cases (those expecting a tool); Passed considers every expectation of every case.
+type evalMetrics struct {
+	Prompts           int
+	Passed            int     // Cases meeting all their expectations (see testCase.Passed)
+	Positives         int     // Cases expecting a tool
+	Top1              int     // Positive cases with an acceptable tool ranked #1
+	Top3              int     // Positive cases with an acceptable tool ranked in the top 3
+	ReciprocalRankSum float64 // Sum of 1/rank of the best-ranked acceptable tool (0 if none was in the top 10)
+}
+
+func (m evalMetrics) PassRate() float64 { return percent(m.Passed, m.Prompts) }
+func (m evalMetrics) Accuracy() float64 { return percent(m.Top1, m.Positives) }
+func (m evalMetrics) Recall3() float64  { return percent(m.Top3, m.Positives) }
+func (m evalMetrics) MRR() float64 {
+	if m.Positives == 0 {
+		return 0
+	}
+	return m.ReciprocalRankSum / float64(m.Positives)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// expectedRank returns the 1-based rank of the best-ranked acceptable tool in results or 0 if none is there.
+func expectedRank(results []QueryResult, c *testCase) int {
+	for i, qr := range results {
+		if c.Accepts(qr.Entry) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// evaluateCases searches (using o; a TopK of 0 is 10) for each case & measures where the expected tool ranks.
+func evaluateCases(s searcher, cases []promptCase, o QueryOptions) evalMetrics {
+	o.TopK = cmp.Or(o.TopK, 10)
+	m := evalMetrics{}
+	for _, c := range cases {
+		m.Prompts++
+		results := s.Search(c.Query(), c.Vector, o)
+		if c.Passed(results) {
+			m.Passed++
+		}
+		if c.IsNegative() {
+			continue
+		}
+		m.Positives++
+		rank := expectedRank(results, &c.testCase)
+		if rank == 1 {
+			m.Top1++
+		}
+		if rank >= 1 && rank <= 3 {
+			m.Top3++
+		}
+		if rank > 0 {
+			m.ReciprocalRankSum += 1 / float64(rank)
+		}
+	}
+	return m
+}
+
+// compareDocumentBuilders indexes the tools (by metric, with io's additional vectors) once per built-in document
+// builder & io's custom template (if any), runs all the prompts against each index & reports which composition of
+// the embedded text selects tools best.
+func compareDocumentBuilders(tools []mcp.Tool, testCases []testCase, metric DistanceMetric, io *indexOptions, o QueryOptions) {
+	start := time.Now()
+	cases := embedPromptCases(testCases)
+	useMarkdown := isMarkdownOutput()
+
+	type row struct {
+		builder string
+		metrics evalMetrics
+	}
+	rows := []row{}
+	builders := []*documentBuilder{}
+	for _, name := range documentBuilderNames() {
+		builders = append(builders, builtinDocumentBuilders[name])
+	}
+	if builtinDocumentBuilders[io.Builder.Name] != io.Builder {
+		builders = append(builders, io.Builder)
+	}
+	for _, b := range builders {
+		db, bo := NewVectorDB(metric, nil), *io
+		bo.Builder = b
+		if err := tools2DB(db, tools, &bo); err != nil {
+			log.Fatalf("Failed to embed the tools: %v", err)
+		}
+		rows = append(rows, row{builder: b.Name, metrics: evaluateCases(vectorSearcher{db: db}, cases, o)})
+	}
+	slices.SortStableFunc(rows, func(a, b row) int { // Best first: by accuracy, then MRR
+		if a.metrics.Top1 != b.metrics.Top1 {
+			return b.metrics.Top1 - a.metrics.Top1
+		}
+		return cmp.Compare(b.metrics.MRR(), a.metrics.MRR())
+	})
+
+	if useMarkdown {
+		fmt.Println("# Document Builder Comparison")
+		fmt.Println()
+		fmt.Printf("**Tools:** %d  \n", len(tools))
+		fmt.Printf("**Prompts:** %d  \n", len(cases))
+		fmt.Println()
+		fmt.Println("| Builder | Accuracy (top 1) | Recall (top 3) | MRR | Pass Rate |")
+		fmt.Println("|---------|------------------|----------------|-----|-----------|")
+		for _, r := range rows {
+			fmt.Printf("| `%s` | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", r.builder, r.metrics.Accuracy(), r.metrics.Recall3(), r.metrics.MRR(), r.metrics.PassRate())
+		}
+		fmt.Println()
+		fmt.Printf("**Winner:** `%s`  \n", rows[0].builder)
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("Tool count=%d, Prompt count=%d\n\n", len(tools), len(cases))
+		fmt.Printf("   %-23s %9s %9s %8s %9s\n", "Builder", "Top1", "Top3", "MRR", "Passed")
+		for _, r := range rows {
+			fmt.Printf("   %-23s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", r.builder, r.metrics.Accuracy(), r.metrics.Recall3(), r.metrics.MRR(), r.metrics.PassRate())
+		}
+		fmt.Printf("\nWinner=%s, Execution time=%v\n", rows[0].builder, time.Since(start))
+	}
+}
+
+// compareFusion evaluates vector-only & lexical-only selection and hybrid selection over a sweep of
+// fusion parameters (with the tools indexed by metric), reporting them best first.
+func compareFusion(tools []mcp.Tool, testCases []testCase, metric DistanceMetric, io *indexOptions, o QueryOptions) {
+	start := time.Now()
+	cases := embedPromptCases(testCases)
+	db := NewVectorDB(metric, nil)
+	if err := tools2DB(db, tools, io); err != nil {
+		log.Fatalf("Failed to embed the tools: %v", err)
+	}
+	lexical := bm25FromTools(tools, io, defaultFusionOptions.K1, defaultFusionOptions.B)
+
+	type row struct {
+		name    string
+		metrics evalMetrics
+	}
+	rows := []row{{name: "vector only", metrics: evaluateCases(vectorSearcher{db: db}, cases, o)}}
+	configs := []fusionOptions{{Method: fuseWeightedScores, LexicalWeight: 1}} // Lexical only
+	for _, k := range []float64{10, 30, 60} {
+		for _, w := range []float64{0.3, 0.5, 0.7} {
+			configs = append(configs, fusionOptions{Method: fuseReciprocalRank, RRFK: k, LexicalWeight: w})
+		}
+	}
+	for _, w := range []float64{0.1, 0.2, 0.3, 0.4, 0.5} {
+		configs = append(configs, fusionOptions{Method: fuseWeightedScores, LexicalWeight: w})
+	}
+	for _, f := range configs {
+		name := f.String()
+		if f.Method == fuseWeightedScores && f.LexicalWeight == 1 {
+			name = "lexical only"
+		}
+		rows = append(rows, row{name: name, metrics: evaluateCases(&hybridSearcher{db: db, lexical: lexical, fusion: f}, cases, o)})
+	}
+	slices.SortStableFunc(rows, func(a, b row) int { // Best first: by accuracy, then MRR
+		if a.metrics.Top1 != b.metrics.Top1 {
+			return b.metrics.Top1 - a.metrics.Top1
+		}
+		return cmp.Compare(b.metrics.MRR(), a.metrics.MRR())
+	})
+
+	if isMarkdownOutput() {
+		fmt.Println("# Hybrid Fusion Comparison")
+		fmt.Println()
+		fmt.Printf("**Tools:** %d  \n", len(tools))
+		fmt.Printf("**Prompts:** %d  \n", len(cases))
+		fmt.Println()
+		fmt.Println("| Configuration | Accuracy (top 1) | Recall (top 3) | MRR | Pass Rate |")
+		fmt.Println("|---------------|------------------|----------------|-----|-----------|")
+		for _, r := range rows {
+			fmt.Printf("| `%s` | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", r.name, r.metrics.Accuracy(), r.metrics.Recall3(), r.metrics.MRR(), r.metrics.PassRate())
+		}
+		fmt.Println()
+		fmt.Printf("**Winner:** `%s`  \n", rows[0].name)
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("Tool count=%d, Prompt count=%d\n\n", len(tools), len(cases))
+		fmt.Printf("   %-24s %9s %9s %8s %9s\n", "Configuration", "Top1", "Top3", "MRR", "Passed")
+		for _, r := range rows {
+			fmt.Printf("   %-24s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", r.name, r.metrics.Accuracy(), r.metrics.Recall3(), r.metrics.MRR(), r.metrics.PassRate())
+		}
+		fmt.Printf("\nWinner=%s, Execution time=%v\n", rows[0].name, time.Since(start))
+	}
+}
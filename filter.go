@@ -0,0 +1,406 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A filter expression selects tools by their fields, e.g.
+//   annotations.readOnlyHint == true && server == "azmcp" && name startsWith "azmcp-storage"
+// Unlike a QueryOptions.Predicate (a Go closure), it can be given on the command line, to the
+// find_tools tool & in HTTP queries. Its grammar is:
+//   expr       = and { "||" and }
+//   and        = unary { "&&" unary }
+//   unary      = "!" unary | "(" expr ")" | comparison
+//   comparison = field [ op value ]    A field alone means field == true
+//   op         = "==" | "!=" | "<" | "<=" | ">" | ">=" | "startsWith" | "endsWith" | "contains" | "matches" | "in"
+//   value      = string | number | "true" | "false" | "null" | "[" [ value { "," value } ] "]"
+// A field is id, server (see entryID & toolServer) or a dotted path into the tool's JSON: name, description,
+// annotations.destructiveHint, inputSchema.required, _meta.x, ... Missing annotation hints have the MCP spec's
+// defaults & other missing fields are null. Strings are Go-quoted; matches takes a regular expression &
+// contains tests for a substring of a string or an element of an array.
+
+// compileFilter returns the predicate accepting the tools expr selects; it returns nil (accept everything) if
+// expr is blank.
+func compileFilter(expr string) (func(e *Entry) bool, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	p := &filterParser{tokens: tokens}
+	n, err := p.parseOr()
+	if err == nil && p.peek().kind != filterEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return func(e *Entry) bool {
+		t, ok := e.Metadata.(*mcp.Tool)
+		return ok && n.eval(&filterTool{Tool: t})
+	}, nil
+}
+
+// andPredicates returns a predicate accepting the entries that all the non-nil predicates accept; it returns
+// nil if they're all nil.
+func andPredicates(predicates ...func(e *Entry) bool) func(e *Entry) bool {
+	predicates = slices.DeleteFunc(predicates, func(p func(e *Entry) bool) bool { return p == nil })
+	if len(predicates) == 0 {
+		return nil
+	}
+	return func(e *Entry) bool {
+		for _, p := range predicates {
+			if !p(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// filterTool is a tool a filter is evaluated against. The common fields are read from the tool; the tool's JSON
+// is decoded for the others, at most once per evaluation however many fields the filter tests.
+type filterTool struct {
+	*mcp.Tool
+	json    any // The tool's JSON, once decoded
+	decoded bool
+}
+
+// field returns the value of the field at path: a string, float64, bool, nil, []any or map[string]any.
+func (t *filterTool) field(path []string) any {
+	switch field := strings.Join(path, "."); field {
+	case "id":
+		return string(entryID(t.Tool))
+	case "server":
+		return toolServer(t.Tool)
+	case "name":
+		return t.Name
+	case "description", "title":
+		s := map[string]*string{"description": t.Description, "title": t.Title}[field]
+		if s == nil {
+			return nil
+		}
+		return *s
+	case "annotations.readOnlyHint", "annotations.destructiveHint", "annotations.idempotentHint", "annotations.openWorldHint":
+		return toolHint(t.Tool, strings.TrimSuffix(path[1], "Hint"))
+	}
+	if !t.decoded {
+		t.decoded = true
+		if data, err := json.Marshal(t.Tool); err == nil {
+			_ = json.Unmarshal(data, &t.json) // A tool's own JSON always decodes
+		}
+	}
+	v := t.json
+	for _, name := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+type filterNode interface {
+	eval(t *filterTool) bool
+}
+
+type (
+	filterOr   []filterNode
+	filterAnd  []filterNode
+	filterNot  struct{ x filterNode }
+	filterTest struct {
+		path  []string
+		op    string
+		value any            // A literal: string, float64, bool, nil or []any (for in)
+		re    *regexp.Regexp // For matches
+	}
+)
+
+func (n filterOr) eval(t *filterTool) bool {
+	return slices.ContainsFunc(n, func(x filterNode) bool { return x.eval(t) })
+}
+
+func (n filterAnd) eval(t *filterTool) bool {
+	return !slices.ContainsFunc(n, func(x filterNode) bool { return !x.eval(t) })
+}
+
+func (n filterNot) eval(t *filterTool) bool { return !n.x.eval(t) }
+
+func (n *filterTest) eval(t *filterTool) bool {
+	v := t.field(n.path)
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(v, n.value)
+	case "!=":
+		return !reflect.DeepEqual(v, n.value)
+	case "<", "<=", ">", ">=":
+		var c int
+		switch v := v.(type) {
+		case float64:
+			f, ok := n.value.(float64)
+			if !ok {
+				return false
+			}
+			c = cmp.Compare(v, f)
+		case string:
+			s, ok := n.value.(string)
+			if !ok {
+				return false
+			}
+			c = cmp.Compare(v, s)
+		default:
+			return false
+		}
+		return map[string]bool{"<": c < 0, "<=": c <= 0, ">": c > 0, ">=": c >= 0}[n.op]
+	case "startsWith", "endsWith", "matches":
+		s, ok := v.(string)
+		switch {
+		case !ok:
+			return false
+		case n.op == "startsWith":
+			return strings.HasPrefix(s, n.value.(string))
+		case n.op == "endsWith":
+			return strings.HasSuffix(s, n.value.(string))
+		}
+		return n.re.MatchString(s)
+	case "contains":
+		switch v := v.(type) {
+		case string:
+			s, ok := n.value.(string)
+			return ok && strings.Contains(v, s)
+		case []any:
+			return slices.ContainsFunc(v, func(e any) bool { return reflect.DeepEqual(e, n.value) })
+		}
+		return false
+	case "in":
+		return slices.ContainsFunc(n.value.([]any), func(e any) bool { return reflect.DeepEqual(v, e) })
+	}
+	return false
+}
+
+type filterTokenKind int
+
+const (
+	filterEOF filterTokenKind = iota
+	filterIdent
+	filterString
+	filterNumber
+	filterPunct // An operator or bracket
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int // Byte offset in the expression
+}
+
+func (t filterToken) String() string {
+	if t.kind == filterEOF {
+		return "end of filter"
+	}
+	return fmt.Sprintf("%q at offset %d", t.text, t.pos)
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	isLetter := func(c byte) bool { return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	tokens := []filterToken{}
+	for i := 0; i < len(expr); {
+		c, start := expr[i], i
+		switch {
+		case strings.IndexByte(" \t\r\n", c) >= 0:
+			i++
+			continue
+		case c == '"' || c == '`':
+			q, err := strconv.QuotedPrefix(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens, i = append(tokens, filterToken{kind: filterString, text: q, pos: i}), i+len(q)
+			continue
+		case isLetter(c):
+			for i < len(expr) && (isLetter(expr[i]) || isDigit(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterIdent, text: expr[start:i], pos: start})
+			continue
+		case isDigit(c) || (c == '-' || c == '.') && i+1 < len(expr) && isDigit(expr[i+1]):
+			for i++; i < len(expr) && (isDigit(expr[i]) || strings.IndexByte(".eE", expr[i]) >= 0 ||
+				strings.IndexByte("+-", expr[i]) >= 0 && strings.IndexByte("eE", expr[i-1]) >= 0); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: filterNumber, text: expr[start:i], pos: start})
+			continue
+		}
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+			if strings.HasPrefix(expr[i:], op) {
+				tokens, i = append(tokens, filterToken{kind: filterPunct, text: op, pos: i}), i+len(op)
+				break
+			}
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected %q at offset %d", expr[i:i+1], i)
+		}
+	}
+	return append(tokens, filterToken{kind: filterEOF, pos: len(expr)}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	next   int
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.next] }
+
+func (p *filterParser) take() filterToken {
+	t := p.tokens[p.next]
+	if t.kind != filterEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept takes the next token if it's the punctuation text.
+func (p *filterParser) accept(text string) bool {
+	if t := p.peek(); t.kind == filterPunct && t.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) unexpected() error { return fmt.Errorf("unexpected %s", p.peek()) }
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	n, err := p.parseAnd()
+	or := filterOr{n}
+	for err == nil && p.accept("||") {
+		n, err = p.parseAnd()
+		or = append(or, n)
+	}
+	if err != nil || len(or) == 1 {
+		return n, err
+	}
+	return or, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	n, err := p.parseUnary()
+	and := filterAnd{n}
+	for err == nil && p.accept("&&") {
+		n, err = p.parseUnary()
+		and = append(and, n)
+	}
+	if err != nil || len(and) == 1 {
+		return n, err
+	}
+	return and, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.accept("!"):
+		n, err := p.parseUnary()
+		return filterNot{n}, err
+	case p.accept("("):
+		n, err := p.parseOr()
+		if err == nil && !p.accept(")") {
+			err = p.unexpected()
+		}
+		return n, err
+	}
+	return p.parseTest()
+}
+
+var filterOperators = []string{"==", "!=", "<", "<=", ">", ">=", "startsWith", "endsWith", "contains", "matches", "in"}
+
+func (p *filterParser) parseTest() (filterNode, error) {
+	field := p.peek()
+	if field.kind != filterIdent || slices.Contains([]string{"true", "false", "null"}, field.text) {
+		return nil, fmt.Errorf("expected a field but found %s", field)
+	}
+	p.take()
+	n := &filterTest{path: strings.Split(field.text, "."), op: "==", value: true}
+	if slices.Contains(n.path, "") {
+		return nil, fmt.Errorf("invalid field %s", field)
+	}
+	op := p.peek()
+	if op.kind != filterPunct && op.kind != filterIdent || !slices.Contains(filterOperators, op.text) {
+		return n, nil // A field alone
+	}
+	p.take()
+	n.op = op.text
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	n.value = value
+	_, isString := value.(string)
+	_, isNumber := value.(float64)
+	_, isList := value.([]any)
+	switch n.op {
+	case "<", "<=", ">", ">=":
+		if !isString && !isNumber {
+			return nil, fmt.Errorf("%s needs a string or number", op)
+		}
+	case "startsWith", "endsWith", "matches":
+		if !isString {
+			return nil, fmt.Errorf("%s needs a string", op)
+		}
+		if n.op == "matches" {
+			if n.re, err = regexp.Compile(value.(string)); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	case "in":
+		if !isList {
+			return nil, fmt.Errorf("%s needs a list", op)
+		}
+	}
+	return n, nil
+}
+
+func (p *filterParser) parseValue() (any, error) {
+	t := p.take()
+	switch {
+	case t.kind == filterString:
+		return strconv.Unquote(t.text)
+	case t.kind == filterNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return f, nil
+	case t.kind == filterIdent && t.text == "true":
+		return true, nil
+	case t.kind == filterIdent && t.text == "false":
+		return false, nil
+	case t.kind == filterIdent && t.text == "null":
+		return nil, nil
+	case t.kind == filterPunct && t.text == "[":
+		list := []any{}
+		for !p.accept("]") {
+			if len(list) > 0 && !p.accept(",") {
+				return nil, p.unexpected()
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected a value but found %s", t)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// filterTestEntries returns entries of tools covering the fields filters test.
+func filterTestEntries() []*Entry {
+	yes, no, title := true, false, "Delete Blob"
+	list := newTestTool("azmcp-storage-account-list", "List the storage accounts")
+	list.Annotations = &mcp.ToolAnnotations{ReadOnlyHint: &yes, DestructiveHint: &no}
+	list.InputSchema = json.RawMessage(`{"type": "object", "required": ["subscription"], "properties": {"subscription": {"type": "string"}}}`)
+	list.Meta = &mcp.Meta{"cost": 3.0}
+	del := newTestTool("azmcp-storage-blob-delete", "Delete a blob")
+	del.Annotations, del.Title = &mcp.ToolAnnotations{DestructiveHint: &yes}, &title
+	echo := newTestTool("echo", "Echo the text") // No annotations, so it has the default hints
+	tools := append(withServer("azmcp", []mcp.Tool{list, del}), withServer("other", []mcp.Tool{echo})...)
+	entries := []*Entry{}
+	for i := range tools {
+		entries = append(entries, &Entry{ID: entryID(&tools[i]), Metadata: &tools[i]})
+	}
+	return entries
+}
+
+func TestCompileFilter(t *testing.T) {
+	const (
+		list = "azmcp/azmcp-storage-account-list"
+		del  = "azmcp/azmcp-storage-blob-delete"
+		echo = "other/echo"
+	)
+	tests := []struct {
+		expr string
+		want []ID
+	}{
+		{``, []ID{list, del, echo}},
+		{`name == "echo"`, []ID{echo}},
+		{`name != "echo"`, []ID{list, del}},
+		{`id == "azmcp/azmcp-storage-blob-delete"`, []ID{del}},
+		{`server == "other"`, []ID{echo}},
+		{`description contains "blob"`, []ID{del}},
+		{`title == "Delete Blob"`, []ID{del}},
+		{`title == null`, []ID{list, echo}},
+		{`name startsWith "azmcp-storage"`, []ID{list, del}},
+		{`name endsWith "-list"`, []ID{list}},
+		{`name matches "^azmcp-.*-(list|get)$"`, []ID{list}},
+		{`name in ["echo", "azmcp-storage-account-list"]`, []ID{list, echo}},
+		{`inputSchema.required contains "subscription"`, []ID{list}},
+		{`_meta.cost >= 3`, []ID{list}},
+		{`_meta.cost < 3`, nil},
+		{`name < "b"`, []ID{list, del}},
+		{`missing.field == null`, []ID{list, del, echo}},
+		{`missing.field`, nil},
+
+		// Missing annotations & hints have the MCP spec's defaults
+		{`annotations.readOnlyHint`, []ID{list}},
+		{`annotations.destructiveHint`, []ID{del, echo}},
+		{`annotations.idempotentHint`, nil},
+		{`annotations.openWorldHint == true`, []ID{list, del, echo}},
+
+		// && binds tighter than ||; ! binds tightest; parentheses group
+		{`server == "other" || annotations.readOnlyHint && name endsWith "-delete"`, []ID{echo}},
+		{`(server == "other" || annotations.readOnlyHint) && name endsWith "-list"`, []ID{list}},
+		{`!annotations.readOnlyHint && server == "azmcp"`, []ID{del}},
+		{`!(annotations.readOnlyHint || server == "azmcp")`, []ID{echo}},
+		{`!!annotations.readOnlyHint`, []ID{list}},
+	}
+	entries := filterTestEntries()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			predicate, err := compileFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []ID(nil)
+			for _, e := range entries {
+				if predicate == nil || predicate(e) {
+					got = append(got, e.ID)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`name == "echo`, `unterminated string at offset 8`},
+		{`name # "echo"`, `unexpected "#" at offset 5`},
+		{`name ==`, `expected a value but found end of filter`},
+		{`== "echo"`, `expected a field but found "==" at offset 0`},
+		{`true`, `expected a field but found "true" at offset 0`},
+		{`name == "echo" name`, `unexpected "name" at offset 15`},
+		{`(name == "echo"`, `unexpected end of filter`},
+		{`name == "echo" &&`, `expected a field but found end of filter`},
+		{`a..b`, `invalid field "a..b" at offset 0`},
+		{`name < true`, `"<" at offset 5 needs a string or number`},
+		{`name startsWith 1`, `"startsWith" at offset 5 needs a string`},
+		{`name in "echo"`, `"in" at offset 5 needs a list`},
+		{`name in ["a" "b"]`, `unexpected "\"b\"" at offset 13`},
+		{`name matches "("`, "\"matches\" at offset 5: error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := compileFilter(tt.expr)
+			if want := "invalid filter " + strconv.Quote(tt.expr) + ": " + tt.want; err == nil || err.Error() != want {
+				t.Errorf("got error %v, want %s", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The find-tools server is an MCP server exposing a single find_tools tool. Instead of filtering tools/list
+// (like the proxy), the agent asks for the tools matching a natural-language query. Queries go through the
+// same searcher, composed from the same flags, that the evaluation harness measures, so offline scores predict
+// production behavior.
+
+const findToolsTool = "find_tools"
+
+var findToolsDefinition = findToolsToolDefinition()
+
+type findToolsServer struct {
+	db          *VectorDB
+	catalog     *Catalog
+	minScore    float32             // Tools scoring below this don't fit the query
+	filter      func(e *Entry) bool // Selects the tools that may be found; nil for all
+	searcher    searcher            // The stages of -hybrid, -intent, ... (see searchFlags)
+	tokens      tokenCounter        // Counts the tokens of tool definitions for budgets
+	calibration *calibration        // Converts scores to confidences; nil if the index has none
+}
+
+// foundTool is one entry in find_tools' structured content.
+type foundTool struct {
+	ID         ID        `json:"id"` // Server-qualified if the tool's server was named
+	Score      float32   `json:"score"`
+	Confidence *float64  `json:"confidence,omitempty"` // The probability the tool is correct if the index is calibrated
+	Tool       *mcp.Tool `json:"tool"`
+}
+
+func runFindToolsServer(args []string) {
+	fs := flag.NewFlagSet("find-tools", flag.ExitOnError)
+	toolsFiles, disabled := multiFlag{}, multiFlag{}
+	fs.Var(&toolsFiles, "tools", "[server=]file containing a tools/list result to index (repeatable; default list-tools.json); "+
+		"naming the server qualifies its tool IDs")
+	fs.Var(&disabled, "disable", "name of a server whose tools are hidden (repeatable)")
+	document := fs.String("document", defaultDocumentBuilder, fmt.Sprintf("how each tool's embedded text is composed: "+
+		"one of %v or a text/template", documentBuilderNames()))
+	minScore := fs.Float64("min-score", 0, "minimum score of a returned tool; see the evaluation's out-of-scope threshold")
+	embedder := fs.String("embedder", "aoai", fmt.Sprintf("embedder: one of %v", embedderNames()))
+	index := fs.String("index", "", "index file saved by the evaluation (its -index flag) whose vectors are reused "+
+		"for unchanged tools & whose calibration adds a confidence to each tool")
+	filter := fs.String("filter", "", "expression selecting the tools that may be found (see filter.go)")
+	tokenizer := fs.String("tokenizer", "chars", fmt.Sprintf("approximation of a model's "+
+		"tokenizer counting the tokens of tool definitions for the budget argument: one of %v", tokenCounterNames()))
+	turnWeights := fs.String("context", "", "how the conversation argument's turns weigh into the query vector: "+
+		"none or turns=2,decay=0.5,assistant=0.5 (see conversation.go)")
+	rewrite := fs.String("rewrite", "", "how queries are rewritten before they're embedded: "+
+		"synonyms[:file], stopwords & model:aoai|scripted[:file] joined by + (see rewrite.go)")
+	searchFlags := addSearchFlags(fs)
+	must(0, fs.Parse(args))
+	builder, err := lookupDocumentBuilder(*document)
+	if err == nil {
+		err = setEmbedder(*embedder)
+	}
+	s := &findToolsServer{db: NewVectorDB(CosineSimilarity{}, nil), minScore: float32(*minScore)}
+	if err == nil {
+		s.filter, err = compileFilter(*filter)
+	}
+	if err == nil {
+		s.tokens, err = lookupTokenCounter(*tokenizer)
+	}
+	if err == nil {
+		conversationContext, err = parseContextWeights(*turnWeights)
+	}
+	if err == nil {
+		queryRewriters, err = parseRewriters(*rewrite)
+	}
+	var search *searchConfig
+	if err == nil {
+		search, err = searchFlags.parse()
+	}
+	if err != nil {
+		log.Fatalf("find-tools: %v", err)
+	}
+	if len(toolsFiles) == 0 {
+		toolsFiles = multiFlag{"list-tools.json"}
+	}
+
+	if *index != "" {
+		saved, err := loadIndex(*index)
+		if err != nil {
+			log.Fatalf("find-tools: %v", err)
+		}
+		if err := saved.Check(&indexOptions{Builder: builder}, ""); err != nil {
+			log.Fatalf("find-tools: %s: %v", *index, err)
+		}
+		s.db, s.calibration = saved.DB(), saved.Calibration
+	}
+	io := &indexOptions{Builder: builder}
+	s.catalog = NewCatalog(s.db, io)
+	for _, namedFile := range toolsFiles {
+		server, file := splitNamed(namedFile)
+		stats, err := s.catalog.SetServerTools(server, loadToolsFromJSON(file))
+		if err != nil {
+			log.Fatalf("find-tools: indexing %s: %v", file, err)
+		}
+		log.Printf("find-tools: indexed %d tools from %s (%d embedded)", stats.Added+stats.Changed+stats.Unchanged, file, stats.Added+stats.Changed)
+	}
+	if n := s.catalog.Prune(); n > 0 {
+		log.Printf("find-tools: removed %d indexed tools no longer in any tools file", n)
+	}
+	for _, server := range disabled {
+		if !s.catalog.SetEnabled(server, false) {
+			log.Fatalf("find-tools: -disable %q: no such server; servers are %v", server, s.catalog.Servers())
+		}
+	}
+	for _, c := range s.catalog.Collisions() {
+		log.Printf("find-tools: tool %q is exposed by servers %v", c.Name, c.Servers)
+	}
+	s.searcher = search.build(s.db, dbTools(s.db), io) // The tools files are indexed once, so the stages never change
+	if err := s.calibration.Check(s.searcher); err != nil {
+		log.Fatalf("find-tools: %v", err)
+	}
+
+	server := &mcp.Server{Info: mcp.Implementation{BaseMetadata: mcp.BaseMetadata{Name: "tool-selection-find-tools"}, Version: "0.1.0"}, Tools: s}
+	if err := server.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("find-tools: %v", err)
+	}
+}
+
+func (s *findToolsServer) ListTools(ctx context.Context, params *mcp.PaginatedRequestParams) (*mcp.ListToolsResult, error) {
+	return &mcp.ListToolsResult{Tools: []mcp.Tool{findToolsDefinition}}, nil
+}
+
+func (s *findToolsServer) CallTool(ctx context.Context, params *mcp.CallToolRequestParams) (*mcp.CallToolResult, error) {
+	if params.Name != findToolsTool {
+		return nil, &mcp.RPCError{Code: mcp.InvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	if err := findToolsDefinition.ValidateArguments(params.Arguments); err != nil {
+		return mcp.TextResult("Invalid arguments: "+err.Error(), true), nil
+	}
+	query, _ := params.Arguments["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return mcp.TextResult("The 'query' argument is required.", true), nil
+	}
+	k, budget := 5, 0
+	if f, ok := params.Arguments["budget"].(float64); ok && f >= 1 {
+		k, budget = 0, int(f) // No limit on the number of tools unless k is given too
+	}
+	if f, ok := params.Arguments["k"].(float64); ok && f >= 1 {
+		k = int(f)
+	}
+	filters := map[string]bool{}
+	for _, hint := range []string{"readOnly", "destructive", "idempotent", "openWorld"} {
+		if b, ok := params.Arguments[hint].(bool); ok {
+			filters[hint] = b
+		}
+	}
+	expr, _ := params.Arguments["filter"].(string)
+	filter, err := compileFilter(expr)
+	if err != nil {
+		return mcp.TextResult(err.Error(), true), nil
+	}
+
+	turns := []conversationTurn(nil)
+	if conversation, ok := params.Arguments["conversation"]; ok {
+		if err := json.Unmarshal(must(json.Marshal(conversation)), &turns); err != nil {
+			return mcp.TextResult("Invalid conversation: "+err.Error(), true), nil
+		}
+	}
+
+	o := QueryOptions{TopK: k, MinimumScore: s.minScore, Predicate: s.catalog.Predicate(andPredicates(s.filter, filter, annotationPredicate(filters)))}
+	vector, err := embedInContext(turns, query)
+	if err != nil {
+		return mcp.TextResult("Failed to embed the query: "+err.Error(), true), nil
+	}
+	text := conversationContext.Text(turns, query)
+	var results []QueryResult
+	var confidences []float64
+	if budget > 0 {
+		results, confidences = s.calibration.budgetSearch(s.searcher, s.db, text, vector, o, budget, s.tokens)
+	} else {
+		results, confidences = s.calibration.Search(s.searcher, s.db, text, vector, o)
+	}
+
+	found := []foundTool{}
+	summary := &strings.Builder{}
+	fmt.Fprintf(summary, "Tools matching %q:\n", query)
+	for i, qr := range results {
+		t := qr.Entry.Metadata.(*mcp.Tool)
+		ft := foundTool{ID: qr.Entry.ID, Score: qr.Score, Tool: t}
+		description := "" // Just the first sentence
+		if t.Description != nil {
+			description, _, _ = strings.Cut(*t.Description, ". ")
+		}
+		if confidences != nil {
+			ft.Confidence = &confidences[i]
+			fmt.Fprintf(summary, "%d. %s (score %.4f, confidence %.0f%%): %s\n", i+1, qr.Entry.ID, qr.Score, confidences[i]*100, strings.TrimSpace(description))
+		} else {
+			fmt.Fprintf(summary, "%d. %s (score %.4f): %s\n", i+1, qr.Entry.ID, qr.Score, strings.TrimSpace(description))
+		}
+		found = append(found, ft)
+	}
+	if len(found) == 0 {
+		summary.WriteString("No tools found; no tool fits the query.\n")
+	}
+	result := mcp.TextResult(summary.String(), false)
+	result.StructuredContent = map[string]interface{}{"tools": found}
+	return result, nil
+}
+
+// annotationPredicate returns a predicate accepting only tools whose annotation hints equal those in filters
+// (keyed by hint name without the "Hint" suffix). Missing hints assume the MCP spec's defaults.
+// It returns nil (accept everything) if filters is empty.
+func annotationPredicate(filters map[string]bool) func(e *Entry) bool {
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(e *Entry) bool {
+		t, ok := e.Metadata.(*mcp.Tool)
+		if !ok {
+			return false
+		}
+		for hint, want := range filters {
+			if toolHint(t, hint) != want {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// toolHint returns the value of the named annotation hint, applying the MCP spec's default when it's absent.
+func toolHint(t *mcp.Tool, hint string) bool {
+	a := t.Annotations
+	if a == nil {
+		a = &mcp.ToolAnnotations{}
+	}
+	value := func(b *bool, def bool) bool {
+		if b == nil {
+			return def
+		}
+		return *b
+	}
+	switch hint {
+	case "readOnly":
+		return value(a.ReadOnlyHint, false)
+	case "destructive":
+		return value(a.DestructiveHint, true)
+	case "idempotent":
+		return value(a.IdempotentHint, false)
+	case "openWorld":
+		return value(a.OpenWorldHint, true)
+	}
+	return false
+}
+
+func findToolsToolDefinition() mcp.Tool {
+	description := "Find the tools best suited to a task. Describe the task in natural language; the result lists " +
+		"the matching tools' definitions (name, description, input schema) ranked by relevance score, with the " +
+		"probability that each is the right tool when the index is calibrated."
+	outputSchema := json.RawMessage(`{"type": "object", "properties": {"tools": {"type": "array", "items": {"type": "object", ` +
+		`"properties": {"id": {"type": "string"}, "score": {"type": "number"}, "confidence": {"type": "number"}, "tool": {"type": "object"}}, "required": ["id", "score", "tool"]}}}, ` +
+		`"required": ["tools"]}`)
+	readOnly := true
+	return mcp.Tool{
+		BaseMetadata: mcp.BaseMetadata{Name: findToolsTool},
+		Description:  &description,
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {` +
+			`"query": {"type": "string", "description": "The task to find tools for, in natural language."}, ` +
+			`"k": {"type": "integer", "minimum": 1, "description": "Maximum number of tools to return (default 5, or no limit with a budget)."}, ` +
+			`"budget": {"type": "integer", "minimum": 1, "description": "If set, return the best tools whose definitions fit in this many tokens."}, ` +
+			`"readOnly": {"type": "boolean", "description": "If set, only return tools whose readOnlyHint equals this value."}, ` +
+			`"destructive": {"type": "boolean", "description": "If set, only return tools whose destructiveHint equals this value."}, ` +
+			`"idempotent": {"type": "boolean", "description": "If set, only return tools whose idempotentHint equals this value."}, ` +
+			`"openWorld": {"type": "boolean", "description": "If set, only return tools whose openWorldHint equals this value."}, ` +
+			`"filter": {"type": "string", "description": "If set, only return tools this filter expression selects, e.g. ` +
+			`'server == \"azmcp\" && name startsWith \"azmcp-storage\" && !annotations.destructiveHint'."}, ` +
+			`"conversation": {"type": "array", "description": "The conversation's turns before the query (oldest first), if the ` +
+			`query depends on them (e.g. 'now delete it').", "items": {"type": "object", "properties": {` +
+			`"role": {"type": "string", "enum": ["user", "assistant"]}, "content": {"type": ["string", "object"], ` +
+			`"description": "The text or a text content block."}}, "required": ["role", "content"]}}}, ` +
+			`"required": ["query"]}`),
+		OutputSchema: &outputSchema,
+		Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: &readOnly},
+	}
+}
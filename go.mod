@@ -4,4 +4,4 @@ go 1.24
 
 toolchain go1.24.0
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// Hierarchical selection ranks service groups first & then ranks only the tools within the best groups.
+// Tool names follow "azmcp-<service>-<resource>-<verb>" so, by default, a tool's group is its <service>
+// segment (qualified by its server, if any); a grouping file can assign tools to groups explicitly.
+// Each group is represented by the centroid of its tools' primary vectors.
+
+// toolGroup returns the group of a tool: the explicit group in grouping (keyed by group name with tool
+// names or server-qualified IDs as values) or else the first segment of its name after any "azmcp-".
+func toolGroup(t *mcp.Tool, grouping map[string][]string) string {
+	for _, group := range slices.Sorted(maps.Keys(grouping)) {
+		if slices.Contains(grouping[group], string(entryID(t))) || slices.Contains(grouping[group], t.Name) {
+			return group
+		}
+	}
+	service, _, _ := strings.Cut(strings.TrimPrefix(t.Name, "azmcp-"), "-")
+	return string(toolID(toolServer(t), service))
+}
+
+type serviceGroup struct {
+	Name     string
+	Centroid []float32
+	ids      map[ID]bool
+}
+
+// groupResult is a group & its score for a prompt.
+type groupResult struct {
+	Score float32
+	Group *serviceGroup
+}
+
+// hierarchicalSearcher ranks the groups by the similarity of their centroids to the prompt & then has next
+// search only the tools in the best TopGroups groups.
+type hierarchicalSearcher struct {
+	db        *VectorDB
+	next      searcher
+	TopGroups int
+	groups    []*serviceGroup
+	groupOf   map[ID]*serviceGroup
+}
+
+// newHierarchicalSearcher groups tools (which must already be in db) & computes each group's centroid.
+func newHierarchicalSearcher(db *VectorDB, tools []mcp.Tool, grouping map[string][]string, topGroups int, next searcher) *hierarchicalSearcher {
+	h := &hierarchicalSearcher{db: db, next: next, TopGroups: topGroups, groupOf: map[ID]*serviceGroup{}}
+	byName := map[string]*serviceGroup{}
+	for i := range tools {
+		id := entryID(&tools[i])
+		e, ok := db.Get(id)
+		if !ok {
+			continue
+		}
+		name := toolGroup(&tools[i], grouping)
+		g, ok := byName[name]
+		if !ok {
+			g = &serviceGroup{Name: name, Centroid: make([]float32, len(e.Vector)), ids: map[ID]bool{}}
+			byName[name] = g
+		}
+		for d, v := range e.Vector {
+			g.Centroid[d] += v
+		}
+		g.ids[id] = true
+		h.groupOf[id] = g
+	}
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		g := byName[name]
+		for d := range g.Centroid {
+			g.Centroid[d] /= float32(len(g.ids))
+		}
+		h.groups = append(h.groups, g)
+	}
+	return h
+}
+
+// RankGroups returns every group, best first.
+func (h *hierarchicalSearcher) RankGroups(vector []float32) []groupResult {
+	results := make([]groupResult, len(h.groups))
+	for i, g := range h.groups {
+		results[i] = groupResult{Score: h.db.distanceMetric.Distance(vector, g.Centroid), Group: g}
+	}
+	slices.SortStableFunc(results, func(a, b groupResult) int {
+		switch {
+		case closer(h.db.distanceMetric, a.Score, b.Score):
+			return -1
+		case closer(h.db.distanceMetric, b.Score, a.Score):
+			return 1
+		}
+		return 0
+	})
+	return results
+}
+
+func (h *hierarchicalSearcher) Unwrap() searcher { return h.next }
+
+func (h *hierarchicalSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	selected := map[*serviceGroup]bool{}
+	for _, gr := range h.RankGroups(vector)[:min(h.TopGroups, len(h.groups))] {
+		selected[gr.Group] = true
+	}
+	next := o.Predicate
+	o.Predicate = func(e *Entry) bool { return selected[h.groupOf[e.ID]] && (next == nil || next(e)) }
+	return h.next.Search(prompt, vector, o)
+}
+
+// expectedGroups returns the groups of c's acceptable tools.
+func (h *hierarchicalSearcher) expectedGroups(c *testCase) []*serviceGroup {
+	groups := []*serviceGroup{}
+	for _, e := range acceptedEntries(h.db, c) {
+		if g, ok := h.groupOf[e.ID]; ok && !slices.Contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// loadGroupingFromJSON loads explicit groups from a JSON file: {"group": ["tool-name", ...], ...}.
+func loadGroupingFromJSON(filename string) map[string][]string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read grouping file %s: %v", filename, err)
+	}
+	grouping := map[string][]string{}
+	if err := json.Unmarshal(data, &grouping); err != nil {
+		log.Fatalf("Failed to parse grouping JSON from %s: %v", filename, err)
+	}
+	return grouping
+}
+
+// groupStats counts, for the prompts expecting a tool in one group, where selection succeeded or failed.
+// A prompt accepting tools in several groups is counted under the first group.
+type groupStats struct {
+	Prompts     int
+	GroupTop1   int // The expected group was ranked #1
+	GroupRecall int // The expected group was among the TopGroups searched
+	ToolTop1    int // The expected tool was ranked #1
+}
+
+// reportGroupAccuracy runs every prompt through h & reports group-level and tool-level accuracy, overall
+// and per group, attributing each tool-level miss to either group selection or tool ranking within the groups.
+func reportGroupAccuracy(h *hierarchicalSearcher, testCases []testCase, o QueryOptions) {
+	o.TopK = cmp.Or(o.TopK, 10)
+	start := time.Now()
+	total, perGroup := groupStats{}, map[string]*groupStats{}
+	for _, c := range embedPromptCases(testCases) {
+		if c.IsNegative() {
+			continue
+		}
+		expected := h.expectedGroups(&c.testCase)
+		if len(expected) == 0 {
+			log.Printf("Skipping case %s expecting unknown tools %s", c.ID, c.ExpectedString())
+			continue
+		}
+		s, ok := perGroup[expected[0].Name]
+		if !ok {
+			s = &groupStats{}
+			perGroup[expected[0].Name] = s
+		}
+		groups := h.RankGroups(c.Vector)
+		groupRank := slices.IndexFunc(groups, func(gr groupResult) bool { return slices.Contains(expected, gr.Group) }) + 1
+		toolRank := expectedRank(h.Search(c.Query(), c.Vector, o), &c.testCase)
+		for _, s := range []*groupStats{&total, s} {
+			s.Prompts++
+			if groupRank == 1 {
+				s.GroupTop1++
+			}
+			if groupRank <= h.TopGroups {
+				s.GroupRecall++
+			}
+			if toolRank == 1 {
+				s.ToolTop1++
+			}
+		}
+	}
+	groupMisses := total.Prompts - total.GroupRecall           // The expected tool was never a candidate
+	toolMisses := total.Prompts - total.ToolTop1 - groupMisses // The right group was searched but the wrong tool won
+
+	if isMarkdownOutput() {
+		fmt.Println("## Hierarchical Selection")
+		fmt.Println()
+		fmt.Printf("**Groups:** %d (top %d searched)  \n", len(h.groups), h.TopGroups)
+		fmt.Printf("**Group Accuracy (top 1):** %.1f%%  \n", percent(total.GroupTop1, total.Prompts))
+		fmt.Printf("**Group Recall (top %d):** %.1f%%  \n", h.TopGroups, percent(total.GroupRecall, total.Prompts))
+		fmt.Printf("**Tool Accuracy (top 1):** %.1f%%  \n", percent(total.ToolTop1, total.Prompts))
+		fmt.Printf("**Misses from group selection:** %d  \n", groupMisses)
+		fmt.Printf("**Misses from tool ranking:** %d  \n", toolMisses)
+		fmt.Println()
+		fmt.Println("| Group | Prompts | Group Accuracy | Group Recall | Tool Accuracy |")
+		fmt.Println("|-------|---------|----------------|--------------|---------------|")
+		for _, name := range slices.Sorted(maps.Keys(perGroup)) {
+			s := perGroup[name]
+			fmt.Printf("| `%s` | %d | %.1f%% | %.1f%% | %.1f%% |\n", name, s.Prompts,
+				percent(s.GroupTop1, s.Prompts), percent(s.GroupRecall, s.Prompts), percent(s.ToolTop1, s.Prompts))
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nHierarchical selection: group count=%d, top groups searched=%d\n", len(h.groups), h.TopGroups)
+		fmt.Printf("   %-24s %8s %9s %9s %9s\n", "Group", "Prompts", "GroupTop1", "GroupTopN", "ToolTop1")
+		for _, name := range slices.Sorted(maps.Keys(perGroup)) {
+			s := perGroup[name]
+			fmt.Printf("   %-24s %8d %8.1f%% %8.1f%% %8.1f%%\n", name, s.Prompts,
+				percent(s.GroupTop1, s.Prompts), percent(s.GroupRecall, s.Prompts), percent(s.ToolTop1, s.Prompts))
+		}
+		fmt.Printf("   %-24s %8d %8.1f%% %8.1f%% %8.1f%%\n", "(all)", total.Prompts,
+			percent(total.GroupTop1, total.Prompts), percent(total.GroupRecall, total.Prompts), percent(total.ToolTop1, total.Prompts))
+		fmt.Printf("\nMisses from group selection=%d, Misses from tool ranking=%d, Execution time=%v\n", groupMisses, toolMisses, time.Since(start))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+func TestToolGroup(t *testing.T) {
+	list := newTestTool("azmcp-storage-account-list", "")
+	federated := withServer("azure", []mcp.Tool{list})[0]
+	tests := []struct {
+		name     string
+		tool     mcp.Tool
+		grouping map[string][]string
+		want     string
+	}{
+		{"service", list, nil, "storage"},
+		{"without azmcp-", newTestTool("keyvault-secret-get", ""), nil, "keyvault"},
+		{"qualified by server", federated, nil, "azure/storage"},
+		{"by name", list, map[string][]string{"data": {"azmcp-storage-account-list"}}, "data"},
+		{"by name from any server", federated, map[string][]string{"data": {"azmcp-storage-account-list"}}, "data"},
+		{"by ID", federated, map[string][]string{"data": {"azure/azmcp-storage-account-list"}}, "data"},
+		{"by another server's ID", list, map[string][]string{"data": {"azure/azmcp-storage-account-list"}}, "storage"},
+		{"the first group alphabetically", list, map[string][]string{"b": {"azmcp-storage-account-list"}, "a": {"azmcp-storage-account-list"}}, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toolGroup(&tt.tool, tt.grouping); got != tt.want {
+				t.Errorf("got group %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHierarchicalSearcher(t *testing.T) {
+	tools := []mcp.Tool{
+		newTestTool("azmcp-storage-account-list", ""),
+		newTestTool("azmcp-storage-blob-list", ""),
+		newTestTool("azmcp-redis-cache-list", ""),
+		newTestTool("azmcp-redis-cache-get", ""),
+	}
+	// The storage tools are near (1, 0) & the Redis tools near (0, 1)
+	vectors := [][]float32{{1, 0}, {0.8, 0.6}, {0, 1}, {0.6, 0.8}}
+	metrics := maps.Clone(distanceMetrics)
+	metrics["euclidean"] = euclideanDistance{}
+	for name, metric := range metrics {
+		t.Run(name, func(t *testing.T) {
+			db := NewVectorDB(metric, nil)
+			for i := range tools {
+				db.Upsert(&Entry{ID: entryID(&tools[i]), Metadata: &tools[i], Vector: vectors[i]})
+			}
+			h := newHierarchicalSearcher(db, tools, nil, 1, vectorSearcher{db: db})
+			groups := h.RankGroups([]float32{0, 1})
+			if len(groups) != 2 || groups[0].Group.Name != "redis" || groups[1].Group.Name != "storage" {
+				t.Fatalf("got groups %+v, want redis then storage", groups)
+			}
+			if got := groups[1].Group.Centroid; !slices.Equal(got, []float32{0.9, 0.3}) {
+				t.Errorf("got the storage centroid %v, want the mean of its tools' vectors", got)
+			}
+
+			o := QueryOptions{TopK: 4, MinimumScore: float32(-1e9)}
+			if !metric.BiggerIsCloser() {
+				o.MinimumScore = 0 // No maximum distance
+			}
+			got := resultIDs(h.Search("", []float32{0, 1}, o))
+			if want := []ID{"azmcp-redis-cache-list", "azmcp-redis-cache-get"}; !slices.Equal(got, want) {
+				t.Errorf("got %v, want only the tools of the best group, %v", got, want)
+			}
+			o.Predicate = func(e *Entry) bool { return e.ID != "azmcp-redis-cache-list" }
+			if got := resultIDs(h.Search("", []float32{0, 1}, o)); !slices.Equal(got, []ID{"azmcp-redis-cache-get"}) {
+				t.Errorf("got %v, want the caller's predicate applied within the best group", got)
+			}
+			h.TopGroups = 3 // More than there are
+			o.Predicate = nil
+			if got := h.Search("", []float32{0, 1}, o); len(got) != len(tools) {
+				t.Errorf("got %v, want every tool", resultIDs(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The HTTP server exposes tool selection as a JSON service so other teams can call it without linking Go code:
+//   POST   /query       {"text": ..., "vector": [...], "topK": 5, "minScore": 0.3, "filters": {"readOnly": true},
+//                       "filter": "server == \"azmcp\"", "budget": 4000, "conversation": [{"role": "user", "content": ...}]}
+//                       -> {"tools": [foundTool, ...]}; exactly one of text & vector is required
+//   GET    /tools/{id}  -> indexEntry
+//   PUT    /tools/{id}  indexEntry (its tool is embedded unless it has a vector) -> indexEntry (201 if added)
+//   DELETE /tools/{id}
+//   GET    /healthz     -> {"status": "ok", "tools": n}
+// Errors are {"error": ...}; a text that can't be embedded fails with 503 if the embeddings service is unavailable
+// or 502 if it failed the request. Every request goes straight to the VectorDB, whose RWMutex lets queries run
+// concurrently with each other & serializes them with changes; after a change, the searcher's stages are rebuilt
+// for the current tools. Changes aren't saved to the index file.
+
+const maxRequestBytes = 1 << 20
+
+type httpServer struct {
+	db          *VectorDB
+	io          *indexOptions
+	o           QueryOptions     // The defaults of POST /query's topK & minScore; its Predicate is -filter's
+	searcher    *catalogSearcher // The stages of -hybrid, -intent, ... (see searchFlags), rebuilt as tools change
+	tokens      tokenCounter     // Counts the tokens of tool definitions for budgets
+	calibration *calibration     // Converts scores to confidences; nil if the index has none
+}
+
+// queryRequest is the body of POST /query.
+type queryRequest struct {
+	Text     string          `json:"text,omitempty"`
+	Vector   []float32       `json:"vector,omitempty"`
+	TopK     *int            `json:"topK,omitempty"`
+	MinScore *float32        `json:"minScore,omitempty"`
+	Filters  map[string]bool `json:"filters,omitempty"` // Annotation hints without the "Hint" suffix; see annotationPredicate
+	Filter   string          `json:"filter,omitempty"`  // A filter expression; see compileFilter
+	Budget   int             `json:"budget,omitempty"`  // If > 0, the tools fitting in this many tokens (at most topK if given)
+
+	Conversation []conversationTurn `json:"conversation,omitempty"` // The turns before the query (oldest first); see conversation.go
+}
+
+func runHTTPServer(args []string) {
+	fs := flag.NewFlagSet("http", flag.ExitOnError)
+	f := addSelectionFlags(fs, 5)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	must(0, fs.Parse(args))
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("http: %v", err)
+	}
+	s := &httpServer{io: io, o: o, tokens: tokenCounters[f.Tokenizer]}
+	_, s.db, s.calibration = f.loadOrBuildIndex(io)
+	s.searcher = newCatalogSearcher(f.search, s.db, io)
+	if err := s.calibration.Check(s.searcher); err != nil {
+		log.Fatalf("http: %v", err)
+	}
+
+	server := &http.Server{Addr: *addr, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("http: serving %d tools on %s", getAllTools(s.db), *addr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("http: %v", err)
+	}
+}
+
+func (s *httpServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /query", s.query)
+	mux.HandleFunc("GET /tools/{id...}", s.getTool) // IDs of named servers' tools contain a "/"
+	mux.HandleFunc("PUT /tools/{id...}", s.putTool)
+	mux.HandleFunc("DELETE /tools/{id...}", s.deleteTool)
+	mux.HandleFunc("GET /healthz", s.healthz)
+	return mux
+}
+
+func (s *httpServer) query(w http.ResponseWriter, r *http.Request) {
+	req := queryRequest{}
+	if err := decodeRequest(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	vector, err := req.Vector, error(nil)
+	switch {
+	case (strings.TrimSpace(req.Text) == "") == (len(vector) == 0):
+		writeError(w, http.StatusBadRequest, "exactly one of text & vector is required")
+		return
+	case len(vector) == 0:
+		vector, err = embedQuery(req.Text)
+	case len(vector) != dimensions(s.db):
+		writeError(w, http.StatusBadRequest, "vector has %d dimensions; expected %d", len(vector), dimensions(s.db))
+		return
+	}
+	if err == nil {
+		vector, err = conversationContext.Vector(req.Conversation, vector)
+	}
+	if err != nil {
+		writeError(w, embeddingStatus(err), "%v", err)
+		return
+	}
+	text := conversationContext.Text(req.Conversation, req.Text)
+	o := s.o
+	if req.TopK != nil {
+		if *req.TopK < 1 {
+			writeError(w, http.StatusBadRequest, "topK must be at least 1")
+			return
+		}
+		o.TopK = *req.TopK
+	}
+	if req.MinScore != nil {
+		o.MinimumScore = *req.MinScore
+	}
+	for hint := range req.Filters {
+		if !slices.Contains([]string{"readOnly", "destructive", "idempotent", "openWorld"}, hint) {
+			writeError(w, http.StatusBadRequest, "unknown filter %q; expected readOnly, destructive, idempotent or openWorld", hint)
+			return
+		}
+	}
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	o.Predicate = andPredicates(s.o.Predicate, filter, annotationPredicate(req.Filters))
+
+	var results []QueryResult
+	var confidences []float64
+	switch {
+	case req.Budget < 0:
+		writeError(w, http.StatusBadRequest, "budget must be positive")
+		return
+	case req.Budget > 0:
+		if req.TopK == nil {
+			o.TopK = 0
+		}
+		results, confidences = s.calibration.budgetSearch(s.searcher, s.db, text, vector, o, req.Budget, s.tokens)
+	default:
+		results, confidences = s.calibration.Search(s.searcher, s.db, text, vector, o)
+	}
+	found := []foundTool{}
+	for i, qr := range results {
+		ft := foundTool{ID: qr.Entry.ID, Score: qr.Score, Tool: qr.Entry.Metadata.(*mcp.Tool)}
+		if confidences != nil {
+			ft.Confidence = &confidences[i]
+		}
+		found = append(found, ft)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tools": found})
+}
+
+func (s *httpServer) getTool(w http.ResponseWriter, r *http.Request) {
+	e, ok := s.db.Get(ID(r.PathValue("id")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no tool %q", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, indexEntry{ID: e.ID, Tool: e.Metadata.(*mcp.Tool), Vector: e.Vector, Vectors: e.Vectors})
+}
+
+// putTool adds (201) or replaces (200) the tool. Its ID must be the path's; unless the body has a vector, the
+// tool is embedded as when it's indexed (with all its additional vectors).
+func (s *httpServer) putTool(w http.ResponseWriter, r *http.Request) {
+	id := ID(r.PathValue("id"))
+	req := indexEntry{}
+	if err := decodeRequest(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	switch {
+	case req.Tool == nil || req.Tool.Name == "":
+		writeError(w, http.StatusBadRequest, "a tool with a name is required")
+		return
+	case entryID(req.Tool) != id:
+		writeError(w, http.StatusBadRequest, "the tool's ID is %q, not %q", entryID(req.Tool), id)
+		return
+	case req.ID != "" && req.ID != id:
+		writeError(w, http.StatusBadRequest, "the ID is %q, not %q", req.ID, id)
+		return
+	}
+	status := http.StatusOK
+	if _, ok := s.db.Get(id); !ok {
+		status = http.StatusCreated
+	}
+	if len(req.Vector) == 0 {
+		if err := tools2DB(s.db, []mcp.Tool{*req.Tool}, s.io); err != nil {
+			writeError(w, cmp.Or(embeddingStatus(err), http.StatusBadRequest), "%v", err) // Or the tool's document can't be built
+			return
+		}
+	} else {
+		n := cmp.Or(dimensions(s.db), len(req.Vector))
+		if len(req.Vector) != n || slices.ContainsFunc(req.Vectors, func(v NamedVector) bool { return len(v.Vector) != n }) {
+			writeError(w, http.StatusBadRequest, "every vector must have %d dimensions", n)
+			return
+		}
+		s.db.Upsert(&Entry{ID: id, Metadata: req.Tool, Vector: req.Vector, Vectors: req.Vectors})
+	}
+	s.searcher.Rebuild()
+	e, _ := s.db.Get(id)
+	writeJSON(w, status, indexEntry{ID: e.ID, Tool: e.Metadata.(*mcp.Tool), Vector: e.Vector, Vectors: e.Vectors})
+}
+
+func (s *httpServer) deleteTool(w http.ResponseWriter, r *http.Request) {
+	id := ID(r.PathValue("id"))
+	if _, ok := s.db.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "no tool %q", id)
+		return
+	}
+	s.db.Delete(id)
+	s.searcher.Rebuild()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *httpServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "tools": getAllTools(s.db)})
+}
+
+// dimensions returns the length of db's vectors or 0 if db is empty.
+func dimensions(db *VectorDB) int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if len(db.entries) == 0 {
+		return 0
+	}
+	return len(db.entries[0].Vector)
+}
+
+// decodeRequest decodes r's JSON body into v, rejecting unknown fields & bodies over maxRequestBytes.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			return fmt.Errorf("request body is larger than %d bytes", maxErr.Limit)
+		}
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		log.Printf("http: failed to write response: %v", err)
+	}
+}
+
+// embeddingStatus returns the status reporting err: 503 (Service Unavailable) if the embeddings service is
+// unavailable, 502 (Bad Gateway) if it failed otherwise or 0 if err isn't an embedding failure.
+func embeddingStatus(err error) int {
+	switch {
+	case errors.Is(err, errEmbedderUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errEmbeddingFailed):
+		return http.StatusBadGateway
+	}
+	return 0
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
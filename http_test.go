@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// An embedding failure fails the request (with 503 if the service is unavailable, 502 otherwise) rather than
+// the server, which keeps serving.
+func TestHTTPServerEmbeddingFailures(t *testing.T) {
+	db := newTestDB(newTestTool("storage-account-list", "List the storage accounts in a subscription"))
+	s := &httpServer{db: db, io: &indexOptions{Builder: must(lookupDocumentBuilder(""))}, o: QueryOptions{TopK: 5},
+		tokens: charTokens}
+	s.searcher = newCatalogSearcher(&searchConfig{}, db, s.io)
+	handler := s.handler()
+	const (
+		query = `{"text": "List my storage accounts"}`
+		put   = `{"tool": {"name": "echo", "description": "Echo the text", "inputSchema": {"type": "object"}}}`
+	)
+	tests := []struct {
+		name         string
+		err          error // The embedder's; nil embeds with hashEmbeddings
+		method, path string
+		body         string
+		want         int
+	}{
+		{"query", nil, http.MethodPost, "/query", query, http.StatusOK},
+		{"query while unavailable", fmt.Errorf("%w: throttled", errEmbedderUnavailable), http.MethodPost, "/query", query, http.StatusServiceUnavailable},
+		{"query failing", errors.New("API error"), http.MethodPost, "/query", query, http.StatusBadGateway},
+		{"query by vector while unavailable", errEmbedderUnavailable, http.MethodPost, "/query",
+			`{"vector": [` + strings.Repeat("0,", hashDimensions-1) + `1]}`, http.StatusOK},
+		{"put while unavailable", errEmbedderUnavailable, http.MethodPut, "/tools/echo", put, http.StatusServiceUnavailable},
+		{"put failing", errors.New("API error"), http.MethodPut, "/tools/echo", put, http.StatusBadGateway},
+		{"put", nil, http.MethodPut, "/tools/echo", put, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEmbedder(t, func(input string) ([]float32, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return hashEmbeddings(input), nil
+			})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("got %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+// Adding & removing tools rebuilds the search stages that index the tools, like -hybrid's BM25 index.
+func TestHTTPServerRebuildsSearchStages(t *testing.T) {
+	useCountingEmbedder(t)
+	db := newTestDB(newTestTool("storage-account-list", "List the storage accounts in a subscription"))
+	c := must((&searchFlags{Hybrid: "rrf"}).parse())
+	s := &httpServer{db: db, io: &indexOptions{Builder: must(lookupDocumentBuilder(""))}, o: QueryOptions{TopK: 5}, tokens: charTokens}
+	s.searcher = newCatalogSearcher(c, db, s.io)
+	handler := s.handler()
+	lexicalMatches := func(word string) int {
+		h, _ := findSearcher[*hybridSearcher](s.searcher)
+		return len(h.lexical.Scores(word))
+	}
+
+	put := `{"tool": {"name": "keyvault-secret-get", "description": "Get a secret from a Key Vault", "inputSchema": {"type": "object"}}}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/tools/keyvault-secret-get", strings.NewReader(put)))
+	if w.Code != http.StatusCreated || lexicalMatches("vault") != 1 {
+		t.Errorf("after PUT: got %d & %d lexical matches, want 201 & 1", w.Code, lexicalMatches("vault"))
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/tools/keyvault-secret-get", nil))
+	if w.Code != http.StatusNoContent || lexicalMatches("vault") != 0 {
+		t.Errorf("after DELETE: got %d & %d lexical matches, want 204 & 0", w.Code, lexicalMatches("vault"))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"os"
+	"slices"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// An index file saves a VectorDB of tools, with all their vectors, & the calibration fit on it so that tools
+// needn't be re-embedded & queries can report confidences. The structure is:
+// {"version": 1, "document": "description", "embedder": "aoai", "metric": "cosine", "vectors": ["name"],
+// "examples": "<digest>", "entries": [{"id": ..., "tool": {...}, "vector": [...]}, ...], "calibration": {...}}
+
+const indexFileVersion = 1
+
+type indexFile struct {
+	Version     int          `json:"version"`
+	Document    string       `json:"document"`           // The name of the documentBuilder that composed the embedded text (see documentBuilder.Name)
+	Embedder    string       `json:"embedder,omitempty"` // The embedder that embedded it (see embedders); default aoai
+	Metric      string       `json:"metric,omitempty"`   // The distance metric (see distanceMetrics); default cosine
+	Vectors     []string     `json:"vectors,omitempty"`  // The kinds of additional vectors (see indexedVectors)
+	Examples    string       `json:"examples,omitempty"` // The digest of the example prompts (see examplesDigest); "" for none
+	Entries     []indexEntry `json:"entries"`
+	Calibration *calibration `json:"calibration,omitempty"`
+}
+
+type indexEntry struct {
+	ID      ID            `json:"id"`
+	Tool    *mcp.Tool     `json:"tool"`
+	Vector  []float32     `json:"vector"`
+	Vectors []NamedVector `json:"vectors,omitempty"`
+}
+
+var distanceMetrics = map[string]DistanceMetric{"cosine": CosineSimilarity{}, "dot": DotProduct{}}
+
+func distanceMetricNames() []string { return slices.Sorted(maps.Keys(distanceMetrics)) }
+
+// saveIndex writes db's entries (whose Metadata must be *mcp.Tool) & metric, how o composed their embedded
+// texts, the current embedder & c (which may be nil) to filename.
+func saveIndex(filename string, db *VectorDB, o *indexOptions, c *calibration) error {
+	f := indexFile{Version: indexFileVersion, Document: o.Builder.Name, Embedder: embedderName, Vectors: indexedVectors(o),
+		Examples: examplesDigest(o.Examples), Calibration: c}
+	for name, m := range distanceMetrics {
+		if m == db.distanceMetric {
+			f.Metric = name
+		}
+	}
+	db.mu.RLock()
+	for _, e := range db.entries {
+		t, ok := e.Metadata.(*mcp.Tool)
+		if !ok {
+			db.mu.RUnlock()
+			return fmt.Errorf("entry %s isn't a tool", e.ID)
+		}
+		f.Entries = append(f.Entries, indexEntry{ID: e.ID, Tool: t, Vector: e.Vector, Vectors: e.Vectors})
+	}
+	db.mu.RUnlock()
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// loadIndex reads an index file written by saveIndex.
+func loadIndex(filename string) (*indexFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f := &indexFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse index %s: %w", filename, err)
+	}
+	if f.Version != indexFileVersion {
+		return nil, fmt.Errorf("index %s has version %d; expected %d", filename, f.Version, indexFileVersion)
+	}
+	return f, nil
+}
+
+// Check returns an error if the index's vectors can't be compared with those of the current embedder or
+// weren't composed as o composes them or for the named metric (any if it's ""). Since unchanged tools aren't
+// re-embedded, an index whose additional vectors or example prompts differ from o's would go stale.
+func (f *indexFile) Check(o *indexOptions, metric string) error {
+	switch {
+	case f.Document != o.Builder.Name:
+		return fmt.Errorf("index was built with the %q document builder, not %q", f.Document, o.Builder.Name)
+	case cmp.Or(f.Embedder, "aoai") != embedderName:
+		return fmt.Errorf("index was built with the %q embedder, not %q", cmp.Or(f.Embedder, "aoai"), embedderName)
+	case metric != "" && cmp.Or(f.Metric, "cosine") != metric:
+		return fmt.Errorf("index was built for the %q metric, not %q", cmp.Or(f.Metric, "cosine"), metric)
+	case !slices.Equal(f.Vectors, indexedVectors(o)):
+		return fmt.Errorf("index was built with the additional vectors %v, not %v", f.Vectors, indexedVectors(o))
+	case f.Examples != examplesDigest(o.Examples):
+		return fmt.Errorf("index was built with other example prompts")
+	}
+	return nil
+}
+
+// indexedVectors returns the kinds of additional vectors o adds to every entry: "name" and/or "parameter".
+// Example vectors are recorded by examplesDigest.
+func indexedVectors(o *indexOptions) []string {
+	vectors := []string(nil)
+	if o.NameVector {
+		vectors = append(vectors, "name")
+	}
+	if o.ParameterVectors {
+		vectors = append(vectors, "parameter")
+	}
+	return vectors
+}
+
+// examplesDigest returns a hash of the example prompts ("" if there are none).
+func examplesDigest(examples map[string][]string) string {
+	if len(examples) == 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write(must(json.Marshal(examples))) // Maps marshal with sorted keys
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// DB returns a VectorDB of the index's entries.
+func (f *indexFile) DB() *VectorDB {
+	entries := []*Entry{}
+	for _, e := range f.Entries {
+		entries = append(entries, &Entry{ID: e.ID, Metadata: e.Tool, Vector: e.Vector, Vectors: e.Vectors})
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int { return cmp.Compare(a.ID, b.ID) })
+	metric, ok := distanceMetrics[f.Metric]
+	if !ok {
+		metric = CosineSimilarity{}
+	}
+	return NewVectorDB(metric, entries)
+}
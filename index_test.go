@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// An index built with a custom template is refused once the template changes, since its vectors would be stale.
+func TestIndexCheckCustomTemplate(t *testing.T) {
+	useCountingEmbedder(t)
+	const template = `{{.NameWords}}: {{.Description}}`
+	builder := must(lookupDocumentBuilder(template))
+	db, filename := NewVectorDB(CosineSimilarity{}, nil), filepath.Join(t.TempDir(), "index.json")
+	tools := []mcp.Tool{newTestTool("storage-account-list", "List the storage accounts in a subscription")}
+	if err := tools2DB(db, tools, &indexOptions{Builder: builder}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveIndex(filename, db, &indexOptions{Builder: builder}, nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := must(loadIndex(filename))
+	for spec, wantErr := range map[string]bool{
+		template:                            false,
+		`{{.NameWords}} - {{.Description}}`: true,
+		`{{.Title}}: {{.Description}}`:      true,
+		"name":                              true, // The built-in builder with the same template
+		"description":                       true,
+	} {
+		if err := saved.Check(&indexOptions{Builder: must(lookupDocumentBuilder(spec))}, ""); (err != nil) != wantErr {
+			t.Errorf("-document %q: got error %v, want one: %t", spec, err, wantErr)
+		}
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	useCountingEmbedder(t)
+	o := &indexOptions{Builder: must(lookupDocumentBuilder("name")), NameVector: true,
+		Examples: map[string][]string{"storage-account-list": {"Show my storage accounts"}}}
+	tools := []mcp.Tool{
+		newTestTool("storage-account-list", "List the storage accounts in a subscription"),
+		newTestTool("redis-cache-list", "List the Redis caches in a subscription"),
+	}
+	db, filename := NewVectorDB(DotProduct{}, nil), filepath.Join(t.TempDir(), "index.json")
+	if err := tools2DB(db, tools, o); err != nil {
+		t.Fatal(err)
+	}
+	c := &calibration{Method: "platt", Searcher: "vector", ScoreWeight: 2, MarginWeight: 3, Bias: -1}
+	if err := saveIndex(filename, db, o, c); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := loadIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.Check(o, "dot"); err != nil {
+		t.Errorf("the index doesn't match the options it was built with: %v", err)
+	}
+	if saved.Calibration == nil || !reflect.DeepEqual(*saved.Calibration, *c) {
+		t.Errorf("got calibration %+v, want %+v", saved.Calibration, c)
+	}
+	loaded := saved.DB()
+	if loaded.distanceMetric != db.distanceMetric {
+		t.Errorf("got metric %T, want %T", loaded.distanceMetric, db.distanceMetric)
+	}
+	if got, want := dbIDs(loaded), dbIDs(db); !slices.Equal(got, want) {
+		t.Fatalf("got entries %v, want %v", got, want)
+	}
+	for _, e := range db.entries {
+		l, _ := loaded.Get(e.ID)
+		if !slices.Equal(l.Vector, e.Vector) || !slices.EqualFunc(l.Vectors, e.Vectors, func(a, b NamedVector) bool {
+			return a.Name == b.Name && slices.Equal(a.Vector, b.Vector)
+		}) || !sameTool(l.Metadata.(*mcp.Tool), e.Metadata.(*mcp.Tool)) {
+			t.Errorf("%s didn't round-trip", e.ID)
+		}
+	}
+}
+
+func TestIndexCheck(t *testing.T) {
+	useCountingEmbedder(t)
+	o := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	db, filename := NewVectorDB(CosineSimilarity{}, nil), filepath.Join(t.TempDir(), "index.json")
+	if err := tools2DB(db, []mcp.Tool{newTestTool("storage-account-list", "List the storage accounts")}, o); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveIndex(filename, db, o, nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := must(loadIndex(filename))
+
+	tests := []struct {
+		name     string
+		o        *indexOptions
+		metric   string
+		embedder string
+		want     string // The error; "" for none
+	}{
+		{"same", o, "cosine", "test", ""},
+		{"any metric", o, "", "test", ""},
+		{"other builder", &indexOptions{Builder: must(lookupDocumentBuilder("full"))}, "cosine", "test",
+			`index was built with the "description" document builder, not "full"`},
+		{"other embedder", o, "cosine", "hash", `index was built with the "test" embedder, not "hash"`},
+		{"other metric", o, "dot", "test", `index was built for the "cosine" metric, not "dot"`},
+		{"other vectors", &indexOptions{Builder: o.Builder, NameVector: true}, "cosine", "test",
+			"index was built with the additional vectors [], not [name]"},
+		{"other examples", &indexOptions{Builder: o.Builder, Examples: map[string][]string{"storage-account-list": {"a"}}},
+			"cosine", "test", "index was built with other example prompts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := embedderName
+			embedderName = tt.embedder
+			defer func() { embedderName = previous }()
+			err := saved.Check(tt.o, tt.metric)
+			if got := fmt.Sprint(err); tt.want == "" && err != nil || tt.want != "" && got != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
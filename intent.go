@@ -0,0 +1,287 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// Sibling tools often differ only in their operation: the verb ending their name ("azmcp-appconfig-kv-list",
+// "-delete", "-lock", "-set", ...). An intentClassifier extracts the operation a prompt asks for & an
+// intentSearcher boosts the tools whose verb matches it.
+
+// toolVerb returns the verb of a tool: the last "-" separated segment of its name.
+func toolVerb(t *mcp.Tool) string { return nameVerb(t.Name) }
+
+func nameVerb(name string) string { return name[strings.LastIndex(name, "-")+1:] }
+
+// words lower-cases text & splits it into words at non-alphanumeric characters.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// An intentClassifier returns the tool verbs a prompt's intent matches; none if it can't tell.
+type intentClassifier interface {
+	Classify(prompt string) []string
+}
+
+// intentRule maps prompt keywords to the tool verbs they indicate.
+type intentRule struct {
+	Keywords []string
+	Verbs    []string
+}
+
+// ruleClassifier returns the verbs of the first rule with a keyword in the prompt. The rules are ordered
+// most specific first: "Show me all ..." is a list and "Unlock ..." isn't a lock.
+type ruleClassifier struct {
+	Rules []intentRule
+}
+
+var defaultIntentRules = []intentRule{
+	{Keywords: []string{"unlock"}, Verbs: []string{"unlock"}},
+	{Keywords: []string{"lock"}, Verbs: []string{"lock"}},
+	{Keywords: []string{"delete", "remove", "purge"}, Verbs: []string{"delete"}},
+	{Keywords: []string{"create", "new", "add"}, Verbs: []string{"create"}},
+	{Keywords: []string{"set", "update", "change", "enable", "disable", "configure", "modify"}, Verbs: []string{"set", "setparam"}},
+	{Keywords: []string{"query", "contain", "contains", "search", "find", "logs", "run", "execute"}, Verbs: []string{"query"}},
+	{Keywords: []string{"list", "all", "enumerate"}, Verbs: []string{"list"}},
+	{Keywords: []string{"get", "show", "details", "describe", "fetch", "display", "what"},
+		Verbs: []string{"get", "show", "details", "describe", "schema", "config", "param", "gethealth", "definitions", "sample"}},
+}
+
+func (c *ruleClassifier) Classify(prompt string) []string {
+	w := words(prompt)
+	for _, r := range c.Rules {
+		if slices.ContainsFunc(r.Keywords, func(k string) bool { return slices.Contains(w, k) }) {
+			return r.Verbs
+		}
+	}
+	return nil
+}
+
+// learnedClassifier is a multinomial naive Bayes classifier trained on example prompts labeled with the
+// verb of their expected tool. It returns the single most probable verb.
+type learnedClassifier struct {
+	prompts    map[string]int            // Verb -> number of training prompts
+	wordCounts map[string]map[string]int // Verb -> word -> count
+	totals     map[string]int            // Verb -> number of words
+	vocabulary map[string]bool
+	Examples   string // The file of training prompts; see parseIntentOptions
+}
+
+// newLearnedClassifier trains a classifier from example prompts keyed by tool name or server-qualified ID
+// (see examplesByTool).
+func newLearnedClassifier(toolNameWithPrompts map[string][]string) *learnedClassifier {
+	c := &learnedClassifier{prompts: map[string]int{}, wordCounts: map[string]map[string]int{}, totals: map[string]int{}, vocabulary: map[string]bool{}}
+	for toolName, prompts := range toolNameWithPrompts {
+		verb := nameVerb(toolName)
+		if c.wordCounts[verb] == nil {
+			c.wordCounts[verb] = map[string]int{}
+		}
+		for _, p := range prompts {
+			c.prompts[verb]++
+			for _, w := range tokenize(p) {
+				c.wordCounts[verb][w]++
+				c.totals[verb]++
+				c.vocabulary[w] = true
+			}
+		}
+	}
+	return c
+}
+
+func (c *learnedClassifier) Classify(prompt string) []string {
+	total := 0
+	for _, n := range c.prompts {
+		total += n
+	}
+	best, bestScore := "", math.Inf(-1)
+	for _, verb := range slices.Sorted(maps.Keys(c.prompts)) {
+		score := math.Log(float64(c.prompts[verb]) / float64(total))
+		for _, w := range tokenize(prompt) {
+			if c.vocabulary[w] { // Words never seen in training carry no evidence
+				score += math.Log(float64(c.wordCounts[verb][w]+1) / float64(c.totals[verb]+len(c.vocabulary)))
+			}
+		}
+		if score > bestScore {
+			best, bestScore = verb, score
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return []string{best}
+}
+
+// intentSearcher has next rank every tool & then adds Boost to the score of each tool whose verb matches
+// the prompt's intent before re-sorting. Boost must suit the scale of next's scores.
+type intentSearcher struct {
+	db         *VectorDB
+	next       searcher
+	classifier intentClassifier
+	Boost      float32
+}
+
+func (s *intentSearcher) Unwrap() searcher { return s.next }
+
+func (s *intentSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	topK := o.TopK
+	o.TopK = getAllTools(s.db)
+	results := s.next.Search(prompt, vector, o)
+	if verbs := s.classifier.Classify(latestMessage(prompt)); len(verbs) > 0 {
+		for i, qr := range results {
+			if t, ok := qr.Entry.Metadata.(*mcp.Tool); ok && slices.Contains(verbs, toolVerb(t)) {
+				results[i].Score += s.Boost
+			}
+		}
+		slices.SortStableFunc(results, func(a, b QueryResult) int { return cmp.Compare(b.Score, a.Score) })
+	}
+	return results[:min(topK, len(results))]
+}
+
+// parseIntentOptions parses "rules" or "learned" optionally followed by ":name=value,..." where the names are
+// boost (added to matching tools' scores; default 0.05) & examples (required for learned: a JSON file of
+// training prompts with the structure of prompts.json, which must not be the prompts evaluated).
+func parseIntentOptions(spec string) (classifier intentClassifier, boost float32, err error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	boost, examples := 0.05, ""
+	for _, p := range strings.Split(params, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch name {
+		case "boost":
+			b, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid intent boost %q", value)
+			}
+			boost = float32(b)
+		case "examples":
+			examples = value
+		default:
+			return nil, 0, fmt.Errorf("unknown intent parameter %q; expected boost or examples", name)
+		}
+	}
+	switch kind {
+	case "rules":
+		return &ruleClassifier{Rules: defaultIntentRules}, boost, nil
+	case "learned":
+		if examples == "" {
+			return nil, 0, fmt.Errorf("the learned intent classifier requires examples, a training prompts file other than the evaluated prompts")
+		}
+		c := newLearnedClassifier(examplesByTool(loadPromptsFromJSON(examples)))
+		c.Examples = examples
+		return c, boost, nil
+	}
+	return nil, 0, fmt.Errorf("unknown intent classifier %q; expected rules or learned", kind)
+}
+
+// checkIntentExamples returns an error if s's learned intent classifier (if any) was trained on the prompts
+// file evaluated, which overstates its accuracy.
+func checkIntentExamples(s searcher, prompts string) error {
+	i, ok := findSearcher[*intentSearcher](s)
+	if !ok {
+		return nil
+	}
+	c, ok := i.classifier.(*learnedClassifier)
+	if !ok {
+		return nil
+	}
+	examples, errE := os.Stat(c.Examples)
+	evaluated, errP := os.Stat(prompts)
+	if errE == nil && errP == nil && os.SameFile(examples, evaluated) {
+		return fmt.Errorf("the learned intent classifier's examples are the evaluated prompts (%s); training on them "+
+			"overstates its accuracy", prompts)
+	}
+	return nil
+}
+
+// verbStats counts, for the prompts expecting a tool with one verb (the first acceptable tool's), how often the classifier recognized the
+// verb & how often the expected tool was ranked #1 without and with intent scoring.
+type verbStats struct {
+	Prompts    int
+	Classified int
+	Before     int
+	After      int
+}
+
+// reportVerbAccuracy reports, per verb of the expected tool, the accuracy without & with intent scoring.
+func reportVerbAccuracy(s *intentSearcher, testCases []testCase, o QueryOptions) {
+	o.TopK = cmp.Or(o.TopK, 10)
+	start := time.Now()
+	total, perVerb := verbStats{}, map[string]*verbStats{}
+	for _, c := range embedPromptCases(testCases) {
+		if c.IsNegative() {
+			continue
+		}
+		accepted := acceptedEntries(s.db, &c.testCase)
+		if len(accepted) == 0 {
+			log.Printf("Skipping case %s expecting unknown tools %s", c.ID, c.ExpectedString())
+			continue
+		}
+		verbs := []string{}
+		for _, e := range accepted {
+			verbs = append(verbs, toolVerb(e.Metadata.(*mcp.Tool)))
+		}
+		verb := verbs[0]
+		v, ok := perVerb[verb]
+		if !ok {
+			v = &verbStats{}
+			perVerb[verb] = v
+		}
+		classified := slices.ContainsFunc(s.classifier.Classify(c.Prompt), func(v string) bool { return slices.Contains(verbs, v) })
+		before := expectedRank(s.next.Search(c.Query(), c.Vector, o), &c.testCase) == 1
+		after := expectedRank(s.Search(c.Query(), c.Vector, o), &c.testCase) == 1
+		for _, v := range []*verbStats{&total, v} {
+			v.Prompts++
+			if classified {
+				v.Classified++
+			}
+			if before {
+				v.Before++
+			}
+			if after {
+				v.After++
+			}
+		}
+	}
+
+	verbs := slices.Sorted(maps.Keys(perVerb))
+	if isMarkdownOutput() {
+		fmt.Println("## Intent Scoring")
+		fmt.Println()
+		fmt.Println("| Verb | Prompts | Intent Recognized | Accuracy Without Intent | Accuracy With Intent |")
+		fmt.Println("|------|---------|-------------------|-------------------------|----------------------|")
+		for _, verb := range verbs {
+			v := perVerb[verb]
+			fmt.Printf("| `%s` | %d | %.1f%% | %.1f%% | %.1f%% |\n", verb, v.Prompts,
+				percent(v.Classified, v.Prompts), percent(v.Before, v.Prompts), percent(v.After, v.Prompts))
+		}
+		fmt.Printf("| **All** | %d | %.1f%% | %.1f%% | %.1f%% |\n", total.Prompts,
+			percent(total.Classified, total.Prompts), percent(total.Before, total.Prompts), percent(total.After, total.Prompts))
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nIntent scoring: boost=%g\n", s.Boost)
+		fmt.Printf("   %-12s %8s %10s %9s %9s\n", "Verb", "Prompts", "Recognized", "Without", "With")
+		for _, verb := range verbs {
+			v := perVerb[verb]
+			fmt.Printf("   %-12s %8d %9.1f%% %8.1f%% %8.1f%%\n", verb, v.Prompts,
+				percent(v.Classified, v.Prompts), percent(v.Before, v.Prompts), percent(v.After, v.Prompts))
+		}
+		fmt.Printf("   %-12s %8d %9.1f%% %8.1f%% %8.1f%%\n", "(all)", total.Prompts,
+			percent(total.Classified, total.Prompts), percent(total.Before, total.Prompts), percent(total.After, total.Prompts))
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+func TestRuleClassifier(t *testing.T) {
+	c := &ruleClassifier{Rules: defaultIntentRules}
+	tests := []struct {
+		prompt string
+		want   []string
+	}{
+		{"Unlock the key-value pair", []string{"unlock"}}, // Not a lock
+		{"Lock the setting", []string{"lock"}},
+		{"Please REMOVE the cache", []string{"delete"}},
+		{"Show me all the storage accounts", []string{"list"}}, // Not a get
+		{"Enable soft delete on the vault", []string{"delete"}},
+		{"Change the setting's value", []string{"set", "setparam"}},
+		{"Find the logs with errors", []string{"query"}},
+		{"Describe the cluster", defaultIntentRules[len(defaultIntentRules)-1].Verbs},
+		{"The locked storage accounts", nil}, // Only whole words match
+		{"Hello", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			if got := c.Classify(tt.prompt); !slices.Equal(got, tt.want) {
+				t.Errorf("got verbs %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLearnedClassifier(t *testing.T) {
+	c := newLearnedClassifier(map[string][]string{
+		"azmcp-storage-account-list":      {"List my storage accounts", "Enumerate the accounts in my subscription", "Which accounts do I have", "Show all my accounts"},
+		"azmcp-storage-account-delete":    {"Delete the storage account", "Remove the account named prod"},
+		"server/azmcp-redis-cache-delete": {"Delete the Redis cache"}, // The verb of a server-qualified tool
+	})
+	tests := []struct {
+		prompt string
+		want   []string
+	}{
+		{"Delete the account named test", []string{"delete"}},
+		{"Enumerate my storage accounts", []string{"list"}},
+		{"Accounts", []string{"list"}},         // The verb with the most examples of the word
+		{"Hello there", []string{"list"}},      // With no known words, the verb with the most examples
+		{"remove a cache", []string{"delete"}}, // Words are compared without case
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			if got := c.Classify(tt.prompt); !slices.Equal(got, tt.want) {
+				t.Errorf("got verbs %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := newLearnedClassifier(nil).Classify("Delete the account"); got != nil {
+		t.Errorf("an untrained classifier returned %v, want nil", got)
+	}
+}
+
+func TestIntentSearcher(t *testing.T) {
+	tools := []mcp.Tool{
+		newTestTool("azmcp-storage-account-get", ""),
+		newTestTool("azmcp-storage-account-delete", ""),
+		newTestTool("azmcp-storage-account-list", ""),
+	}
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	for i, v := range [][]float32{{1, 0}, {0.96, 0.28}, {0.8, 0.6}} {
+		db.Upsert(&Entry{ID: entryID(&tools[i]), Metadata: &tools[i], Vector: v})
+	}
+	s := &intentSearcher{db: db, next: vectorSearcher{db: db}, classifier: &ruleClassifier{Rules: defaultIntentRules}, Boost: 0.1}
+	tests := []struct {
+		name, prompt string
+		topK         int
+		want         []ID
+	}{
+		{"boosted past a closer tool", "Delete the account", 3,
+			[]ID{"azmcp-storage-account-delete", "azmcp-storage-account-get", "azmcp-storage-account-list"}},
+		{"boosted from beyond TopK", "Delete the account", 1, []ID{"azmcp-storage-account-delete"}},
+		{"boosted too little", "List the account", 1, []ID{"azmcp-storage-account-get"}},
+		{"no intent", "The account", 3, []ID{"azmcp-storage-account-get", "azmcp-storage-account-delete", "azmcp-storage-account-list"}},
+		// Only the latest message of a conversation is classified
+		{"conversation", conversationContext.Text([]conversationTurn{{Role: "user", Content: "Delete the account"}}, "The account"), 1,
+			[]ID{"azmcp-storage-account-get"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultIDs(s.Search(tt.prompt, []float32{1, 0}, QueryOptions{TopK: tt.topK})); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
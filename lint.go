@@ -0,0 +1,197 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// lint checks the tools & the test prompts for problems that make selection (or its evaluation) unreliable:
+// missing or terse descriptions, near-duplicate tools, malformed schemas & test cases naming unknown tools.
+
+type lintSeverity string
+
+const (
+	lintError   lintSeverity = "error"
+	lintWarning lintSeverity = "warning"
+)
+
+type lintFinding struct {
+	Severity lintSeverity
+	Subject  string // The tool or case with the problem
+	Message  string
+}
+
+// lintOptions are lintTools' thresholds.
+type lintOptions struct {
+	MinWords   int     // Descriptions with fewer words are too terse
+	Similarity float32 // Tools whose vectors are at least this close (by the DB's metric) are near-duplicates; 0 disables the check
+}
+
+// lintTools checks each tool's name, description & inputSchema and, using db's vectors, which tools are
+// near-duplicates of each other.
+func lintTools(tools []mcp.Tool, db *VectorDB, o lintOptions) []lintFinding {
+	findings := []lintFinding{}
+	add := func(severity lintSeverity, subject, format string, args ...any) {
+		findings = append(findings, lintFinding{Severity: severity, Subject: subject, Message: fmt.Sprintf(format, args...)})
+	}
+	seen := map[ID]bool{}
+	for i := range tools {
+		t := &tools[i]
+		id := entryID(t)
+		if seen[id] {
+			add(lintError, string(id), "duplicate tool name")
+		}
+		seen[id] = true
+		switch d := newToolDocument(t); {
+		case strings.TrimSpace(d.Description) == "":
+			add(lintError, string(id), "no description")
+		case len(words(d.Description)) < o.MinWords:
+			add(lintWarning, string(id), "description has only %d words", len(words(d.Description)))
+		default:
+			for _, p := range d.RequiredParameters() {
+				if strings.TrimSpace(p.Description) == "" {
+					add(lintWarning, string(id), "required parameter %q has no description", p.Name)
+				}
+			}
+		}
+		schema := map[string]any{}
+		if err := json.Unmarshal(t.InputSchema, &schema); err != nil {
+			add(lintError, string(id), "inputSchema isn't a JSON object: %v", err)
+		} else if schema["type"] != "object" {
+			add(lintError, string(id), `inputSchema's type is %v, not "object"`, schema["type"])
+		}
+	}
+
+	if o.Similarity > 0 {
+		db.mu.RLock()
+		entries := db.entries
+		for i, a := range entries {
+			for _, b := range entries[i+1:] {
+				if s := db.distanceMetric.Distance(a.Vector, b.Vector); !closer(db.distanceMetric, o.Similarity, s) {
+					add(lintWarning, string(a.ID), "nearly the same as %s (similarity %.4f); prompts may not tell them apart", b.ID, s)
+				}
+			}
+		}
+		db.mu.RUnlock()
+	}
+	return findings
+}
+
+// lintCases checks that each case names only tools in db, that IDs & prompts are unique, and reports tools
+// that no case expects.
+func lintCases(cases []testCase, db *VectorDB) []lintFinding {
+	findings := []lintFinding{}
+	add := func(severity lintSeverity, subject, format string, args ...any) {
+		findings = append(findings, lintFinding{Severity: severity, Subject: subject, Message: fmt.Sprintf(format, args...)})
+	}
+	db.mu.RLock()
+	entries := slices.Clone(db.entries)
+	db.mu.RUnlock()
+	known := func(name string) bool {
+		return slices.ContainsFunc(entries, func(e *Entry) bool { return matchesExpected(e, name) })
+	}
+
+	ids, prompts, expected := map[string]bool{}, map[string]string{}, map[ID]bool{}
+	for _, c := range cases {
+		if ids[c.ID] {
+			add(lintError, c.ID, "duplicate case ID")
+		}
+		ids[c.ID] = true
+		if other, ok := prompts[strings.ToLower(c.Prompt)]; ok {
+			add(lintWarning, c.ID, "same prompt as case %s", other)
+		} else {
+			prompts[strings.ToLower(c.Prompt)] = c.ID
+		}
+		for _, name := range c.Expected {
+			if !known(name) {
+				add(lintError, c.ID, "expects unknown tool %s", name)
+			}
+			if slices.Contains(c.Forbidden, name) {
+				add(lintError, c.ID, "both expects & forbids %s", name)
+			}
+		}
+		for _, name := range c.Forbidden {
+			if !known(name) {
+				add(lintWarning, c.ID, "forbids unknown tool %s", name)
+			}
+		}
+		for _, e := range entries {
+			if c.Accepts(e) {
+				expected[e.ID] = true
+			}
+		}
+	}
+	for _, e := range entries {
+		if !expected[e.ID] {
+			add(lintWarning, string(e.ID), "no case expects this tool")
+		}
+	}
+	return findings
+}
+
+// runLint reports the problems lintTools & lintCases find; it exits with status 1 if any is an error.
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	f := addSelectionFlags(fs, 0)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts (v1 or v2 format)")
+	o := lintOptions{}
+	fs.IntVar(&o.MinWords, "min-words", 5, "descriptions with fewer words are reported as too terse")
+	similarity := fs.Float64("similarity", 0.95, "tools whose vectors are at least this similar are reported as near-duplicates; "+
+		"0 skips the check (& embedding the tools)")
+	must(0, fs.Parse(args))
+	o.Similarity = float32(*similarity)
+	io, _, err := f.setup()
+	if err != nil {
+		log.Fatalf("lint: %v", err)
+	}
+
+	var tools []mcp.Tool
+	db := NewVectorDB(distanceMetrics[f.Metric], nil)
+	if o.Similarity > 0 {
+		tools, db, _ = f.loadOrBuildIndex(io)
+	} else {
+		tools = loadToolsFromJSON(f.Tools)
+		for i := range tools { // Entries without vectors so the cases can be checked against the tools
+			db.Upsert(&Entry{ID: entryID(&tools[i]), Metadata: &tools[i]})
+		}
+	}
+	findings := append(lintTools(tools, db, o), lintCases(loadPromptsFromJSON(*prompts), db)...)
+	slices.SortStableFunc(findings, func(a, b lintFinding) int {
+		return cmp.Or(cmp.Compare(a.Severity, b.Severity), cmp.Compare(a.Subject, b.Subject))
+	})
+
+	counts := map[lintSeverity]int{}
+	if isMarkdownOutput() {
+		fmt.Println("# Lint")
+		fmt.Println()
+		if len(findings) > 0 {
+			fmt.Println("| Severity | Tool or Case | Problem |")
+			fmt.Println("|----------|--------------|---------|")
+		}
+	}
+	for _, finding := range findings {
+		counts[finding.Severity]++
+		if isMarkdownOutput() {
+			fmt.Printf("| %s | `%s` | %s |\n", finding.Severity, finding.Subject, finding.Message)
+		} else {
+			fmt.Printf("%s: %s: %s\n", finding.Severity, finding.Subject, finding.Message)
+		}
+	}
+	if isMarkdownOutput() {
+		fmt.Println()
+		fmt.Printf("**Errors:** %d, **Warnings:** %d  \n", counts[lintError], counts[lintWarning])
+	} else {
+		fmt.Printf("\nErrors=%d, Warnings=%d\n", counts[lintError], counts[lintWarning])
+	}
+	if counts[lintError] > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,10 +21,63 @@ import (
 	"github.com/joho/godotenv"
 )
 
-// isMarkdownOutput checks if the output should be in markdown format
-// Only checks for output=md environment variable
+// parseIndexOptions returns the index options for:
+//   - document: a built-in document builder's name or a text/template (default: description)
+//   - vectors: comma-separated additional vectors per tool: name, parameters
+//   - examples: a JSON file of example prompts per tool (same structure as prompts.json); "" for none
+func parseIndexOptions(document, vectors, examples string) (*indexOptions, error) {
+	builder, err := lookupDocumentBuilder(document)
+	if err != nil {
+		return nil, err
+	}
+	o := &indexOptions{Builder: builder}
+	for _, v := range strings.Split(vectors, ",") {
+		switch strings.TrimSpace(v) {
+		case "":
+		case "name":
+			o.NameVector = true
+		case "parameters":
+			o.ParameterVectors = true
+		default:
+			return nil, fmt.Errorf("unknown vector %q; expected name or parameters", v)
+		}
+	}
+	if examples != "" {
+		o.Examples = examplesByTool(loadPromptsFromJSON(examples))
+	}
+	return o, nil
+}
+
+// parseAggregation parses "max" (or ""), "mean" or "weighted-sum:group=weight,..." (e.g.
+// "weighted-sum:primary=1,name=0.5,example=2") into an Aggregation & its weights.
+func parseAggregation(spec string) (Aggregation, map[string]float32, error) {
+	name, weightList, _ := strings.Cut(spec, ":")
+	switch name {
+	case "", "max":
+		return AggregateMax, nil, nil
+	case "mean":
+		return AggregateMean, nil, nil
+	case "weighted-sum":
+		weights := map[string]float32{}
+		for _, w := range strings.Split(weightList, ",") {
+			group, value, ok := strings.Cut(strings.TrimSpace(w), "=")
+			f, err := strconv.ParseFloat(value, 32)
+			if !ok || err != nil {
+				return 0, nil, fmt.Errorf("invalid weight %q in aggregation %q; expected group=number", w, spec)
+			}
+			weights[group] = float32(f)
+		}
+		return AggregateWeightedSum, weights, nil
+	}
+	return 0, nil, fmt.Errorf("unknown aggregation %q; expected max, mean or weighted-sum:group=weight,...", spec)
+}
+
+// outputFormat is the output format set by the -format flag.
+var outputFormat string
+
+// isMarkdownOutput checks if the output should be in markdown format (-format md)
 func isMarkdownOutput() bool {
-	return strings.ToLower(os.Getenv("output")) == "md"
+	return strings.ToLower(outputFormat) == "md"
 }
 
 // getAllTools returns the total number of tools in the database
@@ -28,21 +87,6 @@ func getAllTools(db *VectorDB) int {
 	return len(db.entries)
 }
 
-// calculateSuccessRate calculates how many tests passed (expected tool was ranked #1)
-func calculateSuccessRate(db *VectorDB, toolNameWithPrompts map[string][]string) int {
-	successfulTests := 0
-	for toolName, prompts := range toolNameWithPrompts {
-		for _, p := range prompts {
-			vector := createEmbeddings(p)
-			queryResults := db.Query(vector, QueryOptions{TopK: 1})
-			if len(queryResults) > 0 && string(queryResults[0].Entry.ID) == toolName {
-				successfulTests++
-			}
-		}
-	}
-	return successfulTests
-}
-
 func main() {
 	// Load environment variables from .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -50,20 +94,61 @@ func main() {
 		log.Printf("No .env file found or error loading it: %v", err)
 	}
 
-	listToolsResult := mcp.ListToolsResult{}
-	{
-		toolsListResultJson := string(must(os.ReadFile("list-tools.json")))
-		toolsListResultJson = toolsListResultJson[1 : len(toolsListResultJson)-1]    // Remove the first and last characters (quotes)
-		toolsListResultJson = strings.ReplaceAll(toolsListResultJson, "\\'", "'")    // Convert \' --> '
-		toolsListResultJson = strings.ReplaceAll(toolsListResultJson, "\\\\\"", "'") // Convert \\" --> '
-		err := json.Unmarshal(([]byte)(toolsListResultJson), &listToolsResult)
-		_ = err
-		//fmt.Println(err)
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		runEval(os.Args[1:])
+		return
+	}
+	switch os.Args[1] {
+	case "proxy", "find-tools": // Before serve
+		runServe(os.Args[1:])
+		return
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	}
+	for _, c := range commands() {
+		if c.name == os.Args[1] {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+// runEval runs the test prompts & reports how well tools are selected with the searcher the flags compose,
+// followed by the extra reports the flags & the searcher's stages call for.
+func runEval(args []string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	f := addSelectionFlags(fs, 10)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts (v1 or v2 format)")
+	outOfScope := fs.String("out-of-scope", "", "JSON array of off-topic prompts for which no tool should be selected")
+	calibrationMethod := fs.String("calibration", "", "fit a calibration of scores into confidences: platt or isotonic")
+	overrides := fs.String("overrides", "", `JSON file of tools' new descriptions & titles, `+
+		`{"tool-name": {"description": "...", "title": "..."}, ...}, compared side by side with the unmodified tools`)
+	budget := fs.String("budget", "", "comma-separated token budgets to report the recall & size of the tools selected within")
+	placeholders := fs.Int("placeholders", 0, "if > 0, also run each prompt with placeholders like <account_name> "+
+		"this many times with generated values & report how robust selection is")
+	placeholderValues := fs.String("placeholder-values", "", `JSON file of values per placeholder, `+
+		`{"placeholder_name": ["value", ...], ...}, replacing the built-in values of the placeholders it lists`)
+	must(0, fs.Parse(args))
+	indexOptions, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("eval: %v", err)
+	}
+	if *placeholders < 0 {
+		log.Fatalf("eval: invalid placeholders %d; expected the number of instantiations per prompt", *placeholders)
+	}
+	budgets := []int(nil)
+	if *budget != "" {
+		if budgets, err = parseBudgets(*budget); err != nil {
+			log.Fatalf("eval: %v", err)
+		}
 	}
 
-	db := NewVectorDB(CosineSimilarity{}, nil)
 	start := time.Now()
-	tools2DB(db, listToolsResult.Tools)
+	tools, db, cal := f.loadOrBuildIndex(indexOptions)
 	toolCount := getAllTools(db)
 	executionTime := time.Since(start)
 
@@ -86,43 +171,145 @@ func main() {
 	}
 
 	// Load prompts from JSON file
-	toolNameAndPrompts := loadPromptsFromJSON("prompts.json")
-	runPrompts(db, toolNameAndPrompts)
+	testCases := loadPromptsFromJSON(*prompts)
+	if *outOfScope != "" {
+		testCases = append(testCases, loadOutOfScopeFromJSON(*outOfScope)...)
+	}
+	s := f.search.build(db, tools, indexOptions)
+	if err := checkIntentExamples(s, *prompts); err != nil {
+		log.Fatalf("eval: %v", err)
+	}
+	if *calibrationMethod != "" {
+		perCase := collectCalibrationSamples(s, db, embedPromptCases(testCases), o)
+		c, err := fitCalibration(*calibrationMethod, slices.Concat(perCase...))
+		if err != nil {
+			log.Fatalf("eval: %v", err)
+		}
+		c.Searcher, cal = searcherStages(s), c
+		if f.Index != "" {
+			must(0, saveIndex(f.Index, db, indexOptions, cal))
+		}
+	}
+	if err := cal.Check(s); err != nil {
+		log.Fatalf("eval: %v", err)
+	}
+	runPrompts(db, s, cal, testCases, o)
+	if *overrides != "" {
+		if err := reportWhatIf(*overrides, f.search, s, tools, db, indexOptions, testCases, o); err != nil {
+			log.Fatalf("eval: %v", err)
+		}
+	}
+	if h, ok := findSearcher[*hierarchicalSearcher](s); ok {
+		reportGroupAccuracy(h, testCases, o)
+	}
+	if i, ok := findSearcher[*intentSearcher](s); ok {
+		reportVerbAccuracy(i, testCases, o)
+	}
+	if r, ok := findSearcher[*rerankSearcher](s); ok {
+		reportReranking(r, testCases, o)
+	}
+	if safety, ok := findSearcher[*safetySearcher](s); ok {
+		reportSafety(safety, db, testCases, o)
+	}
+	if len(queryRewriters) > 0 {
+		reportRewrites(s, queryRewriters, testCases, o)
+	}
+	if slices.ContainsFunc(testCases, func(c testCase) bool { return len(c.Conversation) > 0 }) {
+		reportConversations(s, testCases, o)
+	}
+	if len(budgets) > 0 {
+		reportBudgets(s, db, testCases, o, budgets, f.Tokenizer)
+	}
+	if *placeholders > 0 {
+		g := &placeholderGenerator{Values: maps.Clone(defaultPlaceholderValues)}
+		if *placeholderValues != "" {
+			maps.Copy(g.Values, loadPlaceholderValues(*placeholderValues))
+		}
+		reportPlaceholderRobustness(s, g, *placeholders, testCases, o)
+	}
+	if slices.ContainsFunc(testCases, func(c testCase) bool { return c.IsNegative() }) {
+		reportRejectionThreshold(s, db, testCases, o)
+	}
+	if cal != nil {
+		reportCalibration(s, db, *calibrationMethod, cal, testCases, o)
+	}
+}
+
+// loadToolsFromJSON loads the tools from a file containing the (quoted) JSON of a tools/list result.
+func loadToolsFromJSON(filename string) []mcp.Tool {
+	listToolsResult := mcp.ListToolsResult{}
+	toolsListResultJson := string(must(os.ReadFile(filename)))
+	toolsListResultJson = toolsListResultJson[1 : len(toolsListResultJson)-1]    // Remove the first and last characters (quotes)
+	toolsListResultJson = strings.ReplaceAll(toolsListResultJson, "\\'", "'")    // Convert \' --> '
+	toolsListResultJson = strings.ReplaceAll(toolsListResultJson, "\\\\\"", "'") // Convert \\" --> '
+	err := json.Unmarshal(([]byte)(toolsListResultJson), &listToolsResult)
+	_ = err
+	//fmt.Println(err)
+	return listToolsResult.Tools
+}
+
+// saveToolsToJSON saves the tools as the (quoted) JSON of a tools/list result that loadToolsFromJSON loads.
+func saveToolsToJSON(filename string, tools []mcp.Tool) error {
+	buf := &bytes.Buffer{}
+	if err := marshalJSON(buf, mcp.ListToolsResult{Tools: tools}); err != nil {
+		return err
+	}
+	quoted := "'" + strings.ReplaceAll(buf.String(), "'", `\'`) + "'"
+	return os.WriteFile(filename, []byte(quoted), 0o644)
 }
 
-func tools2DB(db *VectorDB, tools []mcp.Tool) {
+// tools2DB embeds the tools into db; the tools embedded before an error are left in db.
+func tools2DB(db *VectorDB, tools []mcp.Tool, o *indexOptions) error {
 	const threshold = 2         // Each goroutine processes at most 'threshold' entries
 	if len(tools) > threshold { // https://www.youtube.com/watch?v=P1tREHhINH4
 		half := len(tools) / 2 // Split the entries in half
 		wg := sync.WaitGroup{}
+		var leftErr error
 		// This goroutine processes half; 0 to (half-1) inclusive
 		// wg.Do(func() { leftResult = db.querySlice(entries[:half], vector, o) })
 		{ // Delete this {} block when wg.Do exists
 			wg.Add(1)
 			go func() { // This goroutine processes half
 				defer wg.Done()
-				tools2DB(db, tools[:half]) // 0 to (half-1) inclusive
+				leftErr = tools2DB(db, tools[:half], o) // 0 to (half-1) inclusive
 			}()
 		}
 		// The current goroutine processes the other half
-		tools2DB(db, tools[half:]) // half to (len-1) inclusive
-		wg.Wait()                  // Wait for the left goroutine to finish
-		return                     // All tools processed
+		err := tools2DB(db, tools[half:], o) // half to (len-1) inclusive
+		wg.Wait()                            // Wait for the left goroutine to finish
+		return cmp.Or(leftErr, err)          // All tools processed
 	}
 
 	for _, t := range tools {
-		_, _, input := t.Name, t.Title, *t.Description
-		vector := createEmbeddings(input)
-		db.Upsert(&Entry{ID: ID(t.Name), Metadata: &t, Vector: vector})
+		document, extras, err := o.documents(&t)
+		if err != nil {
+			return err
+		}
+		vectors := []NamedVector(nil)
+		for _, e := range extras {
+			vector, err := createEmbeddings(e.Text)
+			if err != nil {
+				return err
+			}
+			vectors = append(vectors, NamedVector{Name: e.Name, Vector: vector})
+		}
+		vector, err := createEmbeddings(document)
+		if err != nil {
+			return err
+		}
+		db.Upsert(&Entry{ID: entryID(&t), Metadata: &t, Vector: vector, Vectors: vectors})
 	}
+	return nil
 }
 
-func createEmbeddings(input string) []float32 {
+// aoaiEmbeddings embeds input with the Azure OpenAI embeddings deployment at AOAI_ENDPOINT. A missing
+// configuration, a failure to connect & a throttled or unavailable service wrap errEmbedderUnavailable.
+func aoaiEmbeddings(input string) ([]float32, error) {
 	// Docs: https://learn.microsoft.com/en-us/azure/ai-services/openai/reference#embeddings
 
 	uri := os.Getenv("AOAI_ENDPOINT")
 	if uri == "" {
-		log.Fatalf("AOAI_ENDPOINT environment variable is required")
+		return nil, fmt.Errorf("%w: AOAI_ENDPOINT environment variable is required", errEmbedderUnavailable)
 	}
 	//const deploymentName = "text-embedding-3-large"
 
@@ -132,7 +319,8 @@ func createEmbeddings(input string) []float32 {
 		// Try to read from file as fallback
 		keyBytes, err := os.ReadFile("api-key.txt")
 		if err != nil {
-			log.Fatalf("API key not found. Please set TEXT_EMBEDDING_API_KEY environment variable or create api-key.txt file: %v", err)
+			return nil, fmt.Errorf("%w: API key not found. Please set TEXT_EMBEDDING_API_KEY environment variable or create api-key.txt file: %v",
+				errEmbedderUnavailable, err)
 		}
 		apiKey = strings.TrimSpace(string(keyBytes))
 	}
@@ -146,13 +334,19 @@ func createEmbeddings(input string) []float32 {
 
 	reqBodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
-		log.Fatalf("Failed to marshal request body: %v", err)
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req := must(http.NewRequest(http.MethodPost, uri, strings.NewReader(string(reqBodyBytes))))
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(string(reqBodyBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbedderUnavailable, err) // AOAI_ENDPOINT is malformed
+	}
 	req.Header.Add("api-key", apiKey)
 	req.Header.Add("Content-Type", "application/json")
-	response := must(http.DefaultClient.Do(req))
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbedderUnavailable, err)
+	}
 
 	embedResponse := struct {
 		Data []struct {
@@ -164,27 +358,32 @@ func createEmbeddings(input string) []float32 {
 			Type    string `json:"type"`
 		} `json:"error"`
 	}{}
-	bytes := must(io.ReadAll(response.Body))
+	bytes, err := io.ReadAll(response.Body)
 	response.Body.Close()
-
-	must(0, json.Unmarshal(bytes, &embedResponse))
-
-	// Check for API errors
-	if embedResponse.Error != nil {
-		log.Fatalf("API error: %s - %s", embedResponse.Error.Type, embedResponse.Error.Message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbedderUnavailable, err)
 	}
 
-	// Check if we have data
-	if len(embedResponse.Data) == 0 {
-		log.Fatalf("No embedding data returned from API. Response: %s", string(bytes))
+	// Check for API errors
+	unmarshalErr := json.Unmarshal(bytes, &embedResponse)
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable:
+		return nil, fmt.Errorf("%w: %s: %s", errEmbedderUnavailable, response.Status, string(bytes))
+	case embedResponse.Error != nil:
+		return nil, fmt.Errorf("API error: %s - %s", embedResponse.Error.Type, embedResponse.Error.Message)
+	case unmarshalErr != nil:
+		return nil, fmt.Errorf("invalid embeddings response (%s): %w", response.Status, unmarshalErr)
+	case len(embedResponse.Data) == 0: // Check if we have data
+		return nil, fmt.Errorf("no embedding data returned from API. Response: %s", string(bytes))
 	}
-
-	return embedResponse.Data[0].Embedding
+	return embedResponse.Data[0].Embedding, nil
 }
 
-func runPrompts(db *VectorDB, toolNameWithPrompts map[string][]string) {
+// runPrompts runs & reports every case; if cal isn't nil, each result's confidence is reported too.
+func runPrompts(db *VectorDB, s searcher, cal *calibration, testCases []testCase, o QueryOptions) {
+	o.TopK = cmp.Or(o.TopK, 10)
 	start := time.Now()
-	promptCount := 0
+	promptCount, successfulTests := 0, 0
 
 	// Check if output should use markdown format
 	useMarkdown := isMarkdownOutput()
@@ -200,67 +399,115 @@ func runPrompts(db *VectorDB, toolNameWithPrompts map[string][]string) {
 		fmt.Println()
 
 		// Generate TOC
-		toolIndex := 1
-		for toolName, prompts := range toolNameWithPrompts {
-			for range prompts {
-				fmt.Printf("- [Test %d: %s](#test-%d)\n", toolIndex, toolName, toolIndex)
-				toolIndex++
-			}
+		for i, c := range testCases {
+			fmt.Printf("- [Test %d: %s](#test-%d)\n", i+1, c.ID, i+1)
 		}
 		fmt.Println()
 		fmt.Println("---")
 		fmt.Println()
 	}
 
-	testNumber := 1
-	for toolName, prompts := range toolNameWithPrompts {
-		for _, p := range prompts {
-			promptCount++
-
-			if useMarkdown {
-				// Markdown format
-				fmt.Printf("## Test %d\n", testNumber)
-				fmt.Println()
-				fmt.Printf("**Expected Tool:** `%s`  \n", toolName)
-				fmt.Printf("**Prompt:** %s  \n", p)
-				fmt.Println()
-				fmt.Println("### Results")
-				fmt.Println()
+	tagStats := map[string][2]int{} // Tag -> {passed, total}
+	for testNumber, c := range testCases {
+		promptCount++
+
+		if useMarkdown {
+			// Markdown format
+			fmt.Printf("## Test %d\n", testNumber+1)
+			fmt.Println()
+			fmt.Printf("**Case:** `%s`  \n", c.ID)
+			fmt.Printf("**Expected Tool:** `%s`  \n", c.ExpectedString())
+			if len(c.Forbidden) > 0 {
+				fmt.Printf("**Forbidden Tools:** `%s`  \n", strings.Join(c.Forbidden, " | "))
+			}
+			if c.NoToolAbove != nil {
+				fmt.Printf("**No Tool Above:** %.6f  \n", *c.NoToolAbove)
+			}
+			if len(c.Tags) > 0 {
+				fmt.Printf("**Tags:** %s  \n", strings.Join(c.Tags, ", "))
+			}
+			for _, t := range c.Conversation {
+				fmt.Printf("**%s:** %s  \n", strings.ToUpper(string(t.Role[:1]))+string(t.Role[1:]), t.Content)
+			}
+			fmt.Printf("**Prompt:** %s  \n", c.Prompt)
+			fmt.Println()
+			fmt.Println("### Results")
+			fmt.Println()
+			if cal != nil {
+				fmt.Println("| Rank | Score | Confidence | Tool | Status |")
+				fmt.Println("|------|-------|------------|------|--------|")
+			} else {
 				fmt.Println("| Rank | Score | Tool | Status |")
 				fmt.Println("|------|-------|------|--------|")
-			} else {
-				// Original terminal format
-				fmt.Printf("\nPrompt: %s\nExpected tool: %s", p, toolName)
 			}
+		} else {
+			// Original terminal format
+			fmt.Println()
+			for _, t := range c.Conversation {
+				fmt.Printf("%s: %s\n", t.Role, t.Content)
+			}
+			fmt.Printf("Prompt: %s\nExpected tool: %s", c.Prompt, c.ExpectedString())
+		}
 
-			vector := createEmbeddings(p)
-			queryResults := db.Query(vector, QueryOptions{TopK: 10})
-
-			for i, qr := range queryResults {
-				if useMarkdown {
-					status := ""
-					if string(qr.Entry.ID) == toolName {
-						status = "✅ **EXPECTED**"
-					} else {
-						status = "❌"
-					}
+		vector := mustEmbed(c.Embed())
+		queryResults, confidences := cal.Search(s, db, c.Query(), vector, o)
+
+		for i, qr := range queryResults {
+			if useMarkdown {
+				status := ""
+				switch {
+				case c.Accepts(qr.Entry):
+					status = "✅ **EXPECTED**"
+				case c.Forbids(qr.Entry):
+					status = "⛔ **FORBIDDEN**"
+				default:
+					status = "❌"
+				}
+				if confidences != nil {
+					fmt.Printf("| %d | %.6f | %.1f%% | `%s` | %s |\n", i+1, qr.Score, confidences[i]*100, qr.Entry.ID, status)
+				} else {
 					fmt.Printf("| %d | %.6f | `%s` | %s |\n", i+1, qr.Score, qr.Entry.ID, status)
+				}
+			} else {
+				note := ""
+				switch {
+				case c.Accepts(qr.Entry):
+					note = "*** EXPECTED ***"
+				case c.Forbids(qr.Entry):
+					note = "*** FORBIDDEN ***"
+				}
+				if confidences != nil {
+					fmt.Printf("\n   %f   %5.1f%%   %-50s     %s", qr.Score, confidences[i]*100, qr.Entry.ID, note)
 				} else {
-					note := ""
-					if string(qr.Entry.ID) == toolName {
-						note = "*** EXPECTED ***"
-					}
 					fmt.Printf("\n   %f   %-50s     %s", qr.Score, qr.Entry.ID, note)
 				}
 			}
+		}
 
-			if useMarkdown {
-				fmt.Println()
-				fmt.Println("---")
-				fmt.Println()
+		passed := c.Passed(queryResults)
+		if passed {
+			successfulTests++
+		}
+		for _, tag := range c.Tags {
+			stats := tagStats[tag]
+			if passed {
+				stats[0]++
 			}
-
-			testNumber++
+			stats[1]++
+			tagStats[tag] = stats
+		}
+		if useMarkdown {
+			fmt.Println()
+			if passed {
+				fmt.Println("**Result:** ✅ PASSED")
+			} else {
+				fmt.Println("**Result:** ❌ FAILED")
+			}
+			fmt.Println()
+			fmt.Println("---")
+			fmt.Println()
+		} else if !passed {
+			fmt.Printf("\n   FAILED")
 		}
 	}
 
@@ -271,8 +518,6 @@ func runPrompts(db *VectorDB, toolNameWithPrompts map[string][]string) {
 		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
 		fmt.Println()
 
-		// Calculate success rate
-		successfulTests := calculateSuccessRate(db, toolNameWithPrompts)
 		successRate := float64(successfulTests) / float64(promptCount) * 100
 		fmt.Printf("**Success Rate:** %.1f%% (%d/%d tests passed)  \n", successRate, successfulTests, promptCount)
 		fmt.Println()
@@ -289,8 +534,24 @@ func runPrompts(db *VectorDB, toolNameWithPrompts map[string][]string) {
 			fmt.Println("🔴 **Poor** - The tool selection system requires major improvements.")
 		}
 		fmt.Println()
+
+		if len(tagStats) > 0 {
+			fmt.Println("### Success Rate by Tag")
+			fmt.Println()
+			fmt.Println("| Tag | Passed | Success Rate |")
+			fmt.Println("|-----|--------|--------------|")
+			for _, tag := range slices.Sorted(maps.Keys(tagStats)) {
+				stats := tagStats[tag]
+				fmt.Printf("| `%s` | %d/%d | %.1f%% |\n", tag, stats[0], stats[1], percent(stats[0], stats[1]))
+			}
+			fmt.Println()
+		}
 	} else {
 		fmt.Printf("\n\nPrompt count=%d, Execution time=%v\n", promptCount, time.Since(start))
+		for _, tag := range slices.Sorted(maps.Keys(tagStats)) {
+			stats := tagStats[tag]
+			fmt.Printf("   Tag %s: %d/%d passed (%.1f%%)\n", tag, stats[0], stats[1], percent(stats[0], stats[1]))
+		}
 	}
 }
 
@@ -300,20 +561,3 @@ func must[R any](r R, err error) R {
 	}
 	return r
 }
-
-// loadPromptsFromJSON loads the tool prompts from a JSON file.
-// The JSON structure should be: {"tool-name": ["prompt1", "prompt2", ...], ...}
-// This allows for easy modification of test prompts without recompiling the application.
-func loadPromptsFromJSON(filename string) map[string][]string {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		log.Fatalf("Failed to read prompts file %s: %v", filename, err)
-	}
-
-	var prompts map[string][]string
-	if err := json.Unmarshal(data, &prompts); err != nil {
-		log.Fatalf("Failed to parse prompts JSON from %s: %v", filename, err)
-	}
-
-	return prompts
-}
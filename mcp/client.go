@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Method names used by the client & server in this package
+const (
+	MethodInitialize             = "initialize"
+	MethodPing                   = "ping"
+	MethodToolsList              = "tools/list"
+	MethodToolsCall              = "tools/call"
+	NotificationInitialized      = "notifications/initialized"
+	NotificationToolsListChanged = "notifications/tools/list_changed"
+	NotificationCancelled        = "notifications/cancelled"
+)
+
+// Client is an MCP client connected to a single server.
+type Client struct {
+	conn         *Conn
+	ServerInfo   Implementation
+	Capabilities ServerCapabilities
+
+	onToolsListChanged func()
+}
+
+// NewClient creates a client that reads the server's messages from r and writes to w.
+// The caller must call Run (typically on its own goroutine) before calling Initialize.
+// onToolsListChanged (if not nil) is called when the server sends notifications/tools/list_changed, which
+// it may do as soon as it's initialized; it is called on its own goroutine so it may call ListTools.
+func NewClient(r io.Reader, w io.Writer, onToolsListChanged func()) *Client {
+	c := &Client{onToolsListChanged: onToolsListChanged}
+	c.conn = NewConn(r, w, c.handle)
+	return c
+}
+
+// Run processes messages from the server until the connection is closed.
+func (c *Client) Run(ctx context.Context) error { return c.conn.Run(ctx) }
+
+func (c *Client) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case MethodPing:
+		return EmptyResult{}, nil
+	case NotificationToolsListChanged:
+		if c.onToolsListChanged != nil {
+			c.onToolsListChanged()
+		}
+		return nil, nil
+	default:
+		return nil, &RPCError{Code: MethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// Initialize performs the MCP initialization handshake.
+func (c *Client) Initialize(ctx context.Context, clientInfo Implementation) error {
+	result := InitializeResult{}
+	params := InitializeRequestParams{ProtocolVersion: LatestProtocolVersion, ClientInfo: clientInfo}
+	if err := c.conn.Call(ctx, MethodInitialize, params, &result); err != nil {
+		return err
+	}
+	c.ServerInfo, c.Capabilities = result.ServerInfo, result.Capabilities
+	return c.conn.Notify(NotificationInitialized, nil)
+}
+
+// ListTools returns all of the server's tools, following nextCursor until the last page.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	tools := []Tool(nil)
+	params := PaginatedRequestParams{}
+	for {
+		result := ListToolsResult{}
+		if err := c.conn.Call(ctx, MethodToolsList, params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == nil || *result.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server.
+func (c *Client) CallTool(ctx context.Context, params *CallToolRequestParams) (*CallToolResult, error) {
+	result := &CallToolResult{}
+	if err := c.conn.Call(ctx, MethodToolsCall, params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// toolList is a ToolProvider whose tools can change.
+type toolList struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (l *toolList) set(names ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names = names
+}
+
+func (l *toolList) ListTools(ctx context.Context, params *PaginatedRequestParams) (*ListToolsResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := &ListToolsResult{Tools: []Tool{}}
+	for _, name := range l.names {
+		result.Tools = append(result.Tools, Tool{BaseMetadata: BaseMetadata{Name: name}, InputSchema: []byte(`{"type": "object"}`)})
+	}
+	return result, nil
+}
+
+func (l *toolList) CallTool(ctx context.Context, params *CallToolRequestParams) (*CallToolResult, error) {
+	return TextResult("called "+params.Name, false), nil
+}
+
+func toolNames(tools []Tool) []string {
+	names := []string{}
+	for _, t := range tools {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestClientRelistsOnToolsListChanged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := &toolList{names: []string{"a"}}
+	server := &Server{Info: Implementation{BaseMetadata: BaseMetadata{Name: "test-server"}, Version: "1.0"}, Tools: provider}
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	defer clientWrite.Close()
+	defer serverWrite.Close()
+	go func() { _ = server.Serve(ctx, serverRead, serverWrite) }()
+
+	client, relisted := (*Client)(nil), make(chan []string, 1)
+	client = NewClient(clientRead, clientWrite, func() {
+		tools, err := client.ListTools(ctx) // Calling back into the server from the notification must not deadlock
+		if err != nil {
+			t.Error(err)
+		}
+		relisted <- toolNames(tools)
+	})
+	go func() { _ = client.Run(ctx) }()
+	if err := client.Initialize(ctx, Implementation{BaseMetadata: BaseMetadata{Name: "test-client"}, Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if client.Capabilities.Tools == nil || client.Capabilities.Tools.ListChanged == nil || !*client.Capabilities.Tools.ListChanged {
+		t.Errorf("the server doesn't advertise tools.listChanged: %+v", client.Capabilities)
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil || len(tools) != 1 || tools[0].Name != "a" {
+		t.Fatalf("got %v, %v; want [a]", toolNames(tools), err)
+	}
+
+	provider.set("a", "b")
+	if err := server.NotifyToolsListChanged(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case names := <-relisted:
+		if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+			t.Errorf("re-listed %v, want [a b]", names)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client didn't re-list the tools after notifications/tools/list_changed")
+	}
+}
+
+// A server may send notifications/tools/list_changed before the client's Initialize call even returns.
+func TestClientNotifiedDuringInitialize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	defer clientWrite.Close()
+	defer serverWrite.Close()
+	server := (*Conn)(nil)
+	server = NewConn(serverRead, serverWrite, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		if method == MethodInitialize {
+			if err := server.Notify(NotificationToolsListChanged, nil); err != nil {
+				return nil, err
+			}
+			return InitializeResult{ProtocolVersion: LatestProtocolVersion}, nil
+		}
+		return nil, nil
+	})
+	go func() { _ = server.Run(ctx) }()
+
+	notified := make(chan struct{}, 1)
+	client := NewClient(clientRead, clientWrite, func() { notified <- struct{}{} })
+	go func() { _ = client.Run(ctx) }()
+	if err := client.Initialize(ctx, Implementation{BaseMetadata: BaseMetadata{Name: "test-client"}, Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client dropped the notifications/tools/list_changed sent during initialization")
+	}
+}
@@ -0,0 +1,194 @@
+package mcp
+
+// Transport: https://modelcontextprotocol.io/specification/2025-06-18/basic/transports#stdio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// RPCError is a JSON-RPC error; Handlers return it to control the error code sent to the peer.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string { return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message) }
+
+// Handler processes an incoming request or notification. For notifications, the result is ignored.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// ErrConnClosed is returned by Call for requests that were pending when the connection was closed.
+var ErrConnClosed = errors.New("mcp: connection closed")
+
+// Conn is a JSON-RPC 2.0 connection over a newline-delimited stream of messages (the MCP stdio transport).
+// Incoming requests & notifications are each dispatched to the handler on their own goroutine so that
+// a handler may itself Call the peer.
+type Conn struct {
+	r       *bufio.Reader
+	handler Handler
+
+	wmu sync.Mutex // Serializes writes so messages are never interleaved
+	w   io.Writer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *wireMessage
+	closed  bool
+}
+
+// wireMessage is the union of all JSON-RPC messages; it is only used for reading.
+type wireMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w, handler: handler, pending: map[int64]chan *wireMessage{}}
+}
+
+// Run reads & dispatches messages until the reader returns EOF, an error occurs, or ctx is canceled.
+// When Run returns, all pending calls fail with ErrConnClosed.
+func (c *Conn) Run(ctx context.Context) error {
+	defer c.close()
+	for ctx.Err() == nil {
+		line, err := c.r.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(ctx, line)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (c *Conn) dispatch(ctx context.Context, line []byte) {
+	msg := &wireMessage{}
+	if err := json.Unmarshal(line, msg); err != nil {
+		if len(bytes.TrimSpace(line)) > 0 {
+			c.reply(nil, nil, &RPCError{Code: ParseError, Message: err.Error()})
+		}
+		return
+	}
+	switch {
+	case msg.Method != "" && msg.ID != nil: // Request
+		go func() {
+			result, err := c.handler(ctx, msg.Method, msg.Params)
+			c.reply(msg.ID, result, err)
+		}()
+	case msg.Method != "": // Notification
+		go c.handler(ctx, msg.Method, msg.Params)
+	default: // Response to one of our calls
+		id, err := strconv.ParseInt(string(msg.ID), 10, 64)
+		if err != nil {
+			return // Not an ID we issued
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+func (c *Conn) reply(id json.RawMessage, result interface{}, err error) {
+	if err == nil {
+		if result == nil {
+			result = EmptyResult{}
+		}
+		_ = c.write(JSONRPCResponse{JSONRPC: JSONRPCVersion, ID: id, Result: result})
+		return
+	}
+	rpcErr := &RPCError{}
+	if !errors.As(err, &rpcErr) {
+		rpcErr = &RPCError{Code: InternalError, Message: err.Error()}
+	}
+	e := JSONRPCError{JSONRPC: JSONRPCVersion, ID: id}
+	e.Error.Code, e.Error.Message, e.Error.Data = rpcErr.Code, rpcErr.Message, rpcErr.Data
+	_ = c.write(e)
+}
+
+func (c *Conn) write(msg JSONRPCMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.w.Write(append(b, '\n'))
+	return err
+}
+
+// Call sends a request to the peer and unmarshals its result into result (which may be nil).
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) error {
+	ch := make(chan *wireMessage, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrConnClosed
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.write(JSONRPCRequest{JSONRPC: JSONRPCVersion, ID: id, Method: method, Params: params}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		_ = c.Notify(NotificationCancelled, CancelledNotificationParams{RequestID: id})
+		return ctx.Err()
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrConnClosed
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || msg.Result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// Notify sends a notification to the peer.
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(JSONRPCNotification{JSONRPC: JSONRPCVersion, Method: method, Params: params})
+}
+
+func (c *Conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
@@ -4,6 +4,7 @@ package mcp
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // Constants
@@ -189,6 +190,11 @@ type PaginatedRequest struct {
 	Cursor *Cursor `json:"cursor,omitempty"`
 }
 
+type PaginatedRequestParams struct {
+	Cursor *Cursor `json:"cursor,omitempty"`
+	Meta   *Meta   `json:"_meta,omitempty"`
+}
+
 type PaginatedResult struct {
 	Result
 	NextCursor *Cursor `json:"nextCursor,omitempty"`
@@ -384,6 +390,7 @@ type ListToolsResult struct {
 type CallToolRequestParams struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Meta      *Meta                  `json:"_meta,omitempty"`
 }
 
 type CallToolResult struct {
@@ -393,6 +400,54 @@ type CallToolResult struct {
 	Meta              *Meta                  `json:"_meta,omitempty"`
 }
 
+// UnmarshalJSON decodes each content block into its concrete type based on its "type" field.
+func (r *CallToolResult) UnmarshalJSON(data []byte) error {
+	type callToolResult CallToolResult // Same fields without this method
+	aux := struct {
+		callToolResult
+		Content []json.RawMessage `json:"content"`
+	}{}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*r = CallToolResult(aux.callToolResult)
+	r.Content = make([]ContentBlock, 0, len(aux.Content))
+	for _, raw := range aux.Content {
+		kind := struct {
+			Type string `json:"type"`
+		}{}
+		if err := json.Unmarshal(raw, &kind); err != nil {
+			return err
+		}
+		var block ContentBlock
+		var err error
+		switch kind.Type {
+		case "text":
+			b := TextContent{}
+			err, block = json.Unmarshal(raw, &b), b
+		case "image":
+			b := ImageContent{}
+			err, block = json.Unmarshal(raw, &b), b
+		case "audio":
+			b := AudioContent{}
+			err, block = json.Unmarshal(raw, &b), b
+		case "resource_link":
+			b := ResourceLink{}
+			err, block = json.Unmarshal(raw, &b), b
+		case "resource":
+			b := EmbeddedResource{}
+			err, block = json.Unmarshal(raw, &b), b
+		default:
+			return fmt.Errorf("unknown content block type %q", kind.Type)
+		}
+		if err != nil {
+			return err
+		}
+		r.Content = append(r.Content, block)
+	}
+	return nil
+}
+
 // Logging
 type SetLevelRequestParams struct {
 	Level LoggingLevel `json:"level"`
@@ -0,0 +1,410 @@
+package mcp
+
+// A validator for the subset of JSON Schema (draft 2020-12) used by MCP tools' inputSchema & outputSchema.
+// https://json-schema.org/draft/2020-12/json-schema-validation
+// Supported keywords: type, enum, const, properties, required, additionalProperties, patternProperties,
+// minProperties, maxProperties, items, prefixItems, minItems, maxItems, uniqueItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not,
+// and $ref to a JSON Pointer within the same schema (e.g. "#/$defs/name"). Other keywords (format,
+// description, default, ...) are ignored.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaError describes one way in which a JSON value fails to match a schema.
+type SchemaError struct {
+	Path    string // JSON Pointer to the failing value; "" is the whole value
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + e.Message
+}
+
+// SchemaErrors is returned by ValidateSchema when a value fails to match its schema.
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateSchema validates value against schema. value is any Go value that encoding/json can marshal.
+// It returns nil if value is valid, SchemaErrors if it's not, or another error if schema can't be parsed.
+// An empty (or null) schema accepts any value.
+func ValidateSchema(schema json.RawMessage, value interface{}) error {
+	root, err := parseSchema(schema)
+	if err != nil || root == nil {
+		return err
+	}
+	// Normalize value into the types produced by encoding/json (map[string]interface{}, []interface{}, float64, ...)
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var instance interface{}
+	if err := json.Unmarshal(b, &instance); err != nil {
+		return err
+	}
+	v := &validator{root: root}
+	v.validate(root, instance, "")
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// CheckSchema returns an error if schema isn't empty, null, a JSON object or a boolean; ValidateSchema fails
+// the same way for every value validated against such a schema.
+func CheckSchema(schema json.RawMessage) error {
+	_, err := parseSchema(schema)
+	return err
+}
+
+func parseSchema(schema json.RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(schema)) == 0 {
+		return nil, nil
+	}
+	var root interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	switch root.(type) {
+	case nil, bool, map[string]interface{}:
+		return root, nil
+	}
+	return nil, fmt.Errorf("invalid schema: expected an object or boolean but got %s", typeOf(root))
+}
+
+// ValidateArguments validates a tools/call request's arguments against the tool's inputSchema.
+func (t *Tool) ValidateArguments(arguments map[string]interface{}) error {
+	if arguments == nil {
+		arguments = map[string]interface{}{} // Omitted arguments are an empty object
+	}
+	return ValidateSchema(t.InputSchema, arguments)
+}
+
+// ValidateStructuredContent validates a tools/call result's structuredContent against the tool's outputSchema.
+// It returns nil if the tool has no outputSchema.
+func (t *Tool) ValidateStructuredContent(structuredContent map[string]interface{}) error {
+	if t.OutputSchema == nil {
+		return nil
+	}
+	if structuredContent == nil {
+		return SchemaErrors{{Message: "structuredContent is required by the tool's outputSchema"}}
+	}
+	return ValidateSchema(*t.OutputSchema, structuredContent)
+}
+
+type validator struct {
+	root   interface{}
+	errors SchemaErrors
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// valid returns true if instance matches schema without recording any errors.
+func (v *validator) valid(schema, instance interface{}, path string) bool {
+	sub := &validator{root: v.root}
+	sub.validate(schema, instance, path)
+	return len(sub.errors) == 0
+}
+
+func (v *validator) validate(schema, instance interface{}, path string) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, instance, path)
+	default:
+		v.fail(path, "invalid schema: expected an object or boolean")
+	}
+}
+
+func (v *validator) validateObjectSchema(s map[string]interface{}, instance interface{}, path string) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+		} else {
+			v.validate(target, instance, path)
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, e := range t {
+				if s, ok := e.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		if !slices.ContainsFunc(types, func(t string) bool { return hasType(instance, t) }) {
+			v.fail(path, "expected %s but got %s", strings.Join(types, " or "), typeOf(instance))
+			return // Other keywords would just report confusing consequences of the wrong type
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && !slices.ContainsFunc(enum, func(e interface{}) bool { return reflect.DeepEqual(e, instance) }) {
+		v.fail(path, "value %s is not one of %s", jsonString(instance), jsonString(enum))
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, instance) {
+		v.fail(path, "value %s is not %s", jsonString(instance), jsonString(c))
+	}
+
+	switch instance := instance.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, instance, path)
+	case []interface{}:
+		v.validateArray(s, instance, path)
+	case string:
+		v.validateString(s, instance, path)
+	case float64:
+		v.validateNumber(s, instance, path)
+	}
+
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			v.validate(sub, instance, path)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		if !slices.ContainsFunc(anyOf, func(sub interface{}) bool { return v.valid(sub, instance, path) }) {
+			v.fail(path, "value does not match any of the schemas in anyOf")
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, instance, path) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(path, "value matches %d of the schemas in oneOf; it must match exactly 1", matches)
+		}
+	}
+	if not, ok := s["not"]; ok && v.valid(not, instance, path) {
+		v.fail(path, "value must not match the schema in not")
+	}
+}
+
+func (v *validator) validateObject(s map[string]interface{}, instance map[string]interface{}, path string) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := instance[name]; !present {
+					v.fail(path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+	if n, ok := number(s["minProperties"]); ok && float64(len(instance)) < n {
+		v.fail(path, "object has %d properties; minimum is %v", len(instance), n)
+	}
+	if n, ok := number(s["maxProperties"]); ok && float64(len(instance)) > n {
+		v.fail(path, "object has %d properties; maximum is %v", len(instance), n)
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patternProperties, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	names := make([]string, 0, len(instance))
+	for name := range instance {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Report errors in a deterministic order
+	for _, name := range names {
+		value, childPath := instance[name], path+"/"+escapePointer(name)
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			v.validate(sub, value, childPath)
+		}
+		for pattern, sub := range patternProperties {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				v.fail(path, "invalid schema: patternProperties %q: %v", pattern, err)
+				continue
+			}
+			if re.MatchString(name) {
+				matched = true
+				v.validate(sub, value, childPath)
+			}
+		}
+		if !matched && hasAdditional {
+			if b, ok := additional.(bool); ok && !b {
+				v.fail(childPath, "property %q is not allowed", name)
+			} else {
+				v.validate(additional, value, childPath)
+			}
+		}
+	}
+}
+
+func (v *validator) validateArray(s map[string]interface{}, instance []interface{}, path string) {
+	if n, ok := number(s["minItems"]); ok && float64(len(instance)) < n {
+		v.fail(path, "array has %d items; minimum is %v", len(instance), n)
+	}
+	if n, ok := number(s["maxItems"]); ok && float64(len(instance)) > n {
+		v.fail(path, "array has %d items; maximum is %v", len(instance), n)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := range instance {
+			for j := i + 1; j < len(instance); j++ {
+				if reflect.DeepEqual(instance[i], instance[j]) {
+					v.fail(path, "items %d and %d are equal; items must be unique", i, j)
+				}
+			}
+		}
+	}
+	prefixItems, _ := s["prefixItems"].([]interface{})
+	for i, item := range instance {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(prefixItems) {
+			v.validate(prefixItems[i], item, itemPath)
+		} else if items, ok := s["items"]; ok {
+			v.validate(items, item, itemPath)
+		}
+	}
+}
+
+func (v *validator) validateString(s map[string]interface{}, instance string, path string) {
+	length := utf8.RuneCountInString(instance)
+	if n, ok := number(s["minLength"]); ok && float64(length) < n {
+		v.fail(path, "string has length %d; minimum is %v", length, n)
+	}
+	if n, ok := number(s["maxLength"]); ok && float64(length) > n {
+		v.fail(path, "string has length %d; maximum is %v", length, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "invalid schema: pattern %q: %v", pattern, err)
+		} else if !re.MatchString(instance) {
+			v.fail(path, "string %q does not match pattern %q", instance, pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]interface{}, instance float64, path string) {
+	if n, ok := number(s["minimum"]); ok && instance < n {
+		v.fail(path, "%v is less than the minimum of %v", instance, n)
+	}
+	if n, ok := number(s["maximum"]); ok && instance > n {
+		v.fail(path, "%v is greater than the maximum of %v", instance, n)
+	}
+	if n, ok := number(s["exclusiveMinimum"]); ok && instance <= n {
+		v.fail(path, "%v must be greater than %v", instance, n)
+	}
+	if n, ok := number(s["exclusiveMaximum"]); ok && instance >= n {
+		v.fail(path, "%v must be less than %v", instance, n)
+	}
+	if n, ok := number(s["multipleOf"]); ok && n > 0 {
+		if q := instance / n; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "%v is not a multiple of %v", instance, n)
+		}
+	}
+}
+
+// resolve returns the subschema referenced by a $ref of the form "#" or "#/json/pointer".
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within the schema are supported", ref)
+	}
+	node := v.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			node = n[i]
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+func hasType(instance interface{}, t string) bool {
+	switch t {
+	case "null":
+		return instance == nil
+	case "boolean":
+		_, ok := instance.(bool)
+		return ok
+	case "object":
+		_, ok := instance.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := instance.([]interface{})
+		return ok
+	case "string":
+		_, ok := instance.(string)
+		return ok
+	case "number":
+		_, ok := instance.(float64)
+		return ok
+	case "integer":
+		f, ok := instance.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+func typeOf(instance interface{}) string {
+	for _, t := range []string{"null", "boolean", "object", "array", "string", "integer", "number"} {
+		if hasType(instance, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", instance)
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
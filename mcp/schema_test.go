@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	const defs = `"$defs": {"port": {"type": "integer", "minimum": 1, "maximum": 65535}}`
+	tests := []struct {
+		name, schema string
+		value        interface{}
+		want         string // The SchemaErrors' message; "" if value is valid
+	}{
+		{"empty schema", ``, map[string]interface{}{"any": 1}, ""},
+		{"null schema", `null`, "anything", ""},
+		{"empty object schema", `{}`, []interface{}{1, "a"}, ""},
+		{"false schema", `false`, 1, "/: no value is allowed here"},
+
+		{"type", `{"type": "string"}`, "a", ""},
+		{"wrong type", `{"type": "string"}`, 1, "/: expected string but got integer"},
+		{"type list", `{"type": ["string", "null"]}`, nil, ""},
+		{"wrong type list", `{"type": ["string", "null"]}`, true, "/: expected string or null but got boolean"},
+		{"integer", `{"type": "integer"}`, 1.5, "/: expected integer but got number"},
+
+		{"required", `{"type": "object", "required": ["name"]}`, map[string]interface{}{"name": "a"}, ""},
+		{"missing required", `{"type": "object", "required": ["name", "size"]}`, map[string]interface{}{},
+			`/: missing required property "name"; /: missing required property "size"`},
+
+		{"enum", `{"enum": ["hot", "cool", 1]}`, "cool", ""},
+		{"not in enum", `{"enum": ["hot", "cool", 1]}`, "archive", `/: value "archive" is not one of ["hot","cool",1]`},
+
+		{"minimum", `{"minimum": 1}`, 1, ""},
+		{"below minimum", `{"minimum": 1}`, 0, "/: 0 is less than the minimum of 1"},
+		{"maximum", `{"maximum": 10}`, 10, ""},
+		{"above maximum", `{"maximum": 10}`, 10.5, "/: 10.5 is greater than the maximum of 10"},
+
+		{"pattern", `{"pattern": "^[a-z]+$"}`, "abc", ""},
+		{"pattern mismatch", `{"pattern": "^[a-z]+$"}`, "ABC", `/: string "ABC" does not match pattern "^[a-z]+$"`},
+		{"invalid pattern", `{"pattern": "("}`, "a", "/: invalid schema: pattern \"(\": error parsing regexp: missing closing ): `(`"},
+
+		{"items", `{"items": {"type": "string"}}`, []interface{}{"a", "b"}, ""},
+		{"bad items", `{"items": {"type": "string"}}`, []interface{}{"a", 2, true},
+			"/1: expected string but got integer; /2: expected string but got boolean"},
+		{"nested path", `{"properties": {"tags": {"items": {"properties": {"key": {"type": "string"}}}}}}`,
+			map[string]interface{}{"tags": []interface{}{map[string]interface{}{"key": "a"}, map[string]interface{}{"key": 1}}},
+			"/tags/1/key: expected string but got integer"},
+		{"escaped path", `{"properties": {"a/b~c": {"type": "string"}}}`, map[string]interface{}{"a/b~c": 1},
+			"/a~1b~0c: expected string but got integer"},
+
+		{"additionalProperties false", `{"properties": {"a": {}}, "additionalProperties": false}`,
+			map[string]interface{}{"a": 1, "b": 2, "c": 3}, `/b: property "b" is not allowed; /c: property "c" is not allowed`},
+		{"additionalProperties schema", `{"properties": {"a": {}}, "additionalProperties": {"type": "integer"}}`,
+			map[string]interface{}{"a": "x", "b": "y"}, "/b: expected integer but got string"},
+		{"additionalProperties absent", `{"properties": {"a": {}}}`, map[string]interface{}{"b": 1}, ""},
+
+		{"$ref", `{` + defs + `, "properties": {"port": {"$ref": "#/$defs/port"}}}`, map[string]interface{}{"port": 443}, ""},
+		{"$ref mismatch", `{` + defs + `, "properties": {"port": {"$ref": "#/$defs/port"}}}`, map[string]interface{}{"port": 0},
+			"/port: 0 is less than the minimum of 1"},
+		{"unresolvable $ref", `{"properties": {"port": {"$ref": "#/$defs/missing"}}}`, map[string]interface{}{"port": 1},
+			`/port: unresolvable $ref "#/$defs/missing"`},
+		{"external $ref", `{"$ref": "https://example.com/schema"}`, 1,
+			`/: unsupported $ref "https://example.com/schema": only references within the schema are supported`},
+		{"recursive $ref", `{"properties": {"name": {"type": "string"}, "child": {"$ref": "#"}}}`,
+			map[string]interface{}{"child": map[string]interface{}{"child": map[string]interface{}{"name": 1}}},
+			"/child/child/name: expected string but got integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(json.RawMessage(tt.schema), tt.value)
+			var errs SchemaErrors
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tt.want != "" && (!errors.As(err, &errs) || errs.Error() != tt.want):
+				t.Errorf("got error %v, want SchemaErrors %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	for _, schema := range []string{``, ` `, `null`, `true`, `{}`, `{"type": "object"}`} {
+		if err := CheckSchema(json.RawMessage(schema)); err != nil {
+			t.Errorf("CheckSchema(%q) = %v, want nil", schema, err)
+		}
+	}
+	for schema, want := range map[string]string{
+		`{"type": `: "invalid schema: unexpected end of JSON input",
+		`"object"`:  "invalid schema: expected an object or boolean but got string",
+		`[]`:        "invalid schema: expected an object or boolean but got array",
+	} {
+		if err := CheckSchema(json.RawMessage(schema)); err == nil || err.Error() != want {
+			t.Errorf("CheckSchema(%q) = %v, want %s", schema, err, want)
+		}
+		// Validation fails with the same (non-SchemaErrors) error for any value
+		if err := ValidateSchema(json.RawMessage(schema), 1); err == nil || errors.As(err, new(SchemaErrors)) {
+			t.Errorf("ValidateSchema(%q) = %v, want a schema error", schema, err)
+		}
+	}
+}
+
+func TestValidateArgumentsWithoutSchema(t *testing.T) {
+	for _, schema := range []json.RawMessage{nil, json.RawMessage(`{}`)} {
+		tool := &Tool{BaseMetadata: BaseMetadata{Name: "echo"}, InputSchema: schema}
+		if err := tool.ValidateArguments(map[string]interface{}{"text": "hi"}); err != nil {
+			t.Errorf("InputSchema %q: got error %v, want none", schema, err)
+		}
+	}
+}
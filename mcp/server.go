@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+)
+
+// ToolProvider supplies the tools exposed by a Server.
+type ToolProvider interface {
+	ListTools(ctx context.Context, params *PaginatedRequestParams) (*ListToolsResult, error)
+	CallTool(ctx context.Context, params *CallToolRequestParams) (*CallToolResult, error)
+}
+
+// Server is an MCP server that exposes the tools of its ToolProvider.
+type Server struct {
+	Info         Implementation
+	Instructions *string
+	Tools        ToolProvider
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+var supportedProtocolVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Serve processes the client's messages from r (writing to w) until the connection is closed.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	conn := NewConn(r, w, s.handle)
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	return conn.Run(ctx)
+}
+
+// NotifyToolsListChanged tells the client that it should call tools/list again.
+func (s *Server) NotifyToolsListChanged() error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return ErrConnClosed
+	}
+	return conn.Notify(NotificationToolsListChanged, nil)
+}
+
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case MethodInitialize:
+		p := InitializeRequestParams{}
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		version := LatestProtocolVersion
+		if slices.Contains(supportedProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		listChanged := true
+		result := InitializeResult{ProtocolVersion: version, ServerInfo: s.Info, Instructions: s.Instructions}
+		result.Capabilities.Tools = &struct {
+			ListChanged *bool `json:"listChanged,omitempty"`
+		}{ListChanged: &listChanged}
+		return result, nil
+
+	case MethodPing:
+		return EmptyResult{}, nil
+
+	case MethodToolsList:
+		p := &PaginatedRequestParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		return s.Tools.ListTools(ctx, p)
+
+	case MethodToolsCall:
+		p := &CallToolRequestParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		return s.Tools.CallTool(ctx, p)
+
+	case NotificationInitialized, NotificationCancelled:
+		return nil, nil // Nothing to do
+
+	default:
+		return nil, &RPCError{Code: MethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil // Params are optional
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &RPCError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// TextResult returns a CallToolResult containing a single text content block.
+func TextResult(text string, isError bool) *CallToolResult {
+	r := &CallToolResult{Content: []ContentBlock{TextContent{Type: "text", Text: text}}}
+	if isError {
+		r.IsError = &isError
+	}
+	return r
+}
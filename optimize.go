@@ -0,0 +1,284 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The optimize command suggests description edits. For each tool whose prompts another tool beats (a confusion
+// of the failing tool with the winning tool), it mines keywords distinguishing the failing tool's prompts from
+// the winner's, appends them to the failing tool's description, re-embeds only that tool in the in-memory
+// VectorDB & re-runs the prompts (any prompt's ranking may change when a tool's vector moves). An edit is kept
+// only if more cases pass & none that passed fails; kept edits are written to a patched tools file.
+
+// relatedTerms introduces the keywords an edit appends to a description.
+const relatedTerms = " Related terms: "
+
+// caseOutcome is where a case's acceptable tool ranked (0 if it wasn't in the top K) & whether the case passed.
+type caseOutcome struct {
+	Rank   int
+	Passed bool
+}
+
+// confusion is a tool that lost cases expecting it to another tool ranked #1.
+type confusion struct {
+	Tool, Winner ID
+	Cases        []string // The IDs of the cases lost
+}
+
+// descriptionEdit is an edit optimize kept.
+type descriptionEdit struct {
+	confusion
+	Keywords []string
+	Fixed    []string // The IDs of the cases that now pass
+}
+
+func runOptimize(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	f := addSelectionFlags(fs, 10)
+	prompts := fs.String("prompts", "prompts.json", "JSON file of test prompts (v1 or v2 format)")
+	out := fs.String("out", "list-tools.optimized.json", "file the tools with the kept edits are written to")
+	keywords := fs.Int("keywords", 3, "maximum number of keywords an edit adds")
+	rounds := fs.Int("rounds", 3, "maximum number of passes over the failing tools; a pass keeping no edit ends the loop")
+	must(0, fs.Parse(args))
+	io, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("optimize: %v", err)
+	}
+	if *keywords < 1 || *rounds < 1 {
+		log.Fatalf("optimize: -keywords & -rounds must be at least 1")
+	}
+
+	start := time.Now()
+	tools, original, _ := f.loadOrBuildIndex(io)
+	cases := slices.DeleteFunc(embedPromptCases(loadPromptsFromJSON(*prompts)), func(c promptCase) bool { return c.IsNegative() })
+	db := cloneDB(original)
+	o.TopK = cmp.Or(o.TopK, 10)
+	outcomes := caseOutcomes(db, cases, o)
+	edits := []descriptionEdit{}
+	for round := 0; round < *rounds; round++ {
+		kept := 0
+		for _, c := range findConfusions(db, cases, outcomes, o) {
+			e, ok := db.Get(c.Tool)
+			if !ok {
+				continue
+			}
+			tool := *e.Metadata.(*mcp.Tool)
+			description := ""
+			if tool.Description != nil {
+				description = *tool.Description
+			}
+			candidates := distinguishingKeywords(db, cases, c, description)
+			best, bestEntry, bestOutcomes := []string(nil), e, []caseOutcome(nil)
+			for n := 1; n <= min(*keywords, len(candidates)); n++ {
+				edited := addKeywords(description, candidates[:n])
+				tool.Description = &edited
+				if err := tools2DB(db, []mcp.Tool{tool}, io); err != nil { // Re-embeds just this tool
+					log.Fatalf("optimize: %v", err)
+				}
+				if next := caseOutcomes(db, cases, o); improves(outcomes, next) &&
+					(bestOutcomes == nil || betterOutcomes(next, bestOutcomes)) {
+					best, bestOutcomes = candidates[:n], next
+					bestEntry, _ = db.Get(c.Tool)
+				}
+			}
+			db.Upsert(bestEntry) // The original entry if no edit improved the results
+			if best == nil {
+				continue
+			}
+			edit := descriptionEdit{confusion: c, Keywords: best}
+			for i := range cases {
+				if !outcomes[i].Passed && bestOutcomes[i].Passed {
+					edit.Fixed = append(edit.Fixed, cases[i].ID)
+				}
+			}
+			edits, outcomes, kept = append(edits, edit), bestOutcomes, kept+1
+		}
+		if kept == 0 {
+			break
+		}
+	}
+
+	patched := slices.Clone(tools)
+	for i := range patched {
+		if e, ok := db.Get(entryID(&patched[i])); ok && slices.ContainsFunc(edits, func(d descriptionEdit) bool { return d.Tool == e.ID }) {
+			patched[i] = *e.Metadata.(*mcp.Tool)
+		}
+	}
+	if len(edits) > 0 {
+		must(0, saveToolsToJSON(*out, patched))
+	}
+	before, after := evaluateCases(vectorSearcher{db: original}, cases, o), evaluateCases(vectorSearcher{db: db}, cases, o)
+
+	if isMarkdownOutput() {
+		fmt.Println("# Description Optimization")
+		fmt.Println()
+		if len(edits) > 0 {
+			fmt.Println("| Tool | Beaten By | Keywords Added | Cases Fixed |")
+			fmt.Println("|------|-----------|----------------|-------------|")
+			for _, e := range edits {
+				fmt.Printf("| `%s` | `%s` | %s | %s |\n", e.Tool, e.Winner, strings.Join(e.Keywords, ", "), strings.Join(e.Fixed, ", "))
+			}
+			fmt.Println()
+		}
+		fmt.Println("| Version | Accuracy (top 1) | Recall (top 3) | MRR | Pass Rate |")
+		fmt.Println("|---------|------------------|----------------|-----|-----------|")
+		fmt.Printf("| Original | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("| Optimized | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		fmt.Println()
+		if len(edits) > 0 {
+			fmt.Printf("**Patched tools:** %s  \n", *out)
+		}
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		for _, e := range edits {
+			fmt.Printf("%s (beaten by %s): added %s; fixed %s\n", e.Tool, e.Winner, strings.Join(e.Keywords, ", "), strings.Join(e.Fixed, ", "))
+		}
+		fmt.Printf("\n   %-10s %9s %9s %8s %9s\n", "Version", "Top1", "Top3", "MRR", "Passed")
+		fmt.Printf("   %-10s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "Original", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("   %-10s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "Optimized", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		if len(edits) > 0 {
+			fmt.Printf("\nEdits=%d, Patched tools=%s, Execution time=%v\n", len(edits), *out, time.Since(start))
+		} else {
+			fmt.Printf("\nNo edit improved the results, Execution time=%v\n", time.Since(start))
+		}
+	}
+}
+
+// caseOutcomes searches db for each case.
+func caseOutcomes(db *VectorDB, cases []promptCase, o QueryOptions) []caseOutcome {
+	outcomes := make([]caseOutcome, len(cases))
+	for i, c := range cases {
+		results := db.Query(c.Vector, o)
+		outcomes[i] = caseOutcome{Rank: expectedRank(results, &c.testCase), Passed: c.Passed(results)}
+	}
+	return outcomes
+}
+
+// improves returns true if more cases pass in next than in prev & every case passing in prev still passes.
+func improves(prev, next []caseOutcome) bool {
+	gained := 0
+	for i := range prev {
+		switch {
+		case prev[i].Passed && !next[i].Passed:
+			return false
+		case !prev[i].Passed && next[i].Passed:
+			gained++
+		}
+	}
+	return gained > 0
+}
+
+// betterOutcomes returns true if more cases pass in a than in b or, if as many do, the reciprocal ranks sum higher.
+func betterOutcomes(a, b []caseOutcome) bool {
+	passed := func(outcomes []caseOutcome) (n int, rr float64) {
+		for _, o := range outcomes {
+			if o.Passed {
+				n++
+			}
+			if o.Rank > 0 {
+				rr += 1 / float64(o.Rank)
+			}
+		}
+		return n, rr
+	}
+	passedA, rrA := passed(a)
+	passedB, rrB := passed(b)
+	return passedA > passedB || passedA == passedB && rrA > rrB
+}
+
+// findConfusions returns, most cases lost first, each tool that failing cases expect & the tool ranked #1 instead.
+func findConfusions(db *VectorDB, cases []promptCase, outcomes []caseOutcome, o QueryOptions) []confusion {
+	confusions := map[[2]ID]*confusion{}
+	for i, c := range cases {
+		if outcomes[i].Passed {
+			continue
+		}
+		results := db.Query(c.Vector, o)
+		accepted := acceptedEntries(db, &c.testCase)
+		if len(results) == 0 || len(accepted) == 0 || c.Accepts(results[0].Entry) {
+			continue
+		}
+		key := [2]ID{accepted[0].ID, results[0].Entry.ID}
+		if confusions[key] == nil {
+			confusions[key] = &confusion{Tool: key[0], Winner: key[1]}
+		}
+		confusions[key].Cases = append(confusions[key].Cases, c.ID)
+	}
+	sorted := []confusion{}
+	for _, key := range slices.SortedFunc(maps.Keys(confusions), func(a, b [2]ID) int {
+		return cmp.Or(cmp.Compare(len(confusions[b].Cases), len(confusions[a].Cases)), strings.Compare(string(a[0]), string(b[0])),
+			strings.Compare(string(a[1]), string(b[1])))
+	}) {
+		sorted = append(sorted, *confusions[key])
+	}
+	return sorted
+}
+
+// distinguishingKeywords returns, best first, the terms (see tokenize; placeholders excluded) of the prompts c
+// lost that aren't in description, scored by the fraction of the prompts expecting c.Tool containing the term
+// minus the fraction of the prompts expecting c.Winner containing it; terms scoring 0 or less are dropped.
+func distinguishingKeywords(db *VectorDB, cases []promptCase, c confusion, description string) []string {
+	toolEntry, _ := db.Get(c.Tool)
+	winnerEntry, _ := db.Get(c.Winner)
+	terms := func(prompt string) map[string]bool {
+		return mapOf(tokenize(placeholderPattern.ReplaceAllString(prompt, " ")))
+	}
+	frequency := func(e *Entry) map[string]float64 {
+		counts, n := map[string]float64{}, 0
+		for _, pc := range cases {
+			if e != nil && pc.Accepts(e) {
+				n++
+				for t := range terms(pc.Prompt) {
+					counts[t]++
+				}
+			}
+		}
+		for t := range counts {
+			counts[t] /= float64(n)
+		}
+		return counts
+	}
+	toolFrequency, winnerFrequency := frequency(toolEntry), frequency(winnerEntry)
+	described := mapOf(tokenize(description))
+	scores := map[string]float64{}
+	for _, pc := range cases {
+		if !slices.Contains(c.Cases, pc.ID) {
+			continue
+		}
+		for t := range terms(pc.Prompt) {
+			if score := toolFrequency[t] - winnerFrequency[t]; !described[t] && score > 0 {
+				scores[t] = score
+			}
+		}
+	}
+	return slices.SortedFunc(maps.Keys(scores), func(a, b string) int {
+		return cmp.Or(cmp.Compare(scores[b], scores[a]), strings.Compare(a, b))
+	})
+}
+
+func mapOf(terms []string) map[string]bool {
+	m := map[string]bool{}
+	for _, t := range terms {
+		m[t] = true
+	}
+	return m
+}
+
+// addKeywords appends keywords to description's related terms if they're its last sentence, else adds them.
+func addKeywords(description string, keywords []string) string {
+	description = strings.TrimSpace(description)
+	if i := strings.LastIndex(description, relatedTerms); i >= 0 && strings.HasSuffix(description, ".") &&
+		!strings.Contains(description[i:len(description)-1], ".") {
+		return strings.TrimSuffix(description, ".") + ", " + strings.Join(keywords, ", ") + "."
+	}
+	return description + relatedTerms + strings.Join(keywords, ", ") + "."
+}
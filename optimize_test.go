@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddKeywords(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"Lists the secrets in a Key Vault.", "Lists the secrets in a Key Vault. Related terms: prod, show."},
+		{"Lists the secrets\n", "Lists the secrets Related terms: prod, show."},
+		{"", " Related terms: prod, show."},
+		{"Lists the secrets. Related terms: vault.", "Lists the secrets. Related terms: vault, prod, show."},
+		{"Lists the secrets. Related terms: vault. ", "Lists the secrets. Related terms: vault, prod, show."},
+		// Related terms followed by another sentence aren't extended
+		{"Lists the secrets. Related terms: vault. Requires a subscription.",
+			"Lists the secrets. Related terms: vault. Requires a subscription. Related terms: prod, show."},
+	}
+	for _, tt := range tests {
+		if got := addKeywords(tt.description, []string{"prod", "show"}); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestImproves(t *testing.T) {
+	pass, fail := caseOutcome{Rank: 1, Passed: true}, caseOutcome{Rank: 2}
+	tests := []struct {
+		name       string
+		prev, next []caseOutcome
+		improves   bool
+	}{
+		{"a case gained", []caseOutcome{pass, fail}, []caseOutcome{pass, pass}, true},
+		{"nothing gained", []caseOutcome{pass, fail}, []caseOutcome{pass, fail}, false},
+		{"a case lost for one gained", []caseOutcome{pass, fail}, []caseOutcome{fail, pass}, false},
+	}
+	for _, tt := range tests {
+		if got := improves(tt.prev, tt.next); got != tt.improves {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.improves)
+		}
+	}
+	if !betterOutcomes([]caseOutcome{pass, pass}, []caseOutcome{pass, fail}) {
+		t.Errorf("more passing cases aren't better")
+	}
+	// As many pass, but the failing case's acceptable tool ranks higher
+	if !betterOutcomes([]caseOutcome{pass, {Rank: 2}}, []caseOutcome{pass, {Rank: 5}}) ||
+		betterOutcomes([]caseOutcome{pass, {Rank: 5}}, []caseOutcome{pass, {Rank: 2}}) {
+		t.Errorf("higher reciprocal ranks aren't better")
+	}
+}
+
+func TestDistinguishingKeywords(t *testing.T) {
+	secrets := newTestTool("keyvault-secret-list", "Gets the secrets")
+	keys := newTestTool("keyvault-key-list", "Lists the keys")
+	db := newTestDB(secrets, keys)
+	cases := []promptCase{
+		{testCase: testCase{ID: "1", Prompt: "Show the vault secrets in prod for <vault_name>", Expected: []string{secrets.Name}}},
+		{testCase: testCase{ID: "2", Prompt: "List the secrets in prod", Expected: []string{secrets.Name}}},
+		{testCase: testCase{ID: "3", Prompt: "List the vault keys", Expected: []string{keys.Name}}},
+	}
+	// Of case 1's terms: "secrets" is in the description, "vault" is in more of keys's prompts than secrets's &
+	// the placeholder isn't a term
+	got := distinguishingKeywords(db, cases, confusion{Tool: entryID(&secrets), Winner: entryID(&keys), Cases: []string{"1"}},
+		*secrets.Description)
+	if want := []string{"prod", "show"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFindConfusions(t *testing.T) {
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	for id, v := range map[ID][]float32{"a": {1, 0}, "b": {0, 1}, "c": {0.7, 0.7}} {
+		db.Upsert(&Entry{ID: id, Vector: v})
+	}
+	cases := []promptCase{
+		{testCase: testCase{ID: "1", Expected: []string{"a"}}, Vector: []float32{0.1, 1}}, // Lost to b
+		{testCase: testCase{ID: "2", Expected: []string{"a"}}, Vector: []float32{0.2, 1}}, // Lost to b
+		{testCase: testCase{ID: "3", Expected: []string{"b"}}, Vector: []float32{1, 0.1}}, // Lost to a
+		{testCase: testCase{ID: "4", Expected: []string{"c"}}, Vector: []float32{0.7, 0.7}},
+	}
+	o := QueryOptions{TopK: 3}
+	got := findConfusions(db, cases, caseOutcomes(db, cases, o), o)
+	want := []confusion{{Tool: "a", Winner: "b", Cases: []string{"1", "2"}}, {Tool: "b", Winner: "a", Cases: []string{"3"}}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Tool != want[i].Tool || got[i].Winner != want[i].Winner || !slices.Equal(got[i].Cases, want[i].Cases) {
+			t.Errorf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+}
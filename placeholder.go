@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Prompts in prompts.json contain placeholders like "<key_name>" & "<database_name>" where a user would type
+// a concrete name. A placeholderGenerator substitutes synthetic values so the harness can check that tool
+// selection is robust to concrete names rather than tuned to the literal angle-bracket tokens.
+
+var placeholderPattern = regexp.MustCompile(`<([A-Za-z][A-Za-z0-9_ -]*)>`)
+
+// placeholderGenerator supplies values per placeholder name (normalized: lower-case with "-" & " " replaced by
+// "_"). Names without values get a name derived from the placeholder ("<cluster_name>" -> "contoso-cluster-1").
+type placeholderGenerator struct {
+	Values map[string][]string
+}
+
+var defaultPlaceholderValues = map[string][]string{
+	"account_name":           {"contoso-prod", "fabrikam-data", "northwind-analytics"},
+	"aggregation_type":       {"average", "maximum", "count"},
+	"app_config_store_name":  {"contoso-appconfig", "fabrikam-settings", "northwind-config-eus"},
+	"cache_name":             {"contoso-cache", "sessions-redis", "northwind-cache-01"},
+	"cluster_name":           {"contoso-adx", "telemetry-cluster", "northwind-prod-01"},
+	"container_name":         {"orders", "customer-profiles", "events"},
+	"database":               {"inventory", "billing", "customers"},
+	"database_name":          {"inventory", "billing", "customers"},
+	"entity_id":              {"vm-web-01", "aks-node-3", "sql-primary"},
+	"index_name":             {"products", "support-articles", "hotels"},
+	"key_name":               {"FeatureFlags:Beta", "ConnectionTimeout", "signing-key"},
+	"key_vault_account_name": {"contoso-kv", "fabrikam-secrets", "northwind-vault-eus"},
+	"metric_name":            {"CPU Percentage", "Requests", "Http5xx"},
+	"queue_name":             {"orders", "email-notifications", "invoices"},
+	"resource_name":          {"contoso-web", "fabrikam-api", "northwind-func"},
+	"resource_type":          {"Microsoft.Web/sites", "Microsoft.Compute/virtualMachines", "Microsoft.Storage/storageAccounts"},
+	"search_term":            {"timeout", "error", "invoice"},
+	"secret_name":            {"db-password", "api-key", "storage-connection-string"},
+	"server":                 {"contoso-pg", "fabrikam-postgres-01", "northwind-db"},
+	"service_bus_name":       {"contoso-bus", "fabrikam-messaging", "northwind-sb"},
+	"service_name":           {"contoso-search", "fabrikam-search-eus", "catalog-search"},
+	"storage_account_name":   {"contosostorage", "fabrikamlogs01", "northwinddata"},
+	"subscription_name":      {"Contoso Production", "Fabrikam Dev/Test", "Northwind Sandbox"},
+	"table":                  {"Orders", "StormEvents", "AppRequests"},
+	"table_name":             {"Orders", "StormEvents", "AppRequests"},
+	"time_period":            {"24 hours", "7 days", "hour"},
+	"topic_name":             {"order-events", "audit", "price-updates"},
+	"value":                  {"true", "30", "https://contoso.example.com"},
+	"workspace_name":         {"contoso-logs", "fabrikam-workspace", "northwind-law"},
+}
+
+// loadPlaceholderValues loads placeholder values from a JSON file: {"placeholder_name": ["value", ...], ...};
+// they replace the built-in values for the placeholders they list.
+func loadPlaceholderValues(filename string) map[string][]string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read placeholder values file %s: %v", filename, err)
+	}
+	loaded := map[string][]string{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Fatalf("Failed to parse placeholder values JSON from %s: %v", filename, err)
+	}
+	values := map[string][]string{}
+	for name, v := range loaded {
+		values[normalizePlaceholder(name)] = v
+	}
+	return values
+}
+
+func normalizePlaceholder(name string) string {
+	return strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(name))
+}
+
+// Value returns the value for the i'th instantiation of a placeholder.
+func (g *placeholderGenerator) Value(name string, i int) string {
+	name = normalizePlaceholder(name)
+	if values := g.Values[name]; len(values) > 0 {
+		return values[i%len(values)]
+	}
+	stem := strings.TrimSuffix(name, "_name")
+	return fmt.Sprintf("contoso-%s-%d", strings.ReplaceAll(stem, "_", "-"), i+1)
+}
+
+// Instantiate returns the prompt with each placeholder replaced by its i'th value.
+func (g *placeholderGenerator) Instantiate(prompt string, i int) string {
+	return placeholderPattern.ReplaceAllStringFunc(prompt, func(m string) string {
+		return g.Value(placeholderPattern.FindStringSubmatch(m)[1], i)
+	})
+}
+
+// reportPlaceholderRobustness runs each prompt containing placeholders literally & in n instantiations
+// with synthetic values, reporting how often each passes (see testCase.Passed) & the prompts whose outcome changes.
+func reportPlaceholderRobustness(s searcher, g *placeholderGenerator, n int, testCases []testCase, o QueryOptions) {
+	o.TopK = cmp.Or(o.TopK, 10)
+	start := time.Now()
+	type fragile struct {
+		Expected, Prompt string
+		Literal          bool   // The literal prompt passed
+		Hits             int    // Instantiations passing
+		Example          string // An instantiation whose outcome differs from the literal prompt's
+	}
+	prompts, literalHits, instantiationHits, stable := 0, 0, 0, 0
+	fragiles := []fragile{}
+	for _, c := range embedPromptCases(testCases) {
+		if !placeholderPattern.MatchString(c.Prompt) {
+			continue
+		}
+		prompts++
+		f := fragile{Expected: c.ExpectedString(), Prompt: c.Prompt, Literal: c.Passed(s.Search(c.Query(), c.Vector, o))}
+		if f.Literal {
+			literalHits++
+		}
+		for i := range n {
+			p := g.Instantiate(c.Prompt, i)
+			hit := c.Passed(s.Search(conversationContext.Text(c.Conversation, p), mustEmbed(embedInContext(c.Conversation, p)), o))
+			if hit {
+				f.Hits++
+			}
+			if hit != f.Literal && f.Example == "" {
+				f.Example = p
+			}
+		}
+		instantiationHits += f.Hits
+		if f.Example == "" {
+			stable++
+		} else {
+			fragiles = append(fragiles, f)
+		}
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Placeholder Robustness")
+		fmt.Println()
+		fmt.Printf("**Prompts with placeholders:** %d (%d instantiations each)  \n", prompts, n)
+		fmt.Printf("**Pass rate with literal placeholders:** %.1f%%  \n", percent(literalHits, prompts))
+		fmt.Printf("**Pass rate with synthetic values:** %.1f%%  \n", percent(instantiationHits, prompts*n))
+		fmt.Printf("**Prompts with the same outcome in every instantiation:** %.1f%%  \n", percent(stable, prompts))
+		fmt.Println()
+		if len(fragiles) > 0 {
+			fmt.Println("| Expected Tool | Prompt | Literal Passed | Instantiations Passed | Differing Instantiation |")
+			fmt.Println("|---------------|--------|----------------|-----------------------|-------------------------|")
+			for _, f := range fragiles {
+				literal := "❌"
+				if f.Literal {
+					literal = "✅"
+				}
+				fmt.Printf("| `%s` | %s | %s | %d/%d | %s |\n", f.Expected, f.Prompt, literal, f.Hits, n, f.Example)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nPlaceholder robustness: prompts with placeholders=%d, instantiations=%d\n", prompts, n)
+		fmt.Printf("   Pass rate with literal placeholders=%.1f%%, with synthetic values=%.1f%%, same outcome in every instantiation=%.1f%%\n",
+			percent(literalHits, prompts), percent(instantiationHits, prompts*n), percent(stable, prompts))
+		for _, f := range fragiles {
+			fmt.Printf("\n   Expected tool: %s, literal passed=%t, instantiations passed=%d/%d\n      Prompt: %s\n      Differs: %s\n",
+				f.Expected, f.Literal, f.Hits, n, f.Prompt, f.Example)
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// testCase is one evaluation prompt & what selecting tools for it must achieve.
+type testCase struct {
+	ID          string   `json:"id,omitempty"`
+	Prompt      string   `json:"prompt"`
+	Tags        []string `json:"tags,omitempty"`
+	Expected    []string `json:"expected,omitempty"`    // Acceptable tools (any of); empty for a negative (out-of-scope) case
+	Forbidden   []string `json:"forbidden,omitempty"`   // Tools that must not appear in the results (the top K)
+	NoToolAbove *float32 `json:"noToolAbove,omitempty"` // If set, no result may score at or above this
+	Rank        int      `json:"rank,omitempty"`        // An acceptable tool must rank at or above this; default 1
+
+	Conversation []conversationTurn `json:"conversation,omitempty"` // The turns before the prompt (oldest first), if it depends on them
+}
+
+// prompts.json v2: {"version": 2, "cases": [testCase, ...]}
+type promptsFileV2 struct {
+	Version int        `json:"version"`
+	Cases   []testCase `json:"cases"`
+}
+
+// loadPromptsFromJSON loads the test cases from a JSON file in either format:
+//   - v1: {"tool-name": ["prompt1", "prompt2", ...], ...}; each prompt expects its tool at rank 1
+//   - v2: {"version": 2, "cases": [{"id": ..., "prompt": ..., "expected": [...], ...}, ...]}; a case's
+//     "conversation" ([{"role": "user", "content": ...}, ...]) holds the turns its prompt depends on
+//
+// A tool name may be qualified by its server ("server/tool-name") when evaluating a federated catalog.
+// This allows for easy modification of test prompts without recompiling the application.
+func loadPromptsFromJSON(filename string) []testCase {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read prompts file %s: %v", filename, err)
+	}
+	cases, err := parsePrompts(data)
+	if err != nil {
+		log.Fatalf("Failed to parse prompts JSON from %s: %v", filename, err)
+	}
+	return cases
+}
+
+// parsePrompts parses a prompts file; a JSON object with a "version" key is a v2 file (or an unsupported
+// version), so its errors are reported rather than retried as v1.
+func parsePrompts(data []byte) ([]testCase, error) {
+	keys := map[string]json.RawMessage{}
+	_ = json.Unmarshal(data, &keys) // A v1 file is an object too; any other document fails to parse as v1 below
+	if _, versioned := keys["version"]; versioned {
+		v2 := promptsFileV2{}
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, fmt.Errorf("invalid v2 prompts file: %w", err)
+		}
+		if v2.Version != 2 {
+			return nil, fmt.Errorf("unsupported prompts file version %d; expected 2 or a v1 file (which has no version)", v2.Version)
+		}
+		for i := range v2.Cases {
+			c := &v2.Cases[i]
+			if c.ID == "" {
+				c.ID = fmt.Sprintf("case-%d", i+1)
+			}
+			if c.Prompt == "" {
+				return nil, fmt.Errorf("case %s has no prompt", c.ID)
+			}
+		}
+		return v2.Cases, nil
+	}
+
+	var v1 map[string][]string
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	cases := []testCase{}
+	for _, toolName := range slices.Sorted(maps.Keys(v1)) {
+		for i, p := range v1[toolName] {
+			cases = append(cases, testCase{ID: fmt.Sprintf("%s#%d", toolName, i+1), Prompt: p, Expected: []string{toolName}})
+		}
+	}
+	return cases, nil
+}
+
+// appendPrompt adds a case expecting tool for prompt to the prompts file & returns the case's ID. A v1 file keeps
+// its tools in their order with the prompt added to the end of tool's list (or a new list at the end of the file).
+func appendPrompt(filename, tool, prompt string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	id := ""
+	if v2 := (promptsFileV2{}); json.Unmarshal(data, &v2) == nil && v2.Version == 2 {
+		ids := map[string]bool{}
+		for i, c := range v2.Cases {
+			ids[cmp.Or(c.ID, fmt.Sprintf("case-%d", i+1))] = true
+		}
+		for n := len(v2.Cases) + 1; id == "" || ids[id]; n++ {
+			id = fmt.Sprintf("case-%d", n)
+		}
+		v2.Cases = append(v2.Cases, testCase{ID: id, Prompt: prompt, Expected: []string{tool}})
+		if err := marshalJSON(buf, v2); err != nil {
+			return "", err
+		}
+	} else {
+		d := json.NewDecoder(bytes.NewReader(data))
+		if t, err := d.Token(); err != nil || t != json.Delim('{') {
+			return "", fmt.Errorf("%s isn't a prompts file", filename)
+		}
+		buf.WriteString("{")
+		found := false
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return "", err
+			}
+			prompts := []string{}
+			if err := d.Decode(&prompts); err != nil {
+				return "", err
+			}
+			if key == tool {
+				prompts, found = append(prompts, prompt), true
+				id = fmt.Sprintf("%s#%d", tool, len(prompts))
+			}
+			if buf.Len() > 1 {
+				buf.WriteString(",")
+			}
+			if err := marshalJSON(buf, key); err != nil {
+				return "", err
+			}
+			buf.WriteString(":")
+			if err := marshalJSON(buf, prompts); err != nil {
+				return "", err
+			}
+		}
+		if !found {
+			if buf.Len() > 1 {
+				buf.WriteString(",")
+			}
+			must(0, marshalJSON(buf, tool))
+			buf.WriteString(":")
+			must(0, marshalJSON(buf, []string{prompt}))
+			id = tool + "#1"
+		}
+		buf.WriteString("}")
+	}
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, buf.Bytes(), "", "    "); err != nil {
+		return "", err
+	}
+	return id, os.WriteFile(filename, indented.Bytes(), 0o644)
+}
+
+// marshalJSON appends v's JSON to buf without escaping the "<" & ">" of placeholders.
+func marshalJSON(buf *bytes.Buffer, v any) error {
+	e := json.NewEncoder(buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // Encode's newline
+	return nil
+}
+
+// examplesByTool returns the prompts of cases keyed by each of their acceptable tools (the structure of
+// indexOptions.Examples).
+func examplesByTool(cases []testCase) map[string][]string {
+	examples := map[string][]string{}
+	for _, c := range cases {
+		for _, tool := range c.Expected {
+			examples[tool] = append(examples[tool], c.Prompt)
+		}
+	}
+	return examples
+}
+
+// IsNegative returns true if no tool should be selected for the case: it passes only if no result is returned
+// (e.g. they all scored below QueryOptions.MinimumScore) or, if NoToolAbove is set, none scores that high.
+func (c *testCase) IsNegative() bool { return len(c.Expected) == 0 }
+
+// MaxRank returns the rank at or above which an acceptable tool must be.
+func (c *testCase) MaxRank() int { return max(c.Rank, 1) }
+
+// Accepts returns true if e is one of the case's acceptable tools.
+func (c *testCase) Accepts(e *Entry) bool {
+	return slices.ContainsFunc(c.Expected, func(expected string) bool { return matchesExpected(e, expected) })
+}
+
+// Forbids returns true if e is one of the case's forbidden tools.
+func (c *testCase) Forbids(e *Entry) bool {
+	return slices.ContainsFunc(c.Forbidden, func(forbidden string) bool { return matchesExpected(e, forbidden) })
+}
+
+// acceptedEntries returns the entries in db that are acceptable tools for c.
+func acceptedEntries(db *VectorDB, c *testCase) []*Entry {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return slices.DeleteFunc(slices.Clone(db.entries), func(e *Entry) bool { return !c.Accepts(e) })
+}
+
+// ExpectedString describes the acceptable tools for reports.
+func (c *testCase) ExpectedString() string {
+	if c.IsNegative() {
+		return "(none)"
+	}
+	return strings.Join(c.Expected, " | ")
+}
+
+// Passed returns true if results (the top K, best first) meet all the case's expectations.
+func (c *testCase) Passed(results []QueryResult) bool {
+	if slices.ContainsFunc(results, func(qr QueryResult) bool { return c.Forbids(qr.Entry) }) {
+		return false
+	}
+	if c.NoToolAbove != nil && len(results) > 0 && results[0].Score >= *c.NoToolAbove {
+		return false
+	}
+	if c.IsNegative() {
+		return c.NoToolAbove != nil || len(results) == 0
+	}
+	rank := expectedRank(results, c)
+	return rank > 0 && rank <= c.MaxRank()
+}
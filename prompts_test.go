@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePrompts(t *testing.T) {
+	noToolAbove := float32(0.4)
+	tests := []struct {
+		name    string
+		data    string
+		want    []testCase
+		wantErr string // A substring of the error; "" for none
+	}{
+		{"v1", `{"b-tool": ["Do b"], "a-tool": ["Do a", "Do a for {resource_name}"]}`, []testCase{
+			{ID: "a-tool#1", Prompt: "Do a", Expected: []string{"a-tool"}},
+			{ID: "a-tool#2", Prompt: "Do a for {resource_name}", Expected: []string{"a-tool"}},
+			{ID: "b-tool#1", Prompt: "Do b", Expected: []string{"b-tool"}},
+		}, ""},
+		{"v2", `{"version": 2, "cases": [
+			{"id": "list", "prompt": "List the accounts in <subscription>", "expected": ["account-list"], "forbidden": ["account-delete"], "rank": 2},
+			{"prompt": "What's the weather?", "noToolAbove": 0.4, "tags": ["negative"]},
+			{"prompt": "Delete it", "expected": ["account-delete"], "conversation": [
+				{"role": "user", "content": "Show the account named prod"}, {"role": "assistant", "content": "prod is in westus"}]}
+		]}`, []testCase{
+			{ID: "list", Prompt: "List the accounts in <subscription>", Expected: []string{"account-list"},
+				Forbidden: []string{"account-delete"}, Rank: 2},
+			{ID: "case-2", Prompt: "What's the weather?", NoToolAbove: &noToolAbove, Tags: []string{"negative"}},
+			{ID: "case-3", Prompt: "Delete it", Expected: []string{"account-delete"}, Conversation: []conversationTurn{
+				{Role: "user", Content: "Show the account named prod"}, {Role: "assistant", Content: "prod is in westus"}}},
+		}, ""},
+		{"v2 without cases", `{"version": 2}`, nil, ""},
+		{"unsupported version", `{"version": 3, "cases": []}`, nil, "unsupported prompts file version 3"},
+		{"v2 case without a prompt", `{"version": 2, "cases": [{"id": "x", "expected": ["a"]}]}`, nil, "case x has no prompt"},
+		// A v2 file's errors are reported as such rather than as a failure to parse it as v1
+		{"invalid v2", `{"version": 2, "cases": {"prompt": "x"}}`, nil, "invalid v2 prompts file"},
+		{"invalid v1", `{"a-tool": "Do a"}`, nil, "cannot unmarshal"},
+		{"not an object", `["Do a"]`, nil, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cases, err := parsePrompts([]byte(tt.data))
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(cases, tt.want):
+				t.Errorf("got %+v, want %+v", cases, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The proxy is an MCP server that sits in front of one or more upstream MCP servers. It indexes all the
+// upstream tools into a federated Catalog and answers tools/list with only the tools most similar to the
+// client's latest intent; tools/call is forwarded to whichever upstream server owns the tool. Clients see
+// each tool's server-qualified name ("server/name") so tools with the same name on different servers
+// remain distinct.
+// The intent is supplied either in the tools/list request's _meta (under intentMetaKey) or by calling
+// the proxy's own set_intent tool, after which the proxy sends notifications/tools/list_changed.
+
+const (
+	intentMetaKey = "toolselection/intent"
+	setIntentTool = "set_intent"
+)
+
+type proxy struct {
+	db        *VectorDB
+	catalog   *Catalog
+	topK      int
+	minScore  float32             // Tools scoring below this don't fit the intent
+	filter    func(e *Entry) bool // Selects the upstream tools that may be exposed; nil for all
+	searcher  *catalogSearcher    // The stages of -hybrid, -intent, ... (see searchFlags), rebuilt as upstream tools change
+	server    *mcp.Server
+	upstreams map[string]*upstream // Server name -> upstream
+
+	mu           sync.Mutex
+	intent       string
+	intentVector []float32
+}
+
+// upstream is an MCP server whose tools the proxy indexes & forwards calls to.
+type upstream struct {
+	name      string // The server's name in the catalog
+	cmdLine   string
+	client    *mcp.Client
+	refreshMu sync.Mutex // Serializes refreshes so overlapping list_changed notifications don't interleave
+}
+
+// multiFlag collects the values of a repeatable flag.
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ", ") }
+func (m *multiFlag) Set(s string) error { *m = append(*m, s); return nil }
+
+// splitNamed splits a "name=value" flag value; name is "" if there's no "=" before the first space.
+func splitNamed(s string) (name, value string) {
+	if n, v, ok := strings.Cut(s, "="); ok && !strings.ContainsAny(n, " \t") {
+		return n, v
+	}
+	return "", s
+}
+
+func runProxy(args []string) {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	upstreamCmds, disabled := multiFlag{}, multiFlag{}
+	fs.Var(&upstreamCmds, "upstream", "[name=]command line that starts an upstream MCP server over stdio (repeatable); "+
+		"name defaults to the server's reported name")
+	fs.Var(&disabled, "disable", "name of an upstream server whose tools are hidden (repeatable)")
+	topK := fs.Int("k", 10, "number of tools returned by tools/list")
+	minScore := fs.Float64("min-score", 0, "minimum score of a tool returned by tools/list; see the evaluation's out-of-scope threshold")
+	document := fs.String("document", defaultDocumentBuilder, fmt.Sprintf("how each tool's embedded text is composed: "+
+		"one of %v or a text/template", documentBuilderNames()))
+	embedder := fs.String("embedder", "aoai", fmt.Sprintf("embedder: one of %v", embedderNames()))
+	filterExpr := fs.String("filter", "", "expression selecting the upstream tools that may be exposed (see filter.go)")
+	searchFlags := addSearchFlags(fs)
+	must(0, fs.Parse(args))
+	builder, err := lookupDocumentBuilder(*document)
+	if err == nil {
+		err = setEmbedder(*embedder)
+	}
+	var filter func(e *Entry) bool
+	if err == nil {
+		filter, err = compileFilter(*filterExpr)
+	}
+	var search *searchConfig
+	if err == nil {
+		search, err = searchFlags.parse()
+	}
+	if err != nil {
+		log.Fatalf("proxy: %v", err)
+	}
+	if len(upstreamCmds) == 0 {
+		log.Fatalf("proxy: at least one -upstream is required")
+	}
+
+	ctx := context.Background()
+	p := &proxy{db: NewVectorDB(CosineSimilarity{}, nil), topK: *topK, minScore: float32(*minScore), filter: filter,
+		upstreams: map[string]*upstream{}}
+	io := &indexOptions{Builder: builder}
+	p.catalog, p.searcher = NewCatalog(p.db, io), newCatalogSearcher(search, p.db, io)
+	p.server = &mcp.Server{Info: mcp.Implementation{BaseMetadata: mcp.BaseMetadata{Name: "tool-selection-proxy"}, Version: "0.1.0"}, Tools: p}
+	for _, namedCmdLine := range upstreamCmds {
+		name, cmdLine := splitNamed(namedCmdLine)
+		if err := p.addUpstream(ctx, name, cmdLine); err != nil {
+			log.Fatalf("proxy: %v", err)
+		}
+	}
+	for _, name := range disabled {
+		if !p.catalog.SetEnabled(name, false) {
+			log.Fatalf("proxy: -disable %q: no such upstream server; servers are %v", name, p.catalog.Servers())
+		}
+	}
+	for _, c := range p.catalog.Collisions() {
+		log.Printf("proxy: tool %q is exposed by servers %v", c.Name, c.Servers)
+	}
+
+	if err := p.server.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("proxy: %v", err)
+	}
+}
+
+// addUpstream launches an upstream server, names it (after the server if name is "") & indexes its tools.
+func (p *proxy) addUpstream(ctx context.Context, name, cmdLine string) error {
+	u := &upstream{cmdLine: cmdLine}
+	// The server may send tools/list_changed as soon as it's initialized; holding refreshMu makes the
+	// refresh that triggers wait until u is complete.
+	u.refreshMu.Lock()
+	client, err := startUpstream(ctx, cmdLine, func() { p.refresh(ctx, u) })
+	if err != nil {
+		u.refreshMu.Unlock()
+		return err
+	}
+	u.client, u.name = client, name
+	if u.name == "" {
+		u.name = u.client.ServerInfo.Name
+	}
+	for base, n := u.name, 2; p.upstreams[u.name] != nil; n++ { // Make the name unique
+		u.name = fmt.Sprintf("%s-%d", base, n)
+	}
+	p.upstreams[u.name] = u
+	u.refreshMu.Unlock()
+	p.refresh(ctx, u)
+	return nil
+}
+
+// refresh fetches an upstream server's tools & incrementally re-indexes them; if anything changed, the
+// proxy's client is told to re-fetch tools/list.
+func (p *proxy) refresh(ctx context.Context, u *upstream) {
+	u.refreshMu.Lock()
+	defer u.refreshMu.Unlock()
+	tools, err := u.client.ListTools(ctx)
+	if err != nil {
+		log.Printf("proxy: listing tools of %q: %v", u.name, err)
+		return
+	}
+	stats, err := p.catalog.SetServerTools(u.name, tools)
+	if err != nil {
+		log.Printf("proxy: indexing tools of %q: %v", u.name, err)
+		return
+	}
+	log.Printf("proxy: indexed tools from %q: %d added, %d removed, %d changed, %d unchanged",
+		u.name, stats.Added, stats.Removed, stats.Changed, stats.Unchanged)
+	if stats.Added+stats.Removed+stats.Changed > 0 {
+		p.searcher.Rebuild()
+		_ = p.server.NotifyToolsListChanged() // Fails harmlessly if the proxy's client hasn't connected yet
+	}
+}
+
+// startUpstream launches an MCP server process and performs the initialization handshake with it;
+// onToolsListChanged is called whenever the server's tools change.
+func startUpstream(ctx context.Context, cmdLine string, onToolsListChanged func()) (*mcp.Client, error) {
+	fields := strings.Fields(cmdLine)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty upstream command")
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client := mcp.NewClient(stdout, stdin, onToolsListChanged)
+	go func() {
+		if err := client.Run(ctx); err != nil {
+			log.Printf("upstream %q: %v", cmdLine, err)
+		}
+	}()
+	if err := client.Initialize(ctx, mcp.Implementation{BaseMetadata: mcp.BaseMetadata{Name: "tool-selection-proxy"}, Version: "0.1.0"}); err != nil {
+		return nil, fmt.Errorf("initializing upstream %q: %w", cmdLine, err)
+	}
+	return client, nil
+}
+
+func (p *proxy) ListTools(ctx context.Context, params *mcp.PaginatedRequestParams) (*mcp.ListToolsResult, error) {
+	if params.Meta != nil {
+		if intent, ok := (*params.Meta)[intentMetaKey].(string); ok {
+			if _, err := p.setIntent(intent); err != nil {
+				return nil, &mcp.RPCError{Code: mcp.InternalError, Message: "setting the intent: " + err.Error()}
+			}
+		}
+	}
+	result := &mcp.ListToolsResult{Tools: []mcp.Tool{setIntentToolDefinition()}}
+
+	p.mu.Lock()
+	intent, vector := p.intent, p.intentVector
+	p.mu.Unlock()
+	if vector == nil {
+		return result, nil // No intent yet; the client must set one to see any upstream tools
+	}
+	for _, qr := range p.query(intent, vector) {
+		t := *qr.Entry.Metadata.(*mcp.Tool)
+		t.Name = string(qr.Entry.ID) // Clients see server-qualified names; CallTool maps them back
+		result.Tools = append(result.Tools, t)
+	}
+	return result, nil
+}
+
+func (p *proxy) CallTool(ctx context.Context, params *mcp.CallToolRequestParams) (*mcp.CallToolResult, error) {
+	if params.Name == setIntentTool {
+		intent, _ := params.Arguments["intent"].(string)
+		if strings.TrimSpace(intent) == "" {
+			return mcp.TextResult("The 'intent' argument is required.", true), nil
+		}
+		vector, err := p.setIntent(intent)
+		if err != nil {
+			return mcp.TextResult("Failed to set the intent: "+err.Error(), true), nil
+		}
+		if err := p.server.NotifyToolsListChanged(); err != nil {
+			log.Printf("proxy: %v", err)
+		}
+		names := []string{}
+		for _, qr := range p.query(intent, vector) {
+			names = append(names, string(qr.Entry.ID))
+		}
+		return mcp.TextResult("Intent set. Available tools: "+strings.Join(names, ", "), false), nil
+	}
+
+	e, ok := p.db.Get(ID(params.Name))
+	if !ok || !p.catalog.Predicate(p.filter)(e) {
+		return nil, &mcp.RPCError{Code: mcp.InvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	t := e.Metadata.(*mcp.Tool)
+	// A malformed inputSchema was logged when the tool was indexed; the upstream server validates the arguments
+	if err := t.ValidateArguments(params.Arguments); errors.As(err, new(mcp.SchemaErrors)) {
+		return mcp.TextResult("Invalid arguments for tool "+params.Name+": "+err.Error(), true), nil
+	}
+	forwarded := *params
+	forwarded.Name = t.Name // The upstream server knows the tool by its unqualified name
+	result, err := p.upstreams[toolServer(t)].client.CallTool(ctx, &forwarded)
+	if err == nil && (result.IsError == nil || !*result.IsError) {
+		if err := t.ValidateStructuredContent(result.StructuredContent); err != nil {
+			log.Printf("proxy: tool %q returned structuredContent that doesn't match its outputSchema: %v", params.Name, err)
+		}
+	}
+	return result, err
+}
+
+// query returns the tools of enabled servers (that the filter selects) best fitting intent, whose embedding is vector.
+func (p *proxy) query(intent string, vector []float32) []QueryResult {
+	o := QueryOptions{TopK: p.topK, MinimumScore: p.minScore, Predicate: p.catalog.Predicate(p.filter)}
+	return p.searcher.Search(conversationContext.Text(nil, intent), vector, o) // One line, so it's all the latest message
+}
+
+// setIntent records the client's latest intent & returns its vector; the embedding is only recomputed
+// if the intent changed. The embedding is computed without holding p.mu so a slow embedding service doesn't
+// block tools/list requests. If the embedding fails, the previous intent is kept.
+func (p *proxy) setIntent(intent string) ([]float32, error) {
+	p.mu.Lock()
+	if intent == p.intent {
+		defer p.mu.Unlock()
+		return p.intentVector, nil
+	}
+	p.mu.Unlock()
+	vector, err := createEmbeddings(intent)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.intent, p.intentVector = intent, vector
+	return vector, nil
+}
+
+func setIntentToolDefinition() mcp.Tool {
+	description := "Describe what you are trying to accomplish. Call this before anything else and whenever your goal changes; " +
+		"the list of available tools is then replaced with the tools most relevant to that intent."
+	return mcp.Tool{
+		BaseMetadata: mcp.BaseMetadata{Name: setIntentTool},
+		Description:  &description,
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {"intent": {"type": "string", ` +
+			`"description": "What the user wants to do, in natural language."}}, "required": ["intent"]}`),
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// TestHelperUpstream isn't a test: run by TestProxyIndexesToolsChangedDuringInitialize, it's an upstream MCP
+// server that announces a change to its tools during initialization & lists 1 more tool each time.
+func TestHelperUpstream(t *testing.T) {
+	if os.Getenv("TOOLSELECTION_HELPER_UPSTREAM") != "1" {
+		t.Skip("only run as an upstream server")
+	}
+	conn, names := (*mcp.Conn)(nil), []string{}
+	conn = mcp.NewConn(os.Stdin, os.Stdout, func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case mcp.MethodInitialize:
+			if err := conn.Notify(mcp.NotificationToolsListChanged, nil); err != nil {
+				return nil, err
+			}
+			return mcp.InitializeResult{ProtocolVersion: mcp.LatestProtocolVersion,
+				ServerInfo: mcp.Implementation{BaseMetadata: mcp.BaseMetadata{Name: "helper"}, Version: "1.0"}}, nil
+		case mcp.MethodToolsList:
+			names = append(names, []string{"storage-account-list", "storage-account-delete"}[len(names)%2])
+			result := &mcp.ListToolsResult{}
+			for _, name := range names {
+				result.Tools = append(result.Tools, newTestTool(name, name))
+			}
+			return result, nil
+		}
+		return nil, nil
+	})
+	_ = conn.Run(context.Background())
+	os.Exit(0)
+}
+
+func TestProxyIndexesToolsChangedDuringInitialize(t *testing.T) {
+	useCountingEmbedder(t)
+	t.Setenv("TOOLSELECTION_HELPER_UPSTREAM", "1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	io := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	p := &proxy{db: NewVectorDB(CosineSimilarity{}, nil), upstreams: map[string]*upstream{}, server: &mcp.Server{}}
+	p.catalog, p.searcher = NewCatalog(p.db, io), newCatalogSearcher(&searchConfig{}, p.db, io)
+	if err := p.addUpstream(ctx, "", os.Args[0]+" -test.run=^TestHelperUpstream$"); err != nil {
+		t.Fatal(err)
+	}
+	u := p.upstreams["helper"]
+	if u == nil {
+		t.Fatalf("got upstreams %v, want helper", p.upstreams)
+	}
+	indexed := func() []ID {
+		u.refreshMu.Lock()
+		defer u.refreshMu.Unlock()
+		return dbIDs(p.db)
+	}
+	// The refresh for the notification & the initial one both list the tools; the second lists both tools
+	for deadline := time.Now().Add(5 * time.Second); len(indexed()) < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got tools %v, want the tools of a 2nd listing", indexed())
+		}
+	}
+	if got := p.catalog.Servers(); !slices.Equal(got, []string{"helper"}) {
+		t.Errorf("got servers %v, want [helper]", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"slices"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// reindexStats summarizes what reindexTools changed.
+type reindexStats struct {
+	Added, Removed, Changed, Unchanged int
+}
+
+// reindexTools incrementally updates db so that the entries previously indexed from one source (the IDs in
+// previous) match that source's current tools. Only tools that were added or whose embedded text changed are
+// re-embedded; tools whose other fields (schema, annotations, ...) changed keep their vector but get the new
+// metadata. Entries in previous that are no longer in tools are deleted. If embedding fails, the tools that
+// weren't re-embedded keep their old entries & nothing is deleted. A malformed inputSchema is logged when its
+// tool is added or the schema changes.
+func reindexTools(db *VectorDB, o *indexOptions, previous map[ID]bool, tools []mcp.Tool) (reindexStats, error) {
+	stats := reindexStats{}
+	current := map[ID]bool{}
+	toEmbed := []mcp.Tool{}
+	for _, t := range tools {
+		id := entryID(&t)
+		current[id] = true
+		e, ok := db.Get(id)
+		if !ok || !bytes.Equal(schemaOf(e), t.InputSchema) {
+			if err := mcp.CheckSchema(t.InputSchema); err != nil {
+				log.Printf("tool %q: %v; its arguments won't be validated", id, err)
+			}
+		}
+		if !ok {
+			stats.Added++
+			toEmbed = append(toEmbed, t)
+			continue
+		}
+		old, _ := e.Metadata.(*mcp.Tool)
+		switch {
+		case old == nil || !sameDocuments(o, old, &t):
+			stats.Changed++
+			toEmbed = append(toEmbed, t)
+		case !sameTool(old, &t):
+			stats.Changed++
+			db.Upsert(&Entry{ID: id, Metadata: &t, Vector: e.Vector, Vectors: e.Vectors})
+		default:
+			stats.Unchanged++
+		}
+	}
+	if err := tools2DB(db, toEmbed, o); err != nil {
+		return stats, err
+	}
+
+	for id := range previous {
+		if !current[id] {
+			stats.Removed++
+			db.Delete(id)
+		}
+	}
+	return stats, nil
+}
+
+// sameDocuments returns true if all the texts embedded for both tools are the same; a tool whose document
+// can't be built is considered changed.
+func sameDocuments(o *indexOptions, a, b *mcp.Tool) bool {
+	documentA, extrasA, errA := o.documents(a)
+	documentB, extrasB, errB := o.documents(b)
+	return errA == nil && errB == nil && documentA == documentB && slices.Equal(extrasA, extrasB)
+}
+
+// sameTool returns true if both tools serialize to the same JSON.
+func sameTool(a, b *mcp.Tool) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// schemaOf returns the inputSchema of e's tool.
+func schemaOf(e *Entry) json.RawMessage {
+	if t, ok := e.Metadata.(*mcp.Tool); ok {
+		return t.InputSchema
+	}
+	return nil
+}
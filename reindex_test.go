@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// useCountingEmbedder makes createEmbeddings embed with hashEmbeddings (until the test ends), recording the
+// texts embedded in the returned slice.
+func useCountingEmbedder(t *testing.T) *[]string {
+	mu, embedded := sync.Mutex{}, &[]string{}
+	useEmbedder(t, func(input string) ([]float32, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*embedded = append(*embedded, input)
+		return hashEmbeddings(input), nil
+	})
+	return embedded
+}
+
+// useEmbedder makes createEmbeddings embed with e until the test ends.
+func useEmbedder(t *testing.T, e embedder) {
+	previous := embedderName
+	embedders["test"], embedderName = e, "test"
+	t.Cleanup(func() { embedderName = previous; delete(embedders, "test") })
+}
+
+func TestReindexTools(t *testing.T) {
+	yes := true
+	list := newTestTool("storage-account-list", "List the storage accounts in a subscription")
+	get := newTestTool("storage-account-get", "Get a storage account's details")
+	del := newTestTool("storage-account-delete", "Delete a storage account")
+	create := newTestTool("storage-account-create", "Create a storage account")
+	described := get
+	description := "Show a storage account's properties"
+	described.Description = &description
+	annotated := get
+	annotated.Annotations = &mcp.ToolAnnotations{ReadOnlyHint: &yes}
+	schema := get
+	schema.InputSchema = []byte(`{"type": "object", "required": ["account"]}`)
+
+	tests := []struct {
+		name     string
+		tools    []mcp.Tool
+		want     reindexStats
+		embedded []ID // The tools re-embedded
+	}{
+		{"unchanged", []mcp.Tool{list, get, del}, reindexStats{Unchanged: 3}, nil},
+		{"added", []mcp.Tool{list, get, del, create}, reindexStats{Added: 1, Unchanged: 3}, []ID{"storage-account-create"}},
+		{"removed", []mcp.Tool{list, get}, reindexStats{Removed: 1, Unchanged: 2}, nil},
+		{"description changed", []mcp.Tool{list, described, del}, reindexStats{Changed: 1, Unchanged: 2}, []ID{"storage-account-get"}},
+		{"annotations changed", []mcp.Tool{list, annotated, del}, reindexStats{Changed: 1, Unchanged: 2}, nil},
+		{"schema changed", []mcp.Tool{list, schema, del}, reindexStats{Changed: 1, Unchanged: 2}, nil},
+		{"all at once", []mcp.Tool{described, create, list}, reindexStats{Added: 1, Removed: 1, Changed: 1, Unchanged: 1},
+			[]ID{"storage-account-create", "storage-account-get"}},
+	}
+	o := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedded := useCountingEmbedder(t)
+			db, previous := NewVectorDB(CosineSimilarity{}, nil), map[ID]bool{}
+			if err := tools2DB(db, []mcp.Tool{list, get, del}, o); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range dbIDs(db) {
+				previous[id] = true
+			}
+			before := map[ID][]float32{}
+			for id := range previous {
+				e, _ := db.Get(id)
+				before[id] = e.Vector
+			}
+			*embedded = nil
+
+			stats, err := reindexTools(db, o, previous, tt.tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats != tt.want {
+				t.Errorf("got %+v, want %+v", stats, tt.want)
+			}
+			// Each tool (indexed with no extra vectors) embeds exactly its document
+			reembedded := []ID{}
+			for i := range tt.tools {
+				document, _, _ := o.documents(&tt.tools[i])
+				if slices.Contains(*embedded, document) {
+					reembedded = append(reembedded, entryID(&tt.tools[i]))
+				}
+			}
+			slices.Sort(reembedded)
+			if len(*embedded) != len(tt.embedded) || !slices.Equal(reembedded, tt.embedded) {
+				t.Errorf("re-embedded %v (%d texts), want %v", reembedded, len(*embedded), tt.embedded)
+			}
+
+			// The DB holds exactly the current tools, with their current metadata; tools not re-embedded keep their vectors
+			if got, want := dbIDs(db), toolIDs(tt.tools); !slices.Equal(got, want) {
+				t.Errorf("DB has %v, want %v", got, want)
+			}
+			for i := range tt.tools {
+				e, _ := db.Get(entryID(&tt.tools[i]))
+				if !sameTool(e.Metadata.(*mcp.Tool), &tt.tools[i]) {
+					t.Errorf("%s has stale metadata", e.ID)
+				}
+				if !slices.Contains(tt.embedded, e.ID) && before[e.ID] != nil && !slices.Equal(e.Vector, before[e.ID]) {
+					t.Errorf("%s's vector changed without being re-embedded", e.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestReindexToolsEmbeddingFailure(t *testing.T) {
+	o := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	list := newTestTool("storage-account-list", "List the storage accounts in a subscription")
+	get := newTestTool("storage-account-get", "Get a storage account's details")
+	db := newTestDB(list, get)
+	useEmbedder(t, func(input string) ([]float32, error) {
+		return nil, fmt.Errorf("%w: throttled", errEmbedderUnavailable)
+	})
+	create := newTestTool("storage-account-create", "Create a storage account")
+	_, err := reindexTools(db, o, map[ID]bool{"storage-account-list": true, "storage-account-get": true}, []mcp.Tool{list, create})
+	if !errors.Is(err, errEmbeddingFailed) || !errors.Is(err, errEmbedderUnavailable) {
+		t.Errorf("got error %v, want an unavailable embedder's", err)
+	}
+	if got, want := dbIDs(db), []ID{"storage-account-get", "storage-account-list"}; !slices.Equal(got, want) {
+		t.Errorf("DB has %v, want %v (nothing deleted or added)", got, want)
+	}
+}
+
+func toolIDs(tools []mcp.Tool) []ID {
+	ids := []ID{}
+	for i := range tools {
+		ids = append(ids, entryID(&tools[i]))
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// dbIDs returns the IDs of db's entries, sorted.
+func dbIDs(db *VectorDB) []ID {
+	ids := []ID{}
+	for _, e := range db.entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// The REPL ranks the tools for each prompt typed, showing each tool's score, its margin (see resultMargins) &
+// the sentence of its description most similar to the prompt, so description writers see at once how an edit
+// or a wording of the prompt changes selection. Lines starting with ":" are commands (see replHelp).
+
+const replHelp = `Commands:
+  :k <n>                         show the top n tools
+  :metric <name>                 switch the distance metric (%v), dropping any calibration
+  :filter [expression]           only show the tools the filter expression selects, e.g.
+                                 annotations.readOnlyHint && server == "azmcp"; none removes the filter
+  :save <tool>                   add the last prompt to the prompts file as a case expecting tool
+  :help                          show this help
+  :quit                          exit
+Any other line is a prompt.
+`
+
+type repl struct {
+	db          *VectorDB
+	tools       []mcp.Tool
+	io          *indexOptions
+	search      *searchConfig // The -hybrid, -intent, ... stages setMetric rebuilds the searcher with
+	searcher    searcher
+	calibration *calibration
+	prompts     string // The prompts file :save adds cases to
+	o           QueryOptions
+	sentences   map[string][]float32 // Description sentence -> embedding
+	lastPrompt  string
+	out         io.Writer
+}
+
+func runREPL(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	f := addSelectionFlags(fs, 5)
+	prompts := fs.String("prompts", "prompts.json", "prompts file that :save adds cases to")
+	must(0, fs.Parse(args))
+	options, o, err := f.setup()
+	if err != nil {
+		log.Fatalf("repl: %v", err)
+	}
+	r := &repl{io: options, search: f.search, prompts: *prompts, o: o, sentences: map[string][]float32{}, out: os.Stdout}
+	r.tools, r.db, r.calibration = f.loadOrBuildIndex(options)
+	r.searcher = r.search.build(r.db, r.tools, options)
+	if err := r.calibration.Check(r.searcher); err != nil {
+		log.Fatalf("repl: %v", err)
+	}
+	fmt.Fprintf(r.out, "%d tools indexed. Type a prompt or :help.\n", getAllTools(r.db))
+	r.run(os.Stdin)
+}
+
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for fmt.Fprint(r.out, "> "); scanner.Scan(); fmt.Fprint(r.out, "> ") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			if err := r.query(line); err != nil {
+				fmt.Fprintf(r.out, "Error: %v\n", err)
+			}
+			continue
+		}
+		command, arg, _ := strings.Cut(line[1:], " ")
+		arg = strings.TrimSpace(arg)
+		var err error
+		switch command {
+		case "k":
+			err = r.setK(arg)
+		case "metric":
+			err = r.setMetric(arg)
+		case "filter":
+			err = r.setFilter(arg)
+		case "save":
+			err = r.save(arg)
+		case "help":
+			fmt.Fprintf(r.out, replHelp, distanceMetricNames())
+		case "quit", "exit", "q":
+			return
+		default:
+			err = fmt.Errorf("unknown command %q; type :help", command)
+		}
+		if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+	}
+	fmt.Fprintln(r.out)
+}
+
+func (r *repl) setK(arg string) error {
+	k, err := strconv.Atoi(arg)
+	if err != nil || k < 1 {
+		return fmt.Errorf("invalid k %q; expected a positive number", arg)
+	}
+	r.o.TopK = k
+	return nil
+}
+
+// setMetric rebuilds the DB with the same vectors & another metric.
+func (r *repl) setMetric(name string) error {
+	metric, ok := distanceMetrics[name]
+	if !ok {
+		return fmt.Errorf("unknown metric %q; expected one of %v", name, distanceMetricNames())
+	}
+	r.db = NewVectorDB(metric, cloneDB(r.db).entries)
+	r.searcher = r.search.build(r.db, r.tools, r.io)
+	r.calibration = nil // It was fit on another metric's scores
+	return nil
+}
+
+// setFilter replaces the filter (initially -filter's) with the filter expression; see compileFilter.
+func (r *repl) setFilter(expr string) error {
+	predicate, err := compileFilter(expr)
+	if err != nil {
+		return err
+	}
+	r.o.Predicate = predicate
+	return nil
+}
+
+func (r *repl) save(tool string) error {
+	if r.lastPrompt == "" {
+		return fmt.Errorf("no prompt to save yet")
+	}
+	if !slices.ContainsFunc(r.tools, func(t mcp.Tool) bool { return t.Name == tool || string(entryID(&t)) == tool }) {
+		return fmt.Errorf("unknown tool %q", tool)
+	}
+	id, err := appendPrompt(r.prompts, tool, r.lastPrompt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "Saved case %s to %s\n", id, r.prompts)
+	return nil
+}
+
+func (r *repl) query(prompt string) error {
+	r.lastPrompt = prompt
+	vector, err := embedQuery(prompt)
+	if err != nil {
+		return err
+	}
+	results, confidences := r.calibration.Search(r.searcher, r.db, prompt, vector, r.o)
+	margins := resultMargins(results)
+	for i, qr := range results {
+		confidence := ""
+		if confidences != nil {
+			confidence = fmt.Sprintf("  confidence %5.1f%%", confidences[i]*100)
+		}
+		fmt.Fprintf(r.out, "%2d. %-50s score %.4f  margin %+.4f%s\n", i+1, qr.Entry.ID, qr.Score, margins[i], confidence)
+		sentence, score, err := r.bestSentence(qr.Entry, vector)
+		if err != nil {
+			return err
+		}
+		if sentence != "" {
+			fmt.Fprintf(r.out, "      %.4f  %s\n", score, sentence)
+		}
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(r.out, "No tools found.")
+	}
+	return nil
+}
+
+// bestSentence returns the sentence of e's description most similar to vector (embedding each sentence once).
+func (r *repl) bestSentence(e *Entry, vector []float32) (string, float32, error) {
+	t, ok := e.Metadata.(*mcp.Tool)
+	if !ok || t.Description == nil {
+		return "", 0, nil
+	}
+	best, bestScore := "", float32(0)
+	for _, s := range descriptionSentences(*t.Description) {
+		v, ok := r.sentences[s]
+		if !ok {
+			var err error
+			if v, err = createEmbeddings(s); err != nil {
+				return "", 0, err
+			}
+			r.sentences[s] = v
+		}
+		if score := r.db.distanceMetric.Distance(vector, v); best == "" || closer(r.db.distanceMetric, score, bestScore) {
+			best, bestScore = s, score
+		}
+	}
+	return best, bestScore, nil
+}
+
+// descriptionSentences splits a description into sentences at ". " & line breaks (including "\r\n" escapes).
+func descriptionSentences(description string) []string {
+	description = strings.NewReplacer(`\r\n`, "\n", `\n`, "\n", ". ", ".\n").Replace(description)
+	sentences := []string{}
+	for _, s := range strings.Split(description, "\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+	return sentences
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A chatModel answers an MCP sampling request. rerankSearcher asks one to choose among candidate tools;
+// aoaiChatModel calls Azure OpenAI and scriptedModel is a local stand-in that needs no network.
+type chatModel interface {
+	CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error)
+}
+
+const rerankSystemPrompt = "You select the tools that best fulfill a user's prompt. Reply with the names of the candidate " +
+	"tools that fit the prompt, best first, one per line, and nothing else."
+
+// rerankSearcher has next select candidates & then asks a chat model to reorder them: the tools the model
+// names come first (in its order), followed by the remaining candidates in their original order. If the model
+// fails, the candidates are returned unchanged. Latency accumulates the time spent waiting on the model.
+type rerankSearcher struct {
+	next  searcher
+	model chatModel
+
+	mu      sync.Mutex
+	Calls   int
+	Latency time.Duration
+}
+
+func (s *rerankSearcher) Unwrap() searcher { return s.next }
+
+func (s *rerankSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	candidates := s.next.Search(prompt, vector, o)
+	if len(candidates) < 2 {
+		return candidates
+	}
+	start := time.Now()
+	result, err := s.model.CreateMessage(context.Background(), rerankRequest(prompt, candidates))
+	s.mu.Lock()
+	s.Calls++
+	s.Latency += time.Since(start)
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("Reranking failed; keeping the original order: %v", err)
+		return candidates
+	}
+	text, _ := result.Content.(mcp.TextContent)
+	return reorderCandidates(candidates, text.Text)
+}
+
+// rerankRequest builds the sampling request asking a model to rank candidates for prompt (see
+// contextWeights.Text). The user message has a "> <turn>" line per earlier turn of the conversation, if any,
+// then a "Prompt: " line with the latest message, followed by a "- <tool ID>: <description>" line per candidate.
+func rerankRequest(prompt string, candidates []QueryResult) *mcp.CreateMessageRequestParams {
+	sb := &strings.Builder{}
+	if i := strings.LastIndex(prompt, "\n"); i >= 0 {
+		fmt.Fprintf(sb, "Earlier in the conversation:\n")
+		for _, turn := range strings.Split(prompt[:i], "\n") {
+			fmt.Fprintf(sb, "> %s\n", turn)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(sb, "Prompt: %s\n\nCandidate tools:\n", latestMessage(prompt))
+	for _, c := range candidates {
+		description := ""
+		if t, ok := c.Entry.Metadata.(*mcp.Tool); ok && t.Description != nil {
+			description = strings.Join(strings.Fields(*t.Description), " ")
+		}
+		fmt.Fprintf(sb, "- %s: %s\n", c.Entry.ID, description)
+	}
+	systemPrompt, temperature := rerankSystemPrompt, 0.0
+	return &mcp.CreateMessageRequestParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.TextContent{Type: "text", Text: sb.String()}}},
+		SystemPrompt: &systemPrompt,
+		Temperature:  &temperature,
+		MaxTokens:    50 * len(candidates),
+	}
+}
+
+// reorderCandidates moves the candidates named in reply (one per line, optionally as a "- " list) to the
+// front; names that aren't candidates are ignored.
+func reorderCandidates(candidates []QueryResult, reply string) []QueryResult {
+	reordered := make([]QueryResult, 0, len(candidates))
+	for _, line := range strings.Split(reply, "\n") {
+		name := strings.Trim(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-")), "`")
+		i := slices.IndexFunc(candidates, func(c QueryResult) bool { return string(c.Entry.ID) == name })
+		if name == "" || i < 0 || slices.ContainsFunc(reordered, func(r QueryResult) bool { return r.Entry == candidates[i].Entry }) {
+			continue
+		}
+		reordered = append(reordered, candidates[i])
+	}
+	for _, c := range candidates {
+		if !slices.ContainsFunc(reordered, func(r QueryResult) bool { return r.Entry == c.Entry }) {
+			reordered = append(reordered, c)
+		}
+	}
+	return reordered
+}
+
+// scriptedModel is a deterministic stand-in for a chat model. It replies to a rerankRequest with the tool
+// scripted for the request's prompt (Replies maps prompts to tool IDs) or, for an unscripted prompt, with
+// the candidates in the order given, leaving them unchanged.
+type scriptedModel struct {
+	Replies map[string]string
+}
+
+func (m *scriptedModel) CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	if len(params.Messages) == 0 {
+		return nil, fmt.Errorf("scripted model: no messages")
+	}
+	text, ok := params.Messages[len(params.Messages)-1].Content.(mcp.TextContent)
+	if !ok {
+		return nil, fmt.Errorf("scripted model: the last message isn't text")
+	}
+	reply := []string{}
+	for _, line := range strings.Split(text.Text, "\n") {
+		if prompt, ok := strings.CutPrefix(line, "Prompt: "); ok {
+			if scripted, ok := m.Replies[prompt]; ok {
+				reply = append(reply, scripted)
+			}
+		}
+		if candidate, ok := strings.CutPrefix(line, "- "); ok {
+			name, _, _ := strings.Cut(candidate, ":")
+			reply = append(reply, name)
+		}
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.TextContent{Type: "text", Text: strings.Join(reply, "\n")}},
+		Model:           "scripted",
+	}, nil
+}
+
+// aoaiChatModel calls an Azure OpenAI chat completions deployment; AOAI_CHAT_ENDPOINT is its full URL
+// (including api-version) and AOAI_CHAT_API_KEY its key.
+type aoaiChatModel struct {
+	uri, apiKey string
+}
+
+func newAOAIChatModel() *aoaiChatModel {
+	m := &aoaiChatModel{uri: os.Getenv("AOAI_CHAT_ENDPOINT"), apiKey: os.Getenv("AOAI_CHAT_API_KEY")}
+	if m.uri == "" || m.apiKey == "" {
+		log.Fatalf("AOAI_CHAT_ENDPOINT and AOAI_CHAT_API_KEY environment variables are required for the aoai reranker")
+	}
+	return m
+}
+
+func (m *aoaiChatModel) CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	// Docs: https://learn.microsoft.com/en-us/azure/ai-services/openai/reference#chat-completions
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	requestBody := struct {
+		Messages    []message `json:"messages"`
+		MaxTokens   int       `json:"max_tokens"`
+		Temperature *float64  `json:"temperature,omitempty"`
+		Stop        []string  `json:"stop,omitempty"`
+	}{MaxTokens: params.MaxTokens, Temperature: params.Temperature, Stop: params.StopSequences}
+	if params.SystemPrompt != nil {
+		requestBody.Messages = append(requestBody.Messages, message{Role: "system", Content: *params.SystemPrompt})
+	}
+	for _, sm := range params.Messages {
+		text, ok := sm.Content.(mcp.TextContent)
+		if !ok {
+			return nil, fmt.Errorf("aoai chat model: only text content is supported")
+		}
+		requestBody.Messages = append(requestBody.Messages, message{Role: string(sm.Role), Content: text.Text})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.uri, bytes.NewReader(must(json.Marshal(requestBody))))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("api-key", m.apiKey)
+	req.Header.Add("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	chatResponse := struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      message `json:"message"`
+			FinishReason string  `json:"finish_reason"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, err
+	}
+	if chatResponse.Error != nil {
+		return nil, fmt.Errorf("aoai chat model: %s", chatResponse.Error.Message)
+	}
+	if len(chatResponse.Choices) == 0 {
+		return nil, fmt.Errorf("aoai chat model: no choices returned (status %s)", response.Status)
+	}
+	choice := chatResponse.Choices[0]
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.TextContent{Type: "text", Text: choice.Message.Content}},
+		Model:           chatResponse.Model,
+		StopReason:      &choice.FinishReason,
+	}, nil
+}
+
+// parseChatModel returns the model selected by spec: "aoai" or "scripted" optionally followed by
+// ":<file>" naming a JSON file of scripted replies ({"prompt": "tool ID", ...}).
+func parseChatModel(spec string) (chatModel, error) {
+	kind, filename, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "aoai":
+		return newAOAIChatModel(), nil
+	case "scripted":
+		m := &scriptedModel{Replies: map[string]string{}}
+		if filename != "" {
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &m.Replies); err != nil {
+				return nil, fmt.Errorf("failed to parse scripted replies from %s: %w", filename, err)
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown reranking model %q; expected aoai or scripted[:file]", kind)
+}
+
+// reportReranking evaluates the prompts with & without reranking, reporting the accuracy of each and
+// the latency reranking adds.
+func reportReranking(s *rerankSearcher, testCases []testCase, o QueryOptions) {
+	cases := embedPromptCases(testCases)
+	start := time.Now()
+	before := evaluateCases(s.next, cases, o)
+	searchTime := time.Since(start)
+	s.Calls, s.Latency = 0, 0
+	after := evaluateCases(s, cases, o)
+	perCall := time.Duration(0)
+	if s.Calls > 0 {
+		perCall = s.Latency / time.Duration(s.Calls)
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Reranking")
+		fmt.Println()
+		fmt.Println("| Stage | Accuracy (top 1) | Recall (top 3) | MRR | Pass Rate |")
+		fmt.Println("|-------|------------------|----------------|-----|-----------|")
+		fmt.Printf("| Before reranking | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("| After reranking | %.1f%% | %.1f%% | %.4f | %.1f%% |\n", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		fmt.Println()
+		fmt.Printf("**Search Time:** %v  \n", searchTime)
+		fmt.Printf("**Reranking Time:** %v (%d model calls, %v per call)  \n", s.Latency, s.Calls, perCall)
+	} else {
+		fmt.Printf("\nReranking:\n")
+		fmt.Printf("   %-18s %9s %9s %8s %9s\n", "Stage", "Top1", "Top3", "MRR", "Passed")
+		fmt.Printf("   %-18s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "Before reranking", before.Accuracy(), before.Recall3(), before.MRR(), before.PassRate())
+		fmt.Printf("   %-18s %8.1f%% %8.1f%% %8.4f %8.1f%%\n", "After reranking", after.Accuracy(), after.Recall3(), after.MRR(), after.PassRate())
+		fmt.Printf("\nSearch time=%v, Reranking time=%v (%d model calls, %v per call)\n", searchTime, s.Latency, s.Calls, perCall)
+	}
+}
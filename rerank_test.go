@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// newTestTool returns a tool named name with description.
+func newTestTool(name, description string) mcp.Tool {
+	return mcp.Tool{BaseMetadata: mcp.BaseMetadata{Name: name}, Description: &description,
+		InputSchema: []byte(`{"type": "object"}`)}
+}
+
+// newTestDB returns a cosine DB of tools embedded (by their descriptions) with hashEmbeddings.
+func newTestDB(tools ...mcp.Tool) *VectorDB {
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	for i := range tools {
+		db.Upsert(&Entry{ID: entryID(&tools[i]), Metadata: &tools[i], Vector: hashEmbeddings(*tools[i].Description)})
+	}
+	return db
+}
+
+// replyModel replies to every request with Reply or fails with Err.
+type replyModel struct {
+	Reply string
+	Err   error
+}
+
+func (m *replyModel) CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &mcp.CreateMessageResult{SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant,
+		Content: mcp.TextContent{Type: "text", Text: m.Reply}}}, nil
+}
+
+func resultIDs(results []QueryResult) []ID {
+	ids := []ID{}
+	for _, r := range results {
+		ids = append(ids, r.Entry.ID)
+	}
+	return ids
+}
+
+func TestRerankSearcher(t *testing.T) {
+	db := newTestDB(
+		newTestTool("storage-account-list", "List the storage accounts in a subscription"),
+		newTestTool("storage-blob-list", "List the blobs in a storage container"),
+		newTestTool("storage-container-list", "List the containers in a storage account"),
+		newTestTool("redis-cache-list", "List the Redis caches in a subscription"),
+	)
+	const prompt = "List the storage accounts"
+	o := QueryOptions{TopK: 3}
+	original := resultIDs(vectorSearcher{db: db}.Search(prompt, hashEmbeddings(prompt), o))
+	if len(original) != 3 || original[0] != "storage-account-list" {
+		t.Fatalf("unexpected vector ranking %v", original)
+	}
+
+	tests := []struct {
+		name  string
+		model chatModel
+		want  []ID
+	}{
+		{"scripted reply moves the tool first", &scriptedModel{Replies: map[string]string{prompt: string(original[2])}},
+			[]ID{original[2], original[0], original[1]}},
+		{"unscripted prompt keeps the order", &scriptedModel{}, original},
+		{"listed names reorder", &replyModel{Reply: "- `" + string(original[1]) + "`\n- " + string(original[2])},
+			[]ID{original[1], original[2], original[0]}},
+		{"non-candidate names are ignored", &replyModel{Reply: "redis-cache-list\n" + string(original[1])},
+			[]ID{original[1], original[0], original[2]}},
+		{"malformed reply keeps the order", &replyModel{Reply: "I can't decide which tool fits."}, original},
+		{"empty reply keeps the order", &replyModel{}, original},
+		{"model error keeps the order", &replyModel{Err: errors.New("service unavailable")}, original},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &rerankSearcher{next: vectorSearcher{db: db}, model: tt.model}
+			if got := resultIDs(s.Search(prompt, hashEmbeddings(prompt), o)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if s.Calls != 1 {
+				t.Errorf("got %d model calls, want 1", s.Calls)
+			}
+		})
+	}
+}
+
+func TestRerankSearcherSkipsSingleCandidate(t *testing.T) {
+	db := newTestDB(newTestTool("storage-account-list", "List the storage accounts in a subscription"))
+	s := &rerankSearcher{next: vectorSearcher{db: db}, model: &replyModel{Err: errors.New("must not be called")}}
+	if got := resultIDs(s.Search("storage", hashEmbeddings("storage"), QueryOptions{TopK: 3})); len(got) != 1 || s.Calls != 0 {
+		t.Errorf("got %v after %d model calls, want the only candidate & no calls", got, s.Calls)
+	}
+}
+
+func TestRerankRequestConversation(t *testing.T) {
+	candidates := []QueryResult{{Entry: &Entry{ID: "appconfig-kv-delete", Metadata: &mcp.Tool{}}}}
+	text := rerankRequest(conversationContext.Text([]conversationTurn{{Role: mcp.RoleUser, Content: "Show the setting\n'ApiUrl'"}},
+		"Now delete it"), candidates).Messages[0].Content.(mcp.TextContent).Text
+	want := "Earlier in the conversation:\n> Show the setting 'ApiUrl'\n\nPrompt: Now delete it\n\nCandidate tools:\n- appconfig-kv-delete: \n"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// Short prompts like "Show me my subscriptions" embed poorly against long descriptions. Query rewriters
+// transform a query's text before it's embedded (see embedQuery): synonyms expands Azure product names &
+// abbreviations, stopwords strips words carrying no signal & model has a chat model rephrase the query.
+// Only the embedded text of the query itself is rewritten; a conversation's earlier turns, lexical search &
+// reranking still see the original text.
+
+// A queryRewriter returns the text to embed for a query.
+type queryRewriter struct {
+	Name    string
+	Rewrite func(query string) string
+}
+
+// queryRewriters rewrite (in order) every query embedded by embedQuery; see selectionFlags.setup.
+var queryRewriters []queryRewriter
+
+// embedQuery embeds a query (as opposed to a tool) after rewriting it with queryRewriters.
+func embedQuery(query string) ([]float32, error) {
+	return createEmbeddings(rewriteQuery(queryRewriters, query))
+}
+
+func rewriteQuery(rewriters []queryRewriter, query string) string {
+	for _, r := range rewriters {
+		query = r.Rewrite(query)
+	}
+	return query
+}
+
+// defaultSynonyms expands Azure product names & abbreviations into the words the tools' descriptions use.
+var defaultSynonyms = map[string]string{
+	"adx":              "Kusto",
+	"data explorer":    "Kusto",
+	"kql":              "Kusto query",
+	"appconfig":        "App Configuration",
+	"app config":       "App Configuration",
+	"akv":              "Key Vault",
+	"keyvault":         "Key Vault",
+	"cosmos":           "Cosmos DB",
+	"cosmosdb":         "Cosmos DB",
+	"pg":               "PostgreSQL",
+	"postgres":         "PostgreSQL",
+	"psql":             "PostgreSQL",
+	"sb":               "Service Bus",
+	"servicebus":       "Service Bus",
+	"amr":              "Redis Cluster",
+	"rg":               "resource group",
+	"rgs":              "resource groups",
+	"sub":              "subscription",
+	"subs":             "subscriptions",
+	"sa":               "storage account",
+	"db":               "database",
+	"dbs":              "databases",
+	"la workspace":     "Log Analytics workspace",
+	"ai search":        "Azure AI Search service",
+	"cognitive search": "Azure AI Search service",
+	"search service":   "Azure AI Search",
+	"rbac":             "role assignment",
+	"iam":              "role assignment",
+	"azd":              "Azure Developer CLI",
+	"health model":     "Azure Monitor health models entity health",
+	"blob storage":     "Storage blob",
+}
+
+// synonymRewriter inserts the expansion of each term of synonyms found (as whole words, ignoring case) in a
+// query after the term's first occurrence, unless the query already contains the expansion. Longer terms are
+// expanded first, so "app config" wins over a term it contains.
+func synonymRewriter(synonyms map[string]string) func(string) string {
+	type synonym struct {
+		term      *regexp.Regexp
+		expansion string
+	}
+	terms := slices.SortedFunc(maps.Keys(synonyms), func(a, b string) int { return cmp.Or(len(b)-len(a), strings.Compare(a, b)) })
+	expansions := []synonym{}
+	for _, term := range terms {
+		expansions = append(expansions, synonym{regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(term) + `\b`), synonyms[term]})
+	}
+	return func(query string) string {
+		for _, s := range expansions {
+			if strings.Contains(strings.ToLower(query), strings.ToLower(s.expansion)) {
+				continue
+			}
+			if loc := s.term.FindStringIndex(query); loc != nil {
+				query = query[:loc[1]] + " (" + s.expansion + ")" + query[loc[1]:]
+			}
+		}
+		return query
+	}
+}
+
+// stripStopwords drops the words of query that are stopwords (see tokenize), unless they all are.
+func stripStopwords(query string) string {
+	words := slices.DeleteFunc(strings.Fields(query), func(w string) bool {
+		return stopwords[strings.TrimFunc(strings.ToLower(w), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })]
+	})
+	if len(words) == 0 {
+		return query
+	}
+	return strings.Join(words, " ")
+}
+
+const rewriteSystemPrompt = "You rewrite a user's request to an Azure agent as a search query for the tool that fulfills it. " +
+	"Name the Azure service, the resource & the operation in the words a tool's description would use, expand " +
+	"abbreviations & reply with the rewritten query only, on one line."
+
+// rewriteTimeout bounds each request to a modelRewriter's model, so a stalled model delays a query only so long.
+var rewriteTimeout = 10 * time.Second
+
+// modelRewriter has model rewrite each query (see rewriteRequest), remembering the model's replies since the
+// evaluation embeds each prompt several times. If the model fails (or takes longer than rewriteTimeout), the query
+// is unchanged & asked about again next time; if it replies with nothing, the query is unchanged.
+func modelRewriter(model chatModel) func(string) string {
+	mu, rewrites := sync.Mutex{}, map[string]string{}
+	return func(query string) string {
+		mu.Lock()
+		rewrite, ok := rewrites[query]
+		mu.Unlock()
+		if ok {
+			return rewrite
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), rewriteTimeout)
+		defer cancel()
+		result, err := model.CreateMessage(ctx, rewriteRequest(query))
+		if err != nil {
+			return query
+		}
+		rewrite = query
+		if text, ok := result.Content.(mcp.TextContent); ok && strings.TrimSpace(text.Text) != "" {
+			rewrite = strings.TrimSpace(text.Text)
+		}
+		mu.Lock()
+		rewrites[query] = rewrite
+		mu.Unlock()
+		return rewrite
+	}
+}
+
+// rewriteRequest builds the sampling request asking a model to rewrite query. The user message is a "Prompt: "
+// line, so a scriptedModel replies with the rewrite scripted for the query (& nothing for an unscripted one).
+func rewriteRequest(query string) *mcp.CreateMessageRequestParams {
+	systemPrompt, temperature := rewriteSystemPrompt, 0.0
+	return &mcp.CreateMessageRequestParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.TextContent{Type: "text", Text: "Prompt: " + query}}},
+		SystemPrompt: &systemPrompt,
+		Temperature:  &temperature,
+		MaxTokens:    100,
+	}
+}
+
+// parseRewriters parses query rewriters joined by "+", each "synonyms[:file]" (the file is a JSON object of
+// terms & expansions adding to & overriding defaultSynonyms), "stopwords" or "model:aoai" or
+// "model:scripted[:file]" (see parseChatModel; the file maps prompts to their rewrites); "" is none.
+func parseRewriters(spec string) ([]queryRewriter, error) {
+	rewriters := []queryRewriter{}
+	for _, r := range strings.Split(spec, "+") {
+		kind, arg, _ := strings.Cut(strings.TrimSpace(r), ":")
+		switch kind {
+		case "":
+			continue
+		case "synonyms":
+			synonyms := maps.Clone(defaultSynonyms)
+			if arg != "" {
+				data, err := os.ReadFile(arg)
+				if err != nil {
+					return nil, err
+				}
+				added := map[string]string{}
+				if err := json.Unmarshal(data, &added); err != nil {
+					return nil, fmt.Errorf("failed to parse synonyms from %s: %w", arg, err)
+				}
+				maps.Copy(synonyms, added)
+			}
+			rewriters = append(rewriters, queryRewriter{"synonyms", synonymRewriter(synonyms)})
+		case "stopwords":
+			rewriters = append(rewriters, queryRewriter{"stopwords", stripStopwords})
+		case "model":
+			model, err := parseChatModel(arg)
+			if err != nil {
+				return nil, err
+			}
+			rewriters = append(rewriters, queryRewriter{"model", modelRewriter(model)})
+		default:
+			return nil, fmt.Errorf("unknown query rewriter %q; expected synonyms[:file], stopwords or model:aoai|scripted[:file] joined by +", kind)
+		}
+	}
+	return rewriters, nil
+}
+
+// reportRewrites A/B tests the rewriters: it evaluates the prompts embedded as written, rewritten by each
+// rewriter alone & (if there are several) rewritten by all of them, reporting how many prompts each rewrote.
+func reportRewrites(s searcher, rewriters []queryRewriter, testCases []testCase, o QueryOptions) {
+	start := time.Now()
+	type row struct {
+		name      string
+		rewriters []queryRewriter
+		rewritten int
+		m         evalMetrics
+	}
+	rows := []*row{{name: "none"}}
+	for _, r := range rewriters {
+		rows = append(rows, &row{name: r.Name, rewriters: []queryRewriter{r}})
+	}
+	if len(rewriters) > 1 {
+		names := []string{}
+		for _, r := range rewriters {
+			names = append(names, r.Name)
+		}
+		rows = append(rows, &row{name: strings.Join(names, "+"), rewriters: rewriters})
+	}
+	example := ""
+	for _, r := range rows {
+		cases := []promptCase{}
+		for _, c := range testCases {
+			query := rewriteQuery(r.rewriters, c.Prompt)
+			if query != c.Prompt {
+				r.rewritten++
+				if example == "" && len(r.rewriters) == len(rewriters) {
+					example = fmt.Sprintf("%q -> %q", c.Prompt, query)
+				}
+			}
+			cases = append(cases, promptCase{testCase: c, Vector: mustEmbed(conversationContext.Vector(c.Conversation, mustEmbed(createEmbeddings(query))))})
+		}
+		r.m = evaluateCases(s, cases, o)
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Query Rewriting")
+		fmt.Println()
+		if example != "" {
+			fmt.Printf("**Example:** %s  \n", example)
+			fmt.Println()
+		}
+		fmt.Println("| Rewriters | Prompts Rewritten | Accuracy (top 1) | Recall@3 | MRR | Pass Rate |")
+		fmt.Println("|-----------|-------------------|------------------|----------|-----|-----------|")
+		for _, r := range rows {
+			fmt.Printf("| %s | %d/%d | %.1f%% | %.1f%% | %.3f | %.1f%% |\n", r.name, r.rewritten, len(testCases), r.m.Accuracy(),
+				r.m.Recall3(), r.m.MRR(), r.m.PassRate())
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nQuery rewriting:\n")
+		if example != "" {
+			fmt.Printf("   Example: %s\n", example)
+		}
+		fmt.Printf("   %-28s %10s %8s %8s %6s %8s\n", "Rewriters", "Rewritten", "Top1", "Top3", "MRR", "Passed")
+		for _, r := range rows {
+			fmt.Printf("   %-28s %10s %7.1f%% %7.1f%% %6.3f %7.1f%%\n", r.name, fmt.Sprintf("%d/%d", r.rewritten, len(testCases)),
+				r.m.Accuracy(), r.m.Recall3(), r.m.MRR(), r.m.PassRate())
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
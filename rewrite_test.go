@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// flakyModel fails its first Failures requests & then replies with Reply, counting the requests.
+type flakyModel struct {
+	mu       sync.Mutex
+	Failures int
+	Reply    string
+	Requests int
+}
+
+func (m *flakyModel) CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Requests++; m.Requests <= m.Failures {
+		return nil, errors.New("the model is unavailable")
+	}
+	return &mcp.CreateMessageResult{SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant,
+		Content: mcp.TextContent{Type: "text", Text: m.Reply}}}, nil
+}
+
+// stalledModel never replies; it fails when the request's context is done.
+type stalledModel struct{}
+
+func (stalledModel) CreateMessage(ctx context.Context, params *mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestModelRewriter(t *testing.T) {
+	const query, rewritten = "Show my subs", "List the subscriptions"
+	t.Run("remembers replies", func(t *testing.T) {
+		m := &flakyModel{Reply: " " + rewritten + "\n"}
+		rewrite := modelRewriter(m)
+		for range 3 {
+			if got := rewrite(query); got != rewritten {
+				t.Fatalf("got %q, want %q", got, rewritten)
+			}
+		}
+		if m.Requests != 1 {
+			t.Errorf("the model was asked %d times, want once", m.Requests)
+		}
+	})
+	t.Run("retries failures", func(t *testing.T) {
+		m := &flakyModel{Failures: 1, Reply: rewritten}
+		rewrite := modelRewriter(m)
+		if got := rewrite(query); got != query {
+			t.Errorf("got %q after the model failed, want the query unchanged", got)
+		}
+		if got := rewrite(query); got != rewritten || m.Requests != 2 {
+			t.Errorf("got %q after %d requests, want %q after 2", got, m.Requests, rewritten)
+		}
+	})
+	t.Run("an empty reply", func(t *testing.T) {
+		m := &flakyModel{Reply: " "}
+		rewrite := modelRewriter(m)
+		if got := rewrite(query); got != query || rewrite(query) != query || m.Requests != 1 {
+			t.Errorf("got %q after %d requests, want the query unchanged after 1", got, m.Requests)
+		}
+	})
+	t.Run("times out", func(t *testing.T) {
+		previous := rewriteTimeout
+		rewriteTimeout = 10 * time.Millisecond
+		defer func() { rewriteTimeout = previous }()
+		start := time.Now()
+		if got := modelRewriter(stalledModel{})(query); got != query {
+			t.Errorf("got %q, want the query unchanged", got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("the rewrite took %v", elapsed)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// Selecting the wrong read-only tool wastes a call; selecting the wrong destructive tool can lose data. A
+// safetySearcher applies policies, based on the tools' annotation hints & the prompt's intent, that keep
+// destructive tools from being selected unless the prompt asks for one.
+
+// readOnlyVerbs & additiveVerbs classify the tools without annotations (like all those in list-tools.json) by
+// their verb (see toolVerb); the other tools without annotations have the MCP spec's default hints.
+var (
+	readOnlyVerbs = []string{"list", "get", "show", "details", "describe", "schema", "config", "param", "gethealth",
+		"definitions", "sample", "query"}
+	additiveVerbs = []string{"create"}
+)
+
+// destructiveTool returns true if t may destroy or overwrite data: its readOnlyHint is false & its
+// destructiveHint true or, if it has no annotations, its verb neither reads nor only adds.
+func destructiveTool(t *mcp.Tool) bool {
+	if t.Annotations == nil {
+		return !slices.Contains(readOnlyVerbs, toolVerb(t)) && !slices.Contains(additiveVerbs, toolVerb(t))
+	}
+	return !toolHint(t, "readOnly") && toolHint(t, "destructive")
+}
+
+// readOnlyTool returns true if t's readOnlyHint is true or, if it has no annotations, its verb only reads.
+func readOnlyTool(t *mcp.Tool) bool {
+	if t.Annotations == nil {
+		return slices.Contains(readOnlyVerbs, toolVerb(t))
+	}
+	return toolHint(t, "readOnly")
+}
+
+func destructiveEntry(e *Entry) bool {
+	t, ok := e.Metadata.(*mcp.Tool)
+	return ok && destructiveTool(t)
+}
+
+// destructiveIntent returns true if the verbs classifier finds in prompt include one that's neither read-only
+// nor additive: the prompt asks to delete, set, lock, ...
+func destructiveIntent(classifier intentClassifier, prompt string) bool {
+	return slices.ContainsFunc(classifier.Classify(prompt), func(v string) bool {
+		return !slices.Contains(readOnlyVerbs, v) && !slices.Contains(additiveVerbs, v)
+	})
+}
+
+// safetySearcher has next rank safetySlack times o.TopK candidates & then applies the enabled policies. Exclude &
+// Tie only apply if the prompt's intent isn't destructive; MinMargin always applies.
+type safetySearcher struct {
+	db         *VectorDB
+	next       searcher
+	classifier intentClassifier
+	Exclude    bool    // Drop destructive tools
+	Tie        float32 // If > 0, a destructive tool scoring less than Tie more than a non-destructive tool ranks after it
+	MinMargin  float32 // If > 0, a destructive tool ranks #1 only if it leads the best non-destructive tool by at least this
+}
+
+func (s *safetySearcher) Unwrap() searcher { return s.next }
+
+// safetySlack bounds the candidates a safetySearcher asks for, so dropped & demoted tools are replaced by the next
+// best without having costly stages like reranking rank the whole catalog. If more than o.TopK of the candidates
+// are excluded, fewer than o.TopK results are returned.
+const safetySlack = 2
+
+func (s *safetySearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	topK := o.TopK
+	o.TopK = min(safetySlack*topK, getAllTools(s.db))
+	results := s.next.Search(prompt, vector, o)
+	destructive := func(qr QueryResult) bool { return destructiveEntry(qr.Entry) }
+	if !destructiveIntent(s.classifier, latestMessage(prompt)) {
+		if s.Exclude {
+			results = slices.DeleteFunc(results, destructive)
+		}
+		if s.Tie > 0 { // Sink each destructive tool (lowest first) below the non-destructive tools it ties with
+			for i := len(results) - 2; i >= 0; i-- {
+				for j := i; j+1 < len(results) && destructive(results[j]) && !destructive(results[j+1]) &&
+					results[j].Score-results[j+1].Score < s.Tie; j++ {
+					results[j], results[j+1] = results[j+1], results[j]
+				}
+			}
+		}
+	}
+	if s.MinMargin > 0 && len(results) > 1 && destructive(results[0]) {
+		if i := slices.IndexFunc(results, func(qr QueryResult) bool { return !destructive(qr) }); i > 0 &&
+			results[0].Score-results[i].Score < s.MinMargin {
+			safe := results[i]
+			results = slices.Insert(slices.Delete(results, i, i+1), 0, safe)
+		}
+	}
+	return results[:min(topK, len(results))]
+}
+
+// parseSafetyOptions parses "none" or policies joined by "+" (exclude, demote & margin) optionally followed by
+// ":name=value,..." where the names are tie (demote's; default 0.01) & margin (margin's; default 0.05). "none"
+// applies no policy but still reports the safety metrics.
+func parseSafetyOptions(spec string) (*safetySearcher, error) {
+	policies, params, _ := strings.Cut(spec, ":")
+	s := &safetySearcher{classifier: &ruleClassifier{Rules: defaultIntentRules}}
+	tie, margin := float32(0.01), float32(0.05)
+	for _, p := range strings.Split(params, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid safety %s %q", name, value)
+		}
+		switch name {
+		case "tie":
+			tie = float32(f)
+		case "margin":
+			margin = float32(f)
+		default:
+			return nil, fmt.Errorf("unknown safety parameter %q; expected tie or margin", name)
+		}
+	}
+	for _, policy := range strings.Split(policies, "+") {
+		switch policy {
+		case "none":
+		case "exclude":
+			s.Exclude = true
+		case "demote":
+			s.Tie = tie
+		case "margin":
+			s.MinMargin = margin
+		default:
+			return nil, fmt.Errorf("unknown safety policy %q; expected none or exclude, demote & margin joined by +", policy)
+		}
+	}
+	return s, nil
+}
+
+// safetyMetrics counts how often a searcher selected destructive tools it shouldn't have & how often it still
+// selected them when it should have.
+type safetyMetrics struct {
+	ReadOnlyPrompts    int // Positive cases whose acceptable tools are all read-only
+	UnsafeWrong        int // Read-only prompts with a destructive (so unacceptable) tool ranked #1
+	DestructivePrompts int // Positive cases with a destructive acceptable tool
+	DestructiveTop1    int // Destructive prompts with an acceptable tool ranked #1
+	Top1, Positives    int
+}
+
+func evaluateSafety(s searcher, db *VectorDB, cases []promptCase, o QueryOptions) safetyMetrics {
+	o.TopK = cmp.Or(o.TopK, 10)
+	m := safetyMetrics{}
+	for _, c := range cases {
+		accepted := acceptedEntries(db, &c.testCase)
+		if c.IsNegative() || len(accepted) == 0 {
+			continue
+		}
+		results := s.Search(c.Query(), c.Vector, o)
+		top1 := len(results) > 0 && c.Accepts(results[0].Entry)
+		m.Positives++
+		if top1 {
+			m.Top1++
+		}
+		if !slices.ContainsFunc(accepted, func(e *Entry) bool { t, ok := e.Metadata.(*mcp.Tool); return !ok || !readOnlyTool(t) }) {
+			m.ReadOnlyPrompts++
+			if len(results) > 0 && destructiveEntry(results[0].Entry) {
+				m.UnsafeWrong++
+			}
+		}
+		if slices.ContainsFunc(accepted, destructiveEntry) {
+			m.DestructivePrompts++
+			if top1 {
+				m.DestructiveTop1++
+			}
+		}
+	}
+	return m
+}
+
+// reportSafety reports the safety metrics & accuracy without & with s's policies.
+func reportSafety(s *safetySearcher, db *VectorDB, testCases []testCase, o QueryOptions) {
+	start := time.Now()
+	cases := embedPromptCases(testCases)
+	before, after := evaluateSafety(s.next, db, cases, o), evaluateSafety(s, db, cases, o)
+	if before.ReadOnlyPrompts == 0 {
+		log.Printf("No prompt expects only read-only tools, so no selection can be unsafe")
+	}
+	policies := []string{}
+	if s.Exclude {
+		policies = append(policies, "exclude")
+	}
+	if s.Tie > 0 {
+		policies = append(policies, fmt.Sprintf("demote (tie %g)", s.Tie))
+	}
+	if s.MinMargin > 0 {
+		policies = append(policies, fmt.Sprintf("margin %g", s.MinMargin))
+	}
+	if len(policies) == 0 {
+		policies = append(policies, "none")
+	}
+	rows := []struct {
+		name string
+		m    safetyMetrics
+	}{{"Without policies", before}, {"With policies", after}}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Safety")
+		fmt.Println()
+		fmt.Printf("**Policies:** %s  \n", strings.Join(policies, ", "))
+		fmt.Println()
+		fmt.Println("| Stage | Accuracy (top 1) | Unsafe Wrong Selections | Destructive Prompts Accuracy |")
+		fmt.Println("|-------|------------------|-------------------------|------------------------------|")
+		for _, r := range rows {
+			fmt.Printf("| %s | %.1f%% | %d/%d (%.1f%%) | %d/%d (%.1f%%) |\n", r.name, percent(r.m.Top1, r.m.Positives),
+				r.m.UnsafeWrong, r.m.ReadOnlyPrompts, percent(r.m.UnsafeWrong, r.m.ReadOnlyPrompts),
+				r.m.DestructiveTop1, r.m.DestructivePrompts, percent(r.m.DestructiveTop1, r.m.DestructivePrompts))
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nSafety: policies=%s\n", strings.Join(policies, ", "))
+		fmt.Printf("   %-18s %9s %16s %16s\n", "Stage", "Top1", "Unsafe wrong", "Destructive")
+		for _, r := range rows {
+			fmt.Printf("   %-18s %8.1f%% %6d/%-3d %4.1f%% %6d/%-3d %4.1f%%\n", r.name, percent(r.m.Top1, r.m.Positives),
+				r.m.UnsafeWrong, r.m.ReadOnlyPrompts, percent(r.m.UnsafeWrong, r.m.ReadOnlyPrompts),
+				r.m.DestructiveTop1, r.m.DestructivePrompts, percent(r.m.DestructiveTop1, r.m.DestructivePrompts))
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
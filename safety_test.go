@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+func TestDestructiveTool(t *testing.T) {
+	yes, no := true, false
+	annotated := func(name string, readOnly, destructive *bool) mcp.Tool {
+		t := newTestTool(name, "")
+		t.Annotations = &mcp.ToolAnnotations{ReadOnlyHint: readOnly, DestructiveHint: destructive}
+		return t
+	}
+	tests := []struct {
+		tool                  mcp.Tool
+		destructive, readOnly bool
+	}{
+		{newTestTool("azmcp-storage-account-list", ""), false, true},
+		{newTestTool("azmcp-storage-account-create", ""), false, false}, // Additive
+		{newTestTool("azmcp-storage-account-delete", ""), true, false},
+		{newTestTool("azmcp-appconfig-kv-lock", ""), true, false},
+		// Annotations override the verb; the hints default to the MCP spec's: not read-only & destructive
+		{annotated("azmcp-storage-account-delete", &yes, nil), false, true},
+		{annotated("azmcp-storage-account-list", nil, nil), true, false},
+		{annotated("azmcp-storage-account-list", &no, &no), false, false},
+		{annotated("azmcp-storage-account-list", &yes, &yes), false, true}, // readOnlyHint wins
+	}
+	for _, tt := range tests {
+		if got := destructiveTool(&tt.tool); got != tt.destructive {
+			t.Errorf("%s with %+v: got destructive %t, want %t", tt.tool.Name, tt.tool.Annotations, got, tt.destructive)
+		}
+		if got := readOnlyTool(&tt.tool); got != tt.readOnly {
+			t.Errorf("%s with %+v: got read-only %t, want %t", tt.tool.Name, tt.tool.Annotations, got, tt.readOnly)
+		}
+	}
+}
+
+func TestSafetySearcher(t *testing.T) {
+	tools := []mcp.Tool{
+		newTestTool("azmcp-storage-account-delete", ""),
+		newTestTool("azmcp-storage-account-get", ""),
+		newTestTool("azmcp-storage-account-list", ""),
+		newTestTool("azmcp-redis-cache-delete", ""),
+	}
+	db := NewVectorDB(CosineSimilarity{}, nil)
+	for i, score := range []float64{1, 0.995, 0.9, 0.8} { // The cosine similarity of each tool to (1, 0)
+		db.Upsert(&Entry{ID: entryID(&tools[i]), Metadata: &tools[i], Vector: []float32{float32(score), float32(math.Sqrt(1 - score*score))}})
+	}
+	const (
+		del   = "azmcp-storage-account-delete"
+		get   = "azmcp-storage-account-get"
+		list  = "azmcp-storage-account-list"
+		show  = "Show the storage account"
+		erase = "Delete the storage account"
+	)
+	tests := []struct {
+		name, spec, prompt string
+		topK               int
+		want               []ID
+	}{
+		{"none", "none", show, 3, []ID{del, get, list}},
+		// Both destructive tools are dropped so fewer than TopK are left
+		{"exclude", "exclude", show, 3, []ID{get, list}},
+		{"exclude with TopK 1", "exclude", show, 1, []ID{get}},
+		{"exclude for a destructive intent", "exclude", erase, 3, []ID{del, get, list}},
+		{"demote a tie", "demote:tie=0.01", show, 3, []ID{get, del, list}},
+		{"demote no tie", "demote:tie=0.001", show, 3, []ID{del, get, list}},
+		{"demote for a destructive intent", "demote:tie=0.01", erase, 3, []ID{del, get, list}},
+		{"margin too small", "margin:margin=0.05", show, 3, []ID{get, del, list}},
+		{"margin big enough", "margin:margin=0.001", show, 3, []ID{del, get, list}},
+		{"margin for a destructive intent", "margin:margin=0.05", erase, 3, []ID{get, del, list}}, // Margin always applies
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := must(parseSafetyOptions(tt.spec))
+			s.db, s.next = db, vectorSearcher{db: db}
+			if got := resultIDs(s.Search(tt.prompt, []float32{1, 0}, QueryOptions{TopK: tt.topK})); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSafetyOptions(t *testing.T) {
+	tests := []struct {
+		spec string
+		want *safetySearcher // nil if the spec is invalid
+	}{
+		{"none", &safetySearcher{}},
+		{"exclude", &safetySearcher{Exclude: true}},
+		{"demote+margin", &safetySearcher{Tie: 0.01, MinMargin: 0.05}},
+		{"exclude+demote:tie=0.02,margin=0.1", &safetySearcher{Exclude: true, Tie: 0.02}},
+		{"forbid", nil},
+		{"demote:tie=-1", nil},
+		{"demote:slack=1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSafetyOptions(tt.spec)
+			switch {
+			case tt.want == nil:
+				if err == nil {
+					t.Errorf("got %+v, want an error", s)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case s.Exclude != tt.want.Exclude || s.Tie != tt.want.Tie || s.MinMargin != tt.want.MinMargin || s.classifier == nil:
+				t.Errorf("got %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
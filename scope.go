@@ -0,0 +1,226 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// Every query returns the top K tools no matter how irrelevant the prompt. Rejecting results scoring below a
+// threshold (QueryOptions.MinimumScore) lets selection say "no tool fits". scopeSamples records the best result
+// for in-scope (positive) & out-of-scope (negative) cases so the threshold maximizing F1 can be found.
+
+// loadOutOfScopeFromJSON loads off-topic prompts from a JSON array of strings; each becomes a negative case
+// (passing only if no tool is returned) tagged "out-of-scope".
+func loadOutOfScopeFromJSON(filename string) []testCase {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read out-of-scope prompts file %s: %v", filename, err)
+	}
+	prompts := []string{}
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		log.Fatalf("Failed to parse out-of-scope prompts JSON from %s: %v", filename, err)
+	}
+	cases := make([]testCase, len(prompts))
+	for i, p := range prompts {
+		cases[i] = testCase{ID: fmt.Sprintf("out-of-scope#%d", i+1), Prompt: p, Tags: []string{"out-of-scope"}}
+	}
+	return cases
+}
+
+// scopeSample is a case's best result.
+type scopeSample struct {
+	Score    float32
+	Selected ID   // The best result's tool
+	Expected ID   // The first acceptable tool for in-scope cases; "" for out-of-scope cases
+	Correct  bool // The best result is an acceptable tool
+}
+
+// prPoint is the precision, recall & F1 of accepting the best result when it scores at or above Threshold.
+// Accepting a correct result is a true positive, accepting any other result (including every result for an
+// out-of-scope case) a false positive; recall is relative to all in-scope cases.
+type prPoint struct {
+	Threshold               float32
+	Precision, Recall, F1   float64
+	InScope                 int
+	Accepted, TruePositives int
+	OutOfScopeShowed        int // Out-of-scope cases whose best result was accepted
+}
+
+func prAt(samples []scopeSample, inScope int, threshold float32) prPoint {
+	p := prPoint{Threshold: threshold, InScope: inScope}
+	for _, s := range samples {
+		if s.Score < threshold {
+			continue
+		}
+		p.Accepted++
+		if s.Correct {
+			p.TruePositives++
+		}
+		if s.Expected == "" {
+			p.OutOfScopeShowed++
+		}
+	}
+	if p.Accepted > 0 {
+		p.Precision = float64(p.TruePositives) / float64(p.Accepted)
+	}
+	if inScope > 0 {
+		p.Recall = float64(p.TruePositives) / float64(inScope)
+	}
+	if p.Precision+p.Recall > 0 {
+		p.F1 = 2 * p.Precision * p.Recall / (p.Precision + p.Recall)
+	}
+	return p
+}
+
+// prCurve returns the precision/recall point at each distinct sample score, from the highest threshold to
+// the lowest.
+func prCurve(samples []scopeSample, inScope int) []prPoint {
+	thresholds := []float32{}
+	for _, s := range samples {
+		thresholds = append(thresholds, s.Score)
+	}
+	slices.SortFunc(thresholds, func(a, b float32) int { return cmp.Compare(b, a) })
+	curve := []prPoint{}
+	for _, t := range slices.Compact(thresholds) {
+		curve = append(curve, prAt(samples, inScope, t))
+	}
+	return curve
+}
+
+// bestF1 returns the point with the highest F1; the highest threshold wins ties.
+func bestF1(curve []prPoint) prPoint {
+	best := prPoint{Threshold: float32(math.Inf(1))}
+	for _, p := range curve {
+		if p.F1 > best.F1 {
+			best = p
+		}
+	}
+	return best
+}
+
+// collectScopeSamples runs every case without a minimum score & records its best result. A sample's score is
+// the best result's vector similarity, the score MinimumScore applies to, rather than s's final score (which
+// stages like hybrid search or intent scoring put on another scale). o.TopK is kept so that stages like
+// reranking have candidates to choose among.
+func collectScopeSamples(s searcher, db *VectorDB, cases []promptCase, o QueryOptions) []scopeSample {
+	o.MinimumScore = float32(math.Inf(-1))
+	samples := []scopeSample{}
+	for _, c := range cases {
+		results := s.Search(c.Query(), c.Vector, o)
+		if len(results) == 0 {
+			continue
+		}
+		sample := scopeSample{Score: db.score(c.Vector, results[0].Entry, &o), Selected: results[0].Entry.ID}
+		if !c.IsNegative() {
+			accepted := acceptedEntries(db, &c.testCase)
+			if len(accepted) == 0 {
+				log.Printf("Skipping case %s expecting unknown tools %s", c.ID, c.ExpectedString())
+				continue
+			}
+			sample.Expected, sample.Correct = accepted[0].ID, c.Accepts(results[0].Entry)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// toolThreshold is the threshold maximizing F1 for the cases whose best result is one tool.
+type toolThreshold struct {
+	Tool ID
+	prPoint
+}
+
+// perToolThresholds finds, for each tool selected as some case's best result, the threshold maximizing F1
+// over those cases; recall is relative to the in-scope cases expecting the tool.
+func perToolThresholds(samples []scopeSample) []toolThreshold {
+	selected, expected := map[ID][]scopeSample{}, map[ID]int{}
+	for _, s := range samples {
+		selected[s.Selected] = append(selected[s.Selected], s)
+		if s.Expected != "" {
+			expected[s.Expected]++
+		}
+	}
+	thresholds := []toolThreshold{}
+	for _, tool := range slices.Sorted(maps.Keys(selected)) {
+		thresholds = append(thresholds, toolThreshold{Tool: tool, prPoint: bestF1(prCurve(selected[tool], expected[tool]))})
+	}
+	return thresholds
+}
+
+// reportRejectionThreshold reports the MinimumScore threshold maximizing F1 over the in-scope & out-of-scope
+// cases, overall & per tool, with the precision/recall curve.
+func reportRejectionThreshold(s searcher, db *VectorDB, testCases []testCase, o QueryOptions) {
+	start := time.Now()
+	samples := collectScopeSamples(s, db, embedPromptCases(testCases), o)
+	inScope := 0
+	for _, s := range samples {
+		if s.Expected != "" {
+			inScope++
+		}
+	}
+	curve := prCurve(samples, inScope)
+	best := bestF1(curve)
+	perTool := perToolThresholds(samples)
+	accepted := slices.DeleteFunc(slices.Clone(samples), func(s scopeSample) bool { // Applying each tool's own threshold
+		i := slices.IndexFunc(perTool, func(t toolThreshold) bool { return t.Tool == s.Selected })
+		return s.Score < perTool[i].Threshold
+	})
+	combined := prAt(accepted, inScope, float32(math.Inf(-1)))
+
+	// Show at most ~20 points of the curve
+	step := max(1, len(curve)/20)
+	shown := []prPoint{}
+	for i := 0; i < len(curve); i += step {
+		shown = append(shown, curve[i])
+	}
+
+	if isMarkdownOutput() {
+		fmt.Println("## Out-of-Scope Detection")
+		fmt.Println()
+		fmt.Printf("**In-scope cases:** %d  \n", inScope)
+		fmt.Printf("**Out-of-scope cases:** %d  \n", len(samples)-inScope)
+		fmt.Printf("**Best threshold (MinimumScore):** %.6f  \n", best.Threshold)
+		fmt.Printf("**Precision:** %.1f%%, **Recall:** %.1f%%, **F1:** %.4f  \n", best.Precision*100, best.Recall*100, best.F1)
+		fmt.Printf("**Out-of-scope cases still returning a tool:** %d  \n", best.OutOfScopeShowed)
+		fmt.Printf("**With per-tool thresholds:** precision %.1f%%, recall %.1f%%, F1 %.4f  \n", combined.Precision*100, combined.Recall*100, combined.F1)
+		fmt.Println()
+		fmt.Println("### Precision/Recall Curve")
+		fmt.Println()
+		fmt.Println("| Threshold | Precision | Recall | F1 | Out-of-Scope Accepted |")
+		fmt.Println("|-----------|-----------|--------|----|-----------------------|")
+		for _, p := range shown {
+			fmt.Printf("| %.6f | %.1f%% | %.1f%% | %.4f | %d |\n", p.Threshold, p.Precision*100, p.Recall*100, p.F1, p.OutOfScopeShowed)
+		}
+		fmt.Println()
+		fmt.Println("### Per-Tool Thresholds")
+		fmt.Println()
+		fmt.Println("| Tool | Threshold | Precision | Recall | F1 |")
+		fmt.Println("|------|-----------|-----------|--------|----|")
+		for _, t := range perTool {
+			fmt.Printf("| `%s` | %.6f | %.1f%% | %.1f%% | %.4f |\n", t.Tool, t.Threshold, t.Precision*100, t.Recall*100, t.F1)
+		}
+		fmt.Println()
+		fmt.Printf("**Execution Time:** %v  \n", time.Since(start))
+	} else {
+		fmt.Printf("\nOut-of-scope detection: in-scope cases=%d, out-of-scope cases=%d\n", inScope, len(samples)-inScope)
+		fmt.Printf("   Best threshold (MinimumScore)=%.6f: precision=%.1f%%, recall=%.1f%%, F1=%.4f, out-of-scope still returning a tool=%d\n",
+			best.Threshold, best.Precision*100, best.Recall*100, best.F1, best.OutOfScopeShowed)
+		fmt.Printf("   With per-tool thresholds: precision=%.1f%%, recall=%.1f%%, F1=%.4f\n", combined.Precision*100, combined.Recall*100, combined.F1)
+		fmt.Printf("\n   %-10s %9s %9s %8s %12s\n", "Threshold", "Precision", "Recall", "F1", "OutOfScope")
+		for _, p := range shown {
+			fmt.Printf("   %-10.6f %8.1f%% %8.1f%% %8.4f %12d\n", p.Threshold, p.Precision*100, p.Recall*100, p.F1, p.OutOfScopeShowed)
+		}
+		fmt.Printf("\n   %-50s %10s %9s %9s %8s\n", "Tool", "Threshold", "Precision", "Recall", "F1")
+		for _, t := range perTool {
+			fmt.Printf("   %-50s %10.6f %8.1f%% %8.1f%% %8.4f\n", t.Tool, t.Threshold, t.Precision*100, t.Recall*100, t.F1)
+		}
+		fmt.Printf("\nExecution time=%v\n", time.Since(start))
+	}
+}
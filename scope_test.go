@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPRCurve(t *testing.T) {
+	samples := []scopeSample{
+		{Score: 0.9, Selected: "a", Expected: "a", Correct: true},
+		{Score: 0.8, Selected: "a", Expected: "b"},
+		{Score: 0.8, Selected: "c"}, // Out of scope; ties with the line above
+		{Score: 0.7, Selected: "d", Expected: "d", Correct: true},
+	}
+	want := []prPoint{
+		{Threshold: 0.9, Precision: 1, Recall: 1.0 / 3, F1: 0.5, InScope: 3, Accepted: 1, TruePositives: 1},
+		{Threshold: 0.8, Precision: 1.0 / 3, Recall: 1.0 / 3, F1: 1.0 / 3, InScope: 3, Accepted: 3, TruePositives: 1, OutOfScopeShowed: 1},
+		{Threshold: 0.7, Precision: 0.5, Recall: 2.0 / 3, F1: 4.0 / 7, InScope: 3, Accepted: 4, TruePositives: 2, OutOfScopeShowed: 1},
+	}
+	curve := prCurve(samples, 3)
+	if len(curve) != len(want) {
+		t.Fatalf("got %d points, want %d (1 per distinct score): %+v", len(curve), len(want), curve)
+	}
+	for i := range want {
+		if !samePRPoint(curve[i], want[i]) {
+			t.Errorf("got point %+v, want %+v", curve[i], want[i])
+		}
+	}
+	if best := bestF1(curve); best.Threshold != 0.7 {
+		t.Errorf("got the best threshold %g, want 0.7", best.Threshold)
+	}
+}
+
+func TestBestF1(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve []prPoint
+		want  float32 // The threshold
+	}{
+		{"the highest threshold wins a tie", []prPoint{{Threshold: 0.9, F1: 0.5}, {Threshold: 0.7, F1: 0.5}, {Threshold: 0.5, F1: 0.4}}, 0.9},
+		{"no points", nil, float32(math.Inf(1))},
+		// With only out-of-scope cases, accepting anything is wrong
+		{"all out of scope", prCurve([]scopeSample{{Score: 0.9, Selected: "a"}, {Score: 0.5, Selected: "b"}}, 0), float32(math.Inf(1))},
+		// With only correct in-scope cases, accepting everything is right
+		{"all correct", prCurve([]scopeSample{{Score: 0.9, Selected: "a", Expected: "a", Correct: true},
+			{Score: 0.5, Selected: "b", Expected: "b", Correct: true}}, 2), 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bestF1(tt.curve); got.Threshold != tt.want {
+				t.Errorf("got threshold %g, want %g", got.Threshold, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerToolThresholds(t *testing.T) {
+	samples := []scopeSample{
+		{Score: 0.9, Selected: "x", Expected: "x", Correct: true},
+		{Score: 0.6, Selected: "x", Expected: "y"},
+		{Score: 0.8, Selected: "y", Expected: "y", Correct: true},
+		{Score: 0.4, Selected: "z"}, // z is only ever selected for out-of-scope cases
+	}
+	want := []toolThreshold{
+		{Tool: "x", prPoint: prPoint{Threshold: 0.9, Precision: 1, Recall: 1, F1: 1, InScope: 1, Accepted: 1, TruePositives: 1}},
+		// Recall is relative to all the cases expecting y, including the one x was selected for
+		{Tool: "y", prPoint: prPoint{Threshold: 0.8, Precision: 1, Recall: 0.5, F1: 2.0 / 3, InScope: 2, Accepted: 1, TruePositives: 1}},
+		{Tool: "z", prPoint: prPoint{Threshold: float32(math.Inf(1))}},
+	}
+	got := perToolThresholds(samples)
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Tool != want[i].Tool || !samePRPoint(got[i].prPoint, want[i].prPoint) {
+			t.Errorf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func samePRPoint(a, b prPoint) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	return a.Threshold == b.Threshold && near(a.Precision, b.Precision) && near(a.Recall, b.Recall) && near(a.F1, b.F1) &&
+		a.InScope == b.InScope && a.Accepted == b.Accepted && a.TruePositives == b.TruePositives &&
+		a.OutOfScopeShowed == b.OutOfScopeShowed
+}
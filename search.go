@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A searcher ranks the DB's entries for a prompt. The evaluation harness, find_tools & the proxy all select
+// tools through a searcher so that every selection strategy is measured exactly as it's used. Searchers
+// are composable: stages like reranking wrap another searcher. Every command & server composes its stages
+// from the flags of searchFlags; the servers, whose catalogs change as they run, rebuild them after each change
+// (see catalogSearcher).
+type searcher interface {
+	// Search returns the best o.TopK entries for a prompt, whose embedding is vector, best first.
+	Search(prompt string, vector []float32, o QueryOptions) []QueryResult
+}
+
+// searchFlags are the flags selecting the stages composed around vector search (see searchConfig.build).
+type searchFlags struct {
+	Hybrid, Intent, Groups, Rerank, Safety string
+	Hierarchy                              int
+}
+
+func addSearchFlags(fs *flag.FlagSet) *searchFlags {
+	f := &searchFlags{}
+	fs.StringVar(&f.Hybrid, "hybrid", "", "fuse BM25 lexical search with vector search: rrf or weighted optionally "+
+		"followed by :k=60,lexical=0.5,k1=1.2,b=0.75 (see bm25.go)")
+	fs.StringVar(&f.Intent, "intent", "", "boost the tools whose verb matches the prompt's intent: rules or "+
+		"learned:examples=file optionally followed by ,boost=0.05 (see intent.go)")
+	fs.IntVar(&f.Hierarchy, "hierarchy", 0, "if > 0, search only the tools of this many of the best service groups")
+	fs.StringVar(&f.Groups, "groups", "", "JSON file assigning tools to -hierarchy's groups; by default, tools are "+
+		"grouped by their names")
+	fs.StringVar(&f.Rerank, "rerank", "", "have a chat model reorder the selected tools: aoai or scripted[:file] (see rerank.go)")
+	fs.StringVar(&f.Safety, "safety", "", "safety policies keeping destructive tools from being selected unless the "+
+		"prompt asks for one: none or exclude, demote & margin joined by + (see safety.go)")
+	return f
+}
+
+// searchConfig holds the stages parsed from searchFlags, so searchers of changing DBs can be built cheaply.
+type searchConfig struct {
+	fusion     *fusionOptions
+	classifier intentClassifier
+	boost      float32
+	topGroups  int
+	grouping   map[string][]string
+	model      chatModel
+	safety     *safetySearcher // The policies; each searcher gets its own copy
+}
+
+func (f *searchFlags) parse() (*searchConfig, error) {
+	c := &searchConfig{topGroups: f.Hierarchy}
+	if f.Hybrid != "" {
+		fusion, err := parseFusionOptions(f.Hybrid)
+		if err != nil {
+			return nil, err
+		}
+		c.fusion = &fusion
+	}
+	if f.Intent != "" {
+		var err error
+		if c.classifier, c.boost, err = parseIntentOptions(f.Intent); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case f.Hierarchy < 0:
+		return nil, fmt.Errorf("invalid hierarchy %d; expected the number of groups to search", f.Hierarchy)
+	case f.Groups != "" && f.Hierarchy == 0:
+		return nil, fmt.Errorf("-groups requires -hierarchy")
+	case f.Groups != "":
+		c.grouping = loadGroupingFromJSON(f.Groups)
+	}
+	if f.Rerank != "" {
+		var err error
+		if c.model, err = parseChatModel(f.Rerank); err != nil {
+			return nil, err
+		}
+	}
+	if f.Safety != "" {
+		var err error
+		if c.safety, err = parseSafetyOptions(f.Safety); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// build returns the searcher of db, whose entries are tools (with documents composed by o), that the stages
+// compose: vector search or, with -hybrid, BM25 fused with it; then the intent boost, the hierarchy of service
+// groups, reranking & the safety policies, each wrapping the one before.
+func (c *searchConfig) build(db *VectorDB, tools []mcp.Tool, o *indexOptions) searcher {
+	var s searcher = vectorSearcher{db: db}
+	if c.fusion != nil {
+		s = &hybridSearcher{db: db, lexical: bm25FromTools(tools, o, c.fusion.K1, c.fusion.B), fusion: *c.fusion}
+	}
+	if c.classifier != nil {
+		s = &intentSearcher{db: db, next: s, classifier: c.classifier, Boost: c.boost}
+	}
+	if c.topGroups > 0 {
+		s = newHierarchicalSearcher(db, tools, c.grouping, c.topGroups, s)
+	}
+	if c.model != nil {
+		s = &rerankSearcher{next: s, model: c.model}
+	}
+	if c.safety != nil {
+		safety := *c.safety
+		safety.db, safety.next = db, s
+		s = &safety
+	}
+	return s
+}
+
+// catalogSearcher is the searcher of a server's DB, whose tools change as the server runs. Rebuild, called after
+// each change, composes the stages anew so -hybrid's BM25 index & -hierarchy's groups cover the current tools;
+// searches in progress finish with the stages they started with.
+type catalogSearcher struct {
+	config  *searchConfig
+	db      *VectorDB
+	io      *indexOptions
+	mu      sync.Mutex // Serializes rebuilds so the last one stored saw the latest change
+	current atomic.Pointer[searcher]
+}
+
+func newCatalogSearcher(c *searchConfig, db *VectorDB, o *indexOptions) *catalogSearcher {
+	s := &catalogSearcher{config: c, db: db, io: o}
+	s.Rebuild()
+	return s
+}
+
+// Rebuild composes the stages for the tools now in the DB.
+func (s *catalogSearcher) Rebuild() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	built := s.config.build(s.db, dbTools(s.db), s.io)
+	s.current.Store(&built)
+}
+
+func (s *catalogSearcher) Unwrap() searcher { return *s.current.Load() }
+
+func (s *catalogSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	return s.Unwrap().Search(prompt, vector, o)
+}
+
+// dbTools returns the tools of db's entries.
+func dbTools(db *VectorDB) []mcp.Tool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	tools := []mcp.Tool{}
+	for _, e := range db.entries {
+		if t, ok := e.Metadata.(*mcp.Tool); ok {
+			tools = append(tools, *t)
+		}
+	}
+	return tools
+}
+
+// vectorSearcher ranks entries purely by vector similarity.
+type vectorSearcher struct {
+	db *VectorDB
+}
+
+func (s vectorSearcher) Search(prompt string, vector []float32, o QueryOptions) []QueryResult {
+	return s.db.Query(vector, o)
+}
+
+// findSearcher returns the first searcher of type T in the chain starting at s; searchers wrapping another
+// searcher expose it via an Unwrap method.
+func findSearcher[T searcher](s searcher) (T, bool) {
+	for {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		u, ok := s.(interface{ Unwrap() searcher })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		s = u.Unwrap()
+	}
+}
+
+// searcherStages describes the chain of searchers starting at s, outermost first, with the parameters that
+// shape their scores; e.g. "safety(exclude=true, tie=0, margin=0) > vector". A calibration records the
+// stages whose scores it was fit on.
+func searcherStages(s searcher) string {
+	stages := []string{}
+	for s != nil {
+		switch t := s.(type) {
+		case *catalogSearcher: // Not a stage of its own
+		case vectorSearcher:
+			stages = append(stages, "vector")
+		case *hybridSearcher:
+			stages = append(stages, fmt.Sprintf("hybrid(%v)", t.fusion))
+		case *intentSearcher:
+			classifier := "rules"
+			if l, ok := t.classifier.(*learnedClassifier); ok {
+				classifier = "learned:" + l.Examples
+			}
+			stages = append(stages, fmt.Sprintf("intent(%s, boost=%g)", classifier, t.Boost))
+		case *hierarchicalSearcher:
+			stages = append(stages, fmt.Sprintf("hierarchy(%d groups)", t.TopGroups))
+		case *rerankSearcher:
+			stages = append(stages, "rerank")
+		case *safetySearcher:
+			stages = append(stages, fmt.Sprintf("safety(exclude=%t, tie=%g, margin=%g)", t.Exclude, t.Tie, t.MinMargin))
+		default:
+			stages = append(stages, fmt.Sprintf("%T", s))
+		}
+		u, ok := s.(interface{ Unwrap() searcher })
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	return strings.Join(stages, " > ")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+func TestSearchFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string // The searcherStages of the searcher built; "" if the flags are invalid
+	}{
+		{nil, "vector"},
+		{[]string{"-safety", "none"}, "safety(exclude=false, tie=0, margin=0) > vector"},
+		{[]string{"-hybrid", "rrf", "-intent", "rules:boost=0.01", "-hierarchy", "2", "-rerank", "scripted", "-safety", "exclude"},
+			"safety(exclude=true, tie=0, margin=0) > rerank > hierarchy(2 groups) > intent(rules, boost=0.01) > hybrid(rrf:k=60,lexical=0.5)"},
+		{[]string{"-hybrid", "fused"}, ""},
+		{[]string{"-intent", "learned"}, ""}, // learned requires examples
+		{[]string{"-hierarchy", "-1"}, ""},
+		{[]string{"-groups", "groups.json"}, ""}, // -groups requires -hierarchy
+		{[]string{"-rerank", "oracle"}, ""},
+		{[]string{"-safety", "forbid"}, ""},
+	}
+	useCountingEmbedder(t)
+	list := newTestTool("storage-account-list", "List the storage accounts in a subscription")
+	del := newTestTool("storage-account-delete", "Delete a storage account")
+	db, tools := newTestDB(list, del), []mcp.Tool{list, del}
+	o := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := addSearchFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			c, err := f.parse()
+			switch {
+			case tt.want == "" && err == nil:
+				t.Fatalf("got no error, want one")
+			case tt.want == "":
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if got := searcherStages(c.build(db, tools, o)); got != tt.want {
+				t.Errorf("got stages %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Each searcher built from a searchConfig has its own stages, wrapping its own DB.
+func TestSearchConfigBuildsIndependentSearchers(t *testing.T) {
+	useCountingEmbedder(t)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := addSearchFlags(fs)
+	must(0, fs.Parse([]string{"-safety", "exclude"}))
+	c := must(f.parse())
+	list := newTestTool("storage-account-list", "List the storage accounts in a subscription")
+	del := newTestTool("storage-account-delete", "Delete a storage account")
+	o := &indexOptions{Builder: must(lookupDocumentBuilder(""))}
+	db1, db2 := newTestDB(list), newTestDB(list, del)
+	s1 := c.build(db1, []mcp.Tool{list}, o).(*safetySearcher)
+	s2 := c.build(db2, []mcp.Tool{list, del}, o).(*safetySearcher)
+	if s1 == s2 || s1.db != db1 || s2.db != db2 || s1.next.(vectorSearcher).db != db1 {
+		t.Errorf("the searchers share their safety stage or search the wrong DB")
+	}
+}
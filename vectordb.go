@@ -16,8 +16,18 @@ type Entry struct {
 	ID       ID
 	Metadata any
 	Vector   []float32
+	Vectors  []NamedVector // Optional additional vectors; see QueryOptions.Aggregation
 }
 
+// NamedVector is one of an Entry's additional vectors. Vectors with the same Name form a group
+// (e.g. one vector per example utterance); Entry.Vector is the only member of the PrimaryVector group.
+type NamedVector struct {
+	Name   string
+	Vector []float32
+}
+
+const PrimaryVector = "primary"
+
 func (e *Entry) String() string {
 	vectorHigh := min(len(e.Vector), 3)
 	return fmt.Sprintf("ID=%s, Metadata=%#v, Vector=%v", e.ID, e.Metadata, e.Vector[:vectorHigh])
@@ -82,8 +92,71 @@ type QueryResult struct {
 
 type QueryOptions struct {
 	TopK         int
-	MinimumScore float32
+	MinimumScore float32             // The worst score returned: a similarity's minimum or, if > 0, a distance's maximum
 	Predicate    func(e *Entry) bool // Optional predicate to filter results
+	Aggregation  Aggregation         // How the scores of an entry's vectors combine; ignored for entries without Vectors
+	Weights      map[string]float32  // Vector group name -> weight for AggregateWeightedSum; missing groups weigh 1
+}
+
+// Aggregation determines how the scores of an entry's vectors combine into the entry's single score.
+// Each group of same-named vectors first scores the best (closest) of its vectors' scores; the group
+// scores are then aggregated.
+type Aggregation int
+
+const (
+	AggregateMax         Aggregation = iota // The best group score
+	AggregateMean                           // The mean of the group scores
+	AggregateWeightedSum                    // The weighted sum of the group scores divided by the sum of the weights
+)
+
+func (db *VectorDB) score(vector []float32, e *Entry, o *QueryOptions) float32 {
+	score := db.distanceMetric.Distance(vector, e.Vector)
+	if len(e.Vectors) == 0 {
+		return score
+	}
+	groups := map[string]float32{PrimaryVector: score} // Group name -> best score in the group
+	for _, nv := range e.Vectors {
+		s := db.distanceMetric.Distance(vector, nv.Vector)
+		if best, ok := groups[nv.Name]; !ok || closer(db.distanceMetric, s, best) {
+			groups[nv.Name] = s
+		}
+	}
+	switch o.Aggregation {
+	case AggregateMean:
+		sum := float32(0)
+		for _, s := range groups {
+			sum += s
+		}
+		return sum / float32(len(groups))
+	case AggregateWeightedSum:
+		sum, weights := float32(0), float32(0)
+		for name, s := range groups {
+			w, ok := o.Weights[name]
+			if !ok {
+				w = 1
+			}
+			sum, weights = sum+w*s, weights+w
+		}
+		if weights == 0 {
+			return 0
+		}
+		return sum / weights
+	default: // AggregateMax
+		for _, s := range groups {
+			if closer(db.distanceMetric, s, score) {
+				score = s
+			}
+		}
+		return score
+	}
+}
+
+// meetsMinimum returns true if score is at least as close as o.MinimumScore.
+func (db *VectorDB) meetsMinimum(score float32, o *QueryOptions) bool {
+	if !db.distanceMetric.BiggerIsCloser() && o.MinimumScore <= 0 {
+		return true // A distance is never negative, so a maximum that isn't positive is none
+	}
+	return !closer(db.distanceMetric, o.MinimumScore, score)
 }
 
 func (db *VectorDB) Query(vector []float32, o QueryOptions) []QueryResult {
@@ -112,7 +185,7 @@ func (db *VectorDB) querySlice(entries []*Entry, vector []float32, o *QueryOptio
 		wg.Wait()                                               // Wait for the left goroutine to finish
 
 		// Return the top K scores from both left & right
-		resultCount := len(leftResult) + len(rightResult)
+		resultCount := min(len(leftResult)+len(rightResult), o.TopK)
 		results := make([]QueryResult, 0, resultCount) // Slice sorted from best Score to worst score
 		for len(results) < resultCount /* more available */ {
 			switch {
@@ -122,10 +195,10 @@ func (db *VectorDB) querySlice(entries []*Entry, vector []float32, o *QueryOptio
 			case len(rightResult) == 0: // Only left results left
 				results = append(results, leftResult[0])
 				leftResult = leftResult[1:]
-			case leftResult[0].Score >= rightResult[0].Score: // Left result same or better than right
+			case !closer(db.distanceMetric, rightResult[0].Score, leftResult[0].Score): // Left result same or better than right
 				results = append(results, leftResult[0])
 				leftResult = leftResult[1:]
-			default: // Right result less than left
+			default: // Right result better than left
 				results = append(results, rightResult[0])
 				rightResult = rightResult[1:]
 			}
@@ -133,29 +206,25 @@ func (db *VectorDB) querySlice(entries []*Entry, vector []float32, o *QueryOptio
 		return results
 	}
 
-	results := make([]QueryResult, 0, o.TopK) // Slice of length 0, capacity topK; sorted from high Score to low score
+	results := make([]QueryResult, 0, o.TopK) // Slice of length 0, capacity topK; sorted from best Score to worst score
 	for _, e := range entries {
 		if o.Predicate != nil && !o.Predicate(e) { // If predicate returns false, skip this entry
 			continue
 		}
-		score := db.distanceMetric.Distance(vector, e.Vector)
-		if score < o.MinimumScore {
-			continue // If score is below the minimum, skip this entry
+		score := db.score(vector, e, o)
+		if !db.meetsMinimum(score, o) {
+			continue // If score is worse than the minimum, skip this entry
 		}
 		qr := QueryResult{Score: score, Entry: e} // Construct potential QueryResult
 		// Find out where this score be inserted?
 		n, _ := slices.BinarySearchFunc(results, qr, func(a, b QueryResult) int {
-			n := 0
-			switch {
-			case a.Score < b.Score:
-				n = 1
-			case a.Score > b.Score:
-				n = -1
-			}
-			if db.distanceMetric.BiggerIsCloser() {
-				n = -n
+			switch { // Closest (best) first
+			case closer(db.distanceMetric, a.Score, b.Score):
+				return -1
+			case closer(db.distanceMetric, b.Score, a.Score):
+				return 1
 			}
-			return n
+			return 0
 		})
 		if n == cap(results) {
 			// We're at capacity & Score is lower than anything we already have; do nothing (discard it)
@@ -171,9 +240,20 @@ func (db *VectorDB) querySlice(entries []*Entry, vector []float32, o *QueryOptio
 
 type DistanceMetric interface {
 	Distance(a, b []float32) float32
+	// BiggerIsCloser returns true if a bigger Distance means more similar vectors (a similarity, like cosine
+	// & dot product) or false if a smaller one does (a true distance); Query ranks the closest first.
 	BiggerIsCloser() bool
 }
 
+// closer returns true if score a is closer (better) than score b by metric m; every comparison of scores
+// goes through it so no code assumes bigger is better.
+func closer(m DistanceMetric, a, b float32) bool {
+	if m.BiggerIsCloser() {
+		return a > b
+	}
+	return a < b
+}
+
 var _, _ DistanceMetric = CosineSimilarity{}, DotProduct{}
 
 type CosineSimilarity struct{}
@@ -192,7 +272,7 @@ func (c CosineSimilarity) Distance(a, b []float32) float32 {
 	// Potential perf improvements: https://sourcegraph.com/blog/slow-to-simd
 }
 
-func (c CosineSimilarity) BiggerIsCloser() bool { return false }
+func (c CosineSimilarity) BiggerIsCloser() bool { return true }
 
 type DotProduct struct{}
 
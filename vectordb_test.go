@@ -0,0 +1,97 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestQueryRanksClosestFirst(t *testing.T) {
+	for name, metric := range distanceMetrics {
+		t.Run(name, func(t *testing.T) {
+			db := NewVectorDB(metric, nil)
+			for id, v := range map[ID][]float32{"far": {0, 1}, "near": {1, 0.2}, "middle": {0.7, 1}} {
+				db.Upsert(&Entry{ID: id, Vector: v})
+			}
+			if got, want := resultIDs(db.Query([]float32{1, 0}, QueryOptions{TopK: 3})), []ID{"near", "middle", "far"}; !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// euclideanDistance is a metric by which smaller is closer, so tests cover both orders.
+type euclideanDistance struct{}
+
+func (euclideanDistance) Distance(a, b []float32) float32 {
+	sum := float64(0)
+	for k := range a {
+		sum += math.Pow(float64(a[k]-b[k]), 2)
+	}
+	return float32(math.Sqrt(sum))
+}
+
+func (euclideanDistance) BiggerIsCloser() bool { return false }
+
+// Over 100 entries, Query merges the results of goroutines ranking parts of the entries.
+func TestQueryRanksClosestFirstAcrossGoroutines(t *testing.T) {
+	metrics := maps.Clone(distanceMetrics)
+	metrics["euclidean"] = euclideanDistance{}
+	const n = 250
+	angle := func(rank int) float64 { return float64(rank) * 0.005 }
+	for name, metric := range metrics {
+		t.Run(name, func(t *testing.T) {
+			db, want := NewVectorDB(metric, nil), []ID{}
+			for i := range n {
+				rank := i * 37 % n // So the order of the IDs isn't the ranking
+				id := ID(fmt.Sprintf("%03d", i))
+				db.Upsert(&Entry{ID: id, Vector: []float32{float32(math.Cos(angle(rank))), float32(math.Sin(angle(rank)))}})
+				if rank < 5 {
+					want = append(want, id)
+				}
+			}
+			slices.SortFunc(want, func(a, b ID) int { return cmp.Compare(rankOf(a, n), rankOf(b, n)) })
+			query := []float32{1, 0}
+			if got := resultIDs(db.Query(query, QueryOptions{TopK: 5})); !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+
+			// The minimum is the third best's score, so only the best 3 are returned
+			third, _ := db.Get(want[2])
+			minimum := metric.Distance(query, third.Vector)
+			if got := resultIDs(db.Query(query, QueryOptions{TopK: 5, MinimumScore: minimum})); !slices.Equal(got, want[:3]) {
+				t.Errorf("with MinimumScore %g: got %v, want %v", minimum, got, want[:3])
+			}
+		})
+	}
+}
+
+// rankOf returns the rank of the entry with id in TestQueryRanksClosestFirstAcrossGoroutines.
+func rankOf(id ID, n int) int {
+	i, _ := strconv.Atoi(string(id))
+	return i * 37 % n
+}
+
+// An entry scores its closest vector's score (with AggregateMax) whichever way the metric orders scores.
+func TestQueryAggregatesClosestVector(t *testing.T) {
+	metrics := maps.Clone(distanceMetrics)
+	metrics["euclidean"] = euclideanDistance{}
+	for name, metric := range metrics {
+		t.Run(name, func(t *testing.T) {
+			db := NewVectorDB(metric, nil)
+			db.Upsert(&Entry{ID: "examples", Vector: []float32{0, 1}, Vectors: []NamedVector{{"example", []float32{1, 0.1}}, {"example", []float32{0.2, 1}}}})
+			db.Upsert(&Entry{ID: "primary", Vector: []float32{0.8, 0.5}})
+			results := db.Query([]float32{1, 0}, QueryOptions{TopK: 2})
+			if got, want := resultIDs(results), []ID{"examples", "primary"}; !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := results[0].Score, metric.Distance([]float32{1, 0}, []float32{1, 0.1}); got != want {
+				t.Errorf("examples scored %g, want its closest vector's %g", got, want)
+			}
+		})
+	}
+}
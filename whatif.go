@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+// A what-if evaluation tries alternative wording without editing the tools file: an overrides file replaces
+// some tools' descriptions & titles, and the evaluation compares the overridden catalog to the unmodified one
+// side by side. The overridden catalog's DB starts as a copy of the original's, so only the overridden tools
+// whose embedded text changed are embedded again.
+
+// toolOverride replaces a tool's description and/or title.
+type toolOverride struct {
+	Description *string `json:"description,omitempty"`
+	Title       *string `json:"title,omitempty"`
+}
+
+// loadOverrides loads a JSON object of tool names (optionally server-qualified) & their overrides:
+// {"azmcp-storage-account-list": {"description": "...", "title": "..."}, ...}.
+func loadOverrides(filename string) (map[string]toolOverride, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]toolOverride{}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides from %s: %w", filename, err)
+	}
+	return overrides, nil
+}
+
+// applyOverrides returns a copy of tools with the overrides applied; a name overrides the tool with that ID
+// or, if unqualified, that name on any server. It fails if a name matches no tool.
+func applyOverrides(tools []mcp.Tool, overrides map[string]toolOverride) ([]mcp.Tool, error) {
+	overridden := slices.Clone(tools)
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		override, found := overrides[name], false
+		for i := range overridden {
+			t := &overridden[i]
+			if string(entryID(t)) != name && t.Name != name {
+				continue
+			}
+			found = true
+			if override.Description != nil {
+				t.Description = override.Description
+			}
+			if override.Title != nil {
+				t.Title = override.Title
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("the overrides name the unknown tool %q", name)
+		}
+	}
+	return overridden, nil
+}
+
+// reportWhatIf reports how the tools with the overrides in filename fare on the test prompts compared to the
+// unmodified tools (in db, searched by s; the overridden tools are searched by the same stages, search).
+func reportWhatIf(filename string, search *searchConfig, s searcher, tools []mcp.Tool, db *VectorDB, io *indexOptions, testCases []testCase, o QueryOptions) error {
+	start := time.Now()
+	overrides, err := loadOverrides(filename)
+	if err != nil {
+		return err
+	}
+	overridden, err := applyOverrides(tools, overrides)
+	if err != nil {
+		return err
+	}
+	whatIfDB, previous := cloneDB(db), map[ID]bool{}
+	for i := range tools {
+		previous[entryID(&tools[i])] = true
+	}
+	// Only embeds the tools whose embedded text changed
+	if _, err := reindexTools(whatIfDB, io, previous, overridden); err != nil {
+		return err
+	}
+	changes := diffTools(io, tools, overridden)
+	if !isMarkdownOutput() {
+		reembedded := 0
+		for _, c := range changes {
+			if c.Change == "embedded text changed" {
+				reembedded++
+			}
+		}
+		fmt.Printf("\nWhat-if: overrides=%s, tools re-embedded=%d\n", filename, reembedded)
+	}
+	reportToolDiff("## What-If", "unmodified", filename, changes, len(tools), len(overridden), s, search.build(whatIfDB, overridden, io),
+		embedPromptCases(testCases), o, start)
+	return nil
+}
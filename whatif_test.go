@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"JeffreyRichter.com/ToolSelection/mcp"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	list := newTestTool("storage-account-list", "List the storage accounts")
+	get := newTestTool("storage-account-get", "Get a storage account")
+	tools := append([]mcp.Tool{list}, append(withServer("east", []mcp.Tool{get}), withServer("west", []mcp.Tool{get})...)...)
+	description, title := func(t mcp.Tool) string { return *t.Description }, func(t mcp.Tool) string {
+		if t.Title == nil {
+			return ""
+		}
+		return *t.Title
+	}
+	newDescription, newTitle := "List every storage account in a subscription", "Storage account details"
+
+	overridden, err := applyOverrides(tools, map[string]toolOverride{
+		"storage-account-list":     {Description: &newDescription},
+		"storage-account-get":      {Title: &newTitle}, // Every server's
+		"east/storage-account-get": {Description: &newDescription},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ description, title string }{
+		{newDescription, ""},
+		{newDescription, newTitle},
+		{*get.Description, newTitle},
+	}
+	for i, w := range want {
+		if description(overridden[i]) != w.description || title(overridden[i]) != w.title {
+			t.Errorf("%s: got description %q & title %q, want %q & %q", entryID(&overridden[i]),
+				description(overridden[i]), title(overridden[i]), w.description, w.title)
+		}
+	}
+	if description(tools[0]) != *list.Description || tools[1].Title != nil {
+		t.Errorf("the original tools were modified")
+	}
+
+	for _, name := range []string{"storage-account-delete", "north/storage-account-get"} {
+		if _, err := applyOverrides(tools, map[string]toolOverride{name: {Description: &newDescription}}); err == nil {
+			t.Errorf("overriding the unknown tool %q succeeded", name)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "overrides.json")
+	must(0, os.WriteFile(filename, []byte(`{"storage-account-list": {"description": "List accounts"}, "east/storage-account-get": {"title": "Get"}}`), 0o644))
+	overrides, err := loadOverrides(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := overrides["storage-account-list"]; len(overrides) != 2 || o.Description == nil || *o.Description != "List accounts" ||
+		o.Title != nil || overrides["east/storage-account-get"].Title == nil {
+		t.Errorf("got %+v", overrides)
+	}
+
+	must(0, os.WriteFile(filename, []byte(`["storage-account-list"]`), 0o644))
+	if _, err := loadOverrides(filename); err == nil {
+		t.Errorf("loading an array of overrides succeeded")
+	}
+	if _, err := loadOverrides(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("loading a missing file succeeded")
+	}
+}